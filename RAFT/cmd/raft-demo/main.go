@@ -1,21 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/rushikeshg25/raft/internal/kvraft"
+	"github.com/rushikeshg25/raft/internal/protorpc"
 	"github.com/rushikeshg25/raft/internal/raft"
 	"github.com/rushikeshg25/raft/internal/rpc"
+	"github.com/rushikeshg25/raft/internal/status"
+	"github.com/rushikeshg25/raft/internal/storage"
 )
 
 func main() {
 	id := flag.Int("id", 0, "Node ID")
 	cluster := flag.String("cluster", "localhost:8000,localhost:8001,localhost:8002", "Comma-separated cluster addresses")
+	dataDir := flag.String("data", "data", "Directory for persistent Raft state")
+	join := flag.Bool("join", false, "Start outside the configuration and wait to be added by the leader")
+	kv := flag.Bool("kv", false, "Run the replicated key/value service on top of Raft")
+	snapshotEvery := flag.Int("snapshot-every", 100, "Entries applied between key/value snapshots")
+	window := flag.Int("window", 4, "AppendEntries in flight per follower")
+	maxEntries := flag.Int("max-entries", 64, "Log entries per AppendEntries")
+	httpAddr := flag.String("http", "", "Address to serve /status and /metrics on, e.g. localhost:9000")
+	leaseReads := flag.Bool("lease-reads", false, "Serve key/value reads under a leader lease instead of a heartbeat round")
+	transportName := flag.String("transport", "netrpc", "RPC transport between nodes: netrpc or proto (gRPC over HTTP/2)")
+	rpcTimeout := flag.Duration("rpc-timeout", 500*time.Millisecond, "Time to wait for a reply from another node")
 	flag.Parse()
 
+	if *transportName != "netrpc" && *transportName != "proto" {
+		log.Fatalf("Unknown transport %q", *transportName)
+	}
+
 	peers := []string{}
 	current := ""
 	for _, char := range *cluster {
@@ -34,18 +59,194 @@ func main() {
 
 	address := peers[*id]
 
-	node := raft.NewRaft(*id, peers, rpc.Call)
-	server := rpc.NewServer(node)
+	persister, err := storage.NewFilePersister(filepath.Join(*dataDir, fmt.Sprintf("node-%d", *id)))
+	if err != nil {
+		log.Fatalf("Failed to open data directory: %v", err)
+	}
+
+	bootstrap := peers
+	if *join {
+		bootstrap = nil
+	}
+
+	// The transport also carries the key/value clerk's RPCs. With proto,
+	// log commands go over the wire in the encoding of the service that
+	// submits them.
+	var transport interface {
+		raft.Transport
+		Call(address string, method string, args interface{}, reply interface{}) bool
+		Close()
+	}
+	var commands protorpc.CommandCodec = protorpc.StringCommands{}
+	if *kv {
+		commands = kvraft.OpCodec{}
+	}
+	if *transportName == "proto" {
+		transport = protorpc.NewTransport(*rpcTimeout, commands)
+	} else {
+		transport = rpc.NewTransport(*rpcTimeout)
+	}
+
+	var node *raft.Raft
+	var server interface {
+		Start(address string) error
+		Stop()
+	}
+	var clerk *kvraft.Clerk
+	var kvServer *kvraft.KVServer
+	if *kv {
+		kvServer, err = kvraft.StartKVServer(*id, bootstrap, transport, persister, *snapshotEvery)
+		if err != nil {
+			log.Fatalf("Failed to restore Raft state: %v", err)
+		}
+		node = kvServer.Raft()
+		node.SetLeaseReads(*leaseReads)
+		if *transportName == "proto" {
+			protoServer := protorpc.NewServer(node, commands)
+			protorpc.Register(protoServer, "KVServer.Get", kvServer.Get)
+			protorpc.Register(protoServer, "KVServer.PutAppend", kvServer.PutAppend)
+			server = protoServer
+		} else {
+			rpcServer := rpc.NewServer(node)
+			rpcServer.Register("KVServer", kvServer)
+			server = rpcServer
+		}
+		clerk = kvraft.MakeClerk(peers, transport.Call)
+	} else {
+		applyCh := make(chan raft.ApplyMsg)
+		node, err = raft.NewRaft(*id, bootstrap, transport, applyCh, persister)
+		if err != nil {
+			log.Fatalf("Failed to restore Raft state: %v", err)
+		}
+		if *transportName == "proto" {
+			server = protorpc.NewServer(node, commands)
+		} else {
+			server = rpc.NewServer(node)
+		}
+
+		go func() {
+			for msg := range applyCh {
+				if msg.SnapshotValid {
+					log.Printf("Restored snapshot through index %d (Term: %d)", msg.Index, msg.Term)
+					continue
+				}
+				log.Printf("Applied command %v at index %d (Term: %d)", msg.Command, msg.Index, msg.Term)
+			}
+		}()
+	}
+
+	node.SetPipeline(*window, *maxEntries)
 
 	log.Printf("Starting Node %d on %s", *id, address)
 	if err := server.Start(address); err != nil {
 		log.Fatalf("Failed to start RPC server: %v", err)
 	}
 
-	node.Start()
+	if !*kv {
+		node.Start()
+	}
+
+	if *httpAddr != "" {
+		go func() {
+			log.Printf("Serving status on http://%s/status", *httpAddr)
+			if err := http.ListenAndServe(*httpAddr, status.Handler(node)); err != nil {
+				log.Printf("Status server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Every line typed on stdin is submitted as a command, except for
+	// "add <id> <address>", "learner <id> <address>", "promote <id>" and
+	// "remove <id>" which change the membership and "transfer <id>" which
+	// hands leadership to another node. Only the
+	// leader accepts any of them. With -kv, "put <key> <value>",
+	// "append <key> <value>" and "get <key>" go through the key/value
+	// service instead and are forwarded to the leader, and any other line
+	// is rejected rather than submitted.
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fields := strings.Fields(line)
+
+			switch {
+			case *kv && len(fields) == 3 && fields[0] == "put":
+				clerk.Put(fields[1], fields[2])
+				log.Printf("Put %s = %s", fields[1], fields[2])
+			case *kv && len(fields) == 3 && fields[0] == "append":
+				clerk.Append(fields[1], fields[2])
+				log.Printf("Appended %s to %s", fields[2], fields[1])
+			case *kv && len(fields) == 2 && fields[0] == "get":
+				log.Printf("Get %s = %q", fields[1], clerk.Get(fields[1]))
+			case len(fields) == 3 && fields[0] == "add":
+				serverID, err := strconv.Atoi(fields[1])
+				if err != nil {
+					log.Printf("Invalid server ID %q", fields[1])
+					continue
+				}
+				if err := node.AddServer(serverID, fields[2]); err != nil {
+					log.Printf("Failed to add server %d: %v", serverID, err)
+				}
+			case len(fields) == 3 && fields[0] == "learner":
+				serverID, err := strconv.Atoi(fields[1])
+				if err != nil {
+					log.Printf("Invalid server ID %q", fields[1])
+					continue
+				}
+				if err := node.AddLearner(serverID, fields[2]); err != nil {
+					log.Printf("Failed to add learner %d: %v", serverID, err)
+				}
+			case len(fields) == 2 && fields[0] == "promote":
+				serverID, err := strconv.Atoi(fields[1])
+				if err != nil {
+					log.Printf("Invalid server ID %q", fields[1])
+					continue
+				}
+				if err := node.PromoteLearner(serverID); err != nil {
+					log.Printf("Failed to promote learner %d: %v", serverID, err)
+				}
+			case len(fields) == 2 && fields[0] == "remove":
+				serverID, err := strconv.Atoi(fields[1])
+				if err != nil {
+					log.Printf("Invalid server ID %q", fields[1])
+					continue
+				}
+				if err := node.RemoveServer(serverID); err != nil {
+					log.Printf("Failed to remove server %d: %v", serverID, err)
+				}
+			case len(fields) == 2 && fields[0] == "transfer":
+				serverID, err := strconv.Atoi(fields[1])
+				if err != nil {
+					log.Printf("Invalid server ID %q", fields[1])
+					continue
+				}
+				if err := node.TransferLeadership(serverID); err != nil {
+					log.Printf("Failed to transfer leadership to %d: %v", serverID, err)
+					continue
+				}
+				log.Printf("Transferred leadership to %d", serverID)
+			case *kv:
+				// The state machine only applies key/value operations, and
+				// over protorpc a raw line cannot even be encoded.
+				log.Printf("Unknown command %q; use put <key> <value>, append <key> <value>, get <key>, add, learner, promote, remove or transfer", line)
+			default:
+				index, term, isLeader := node.Submit(line)
+				if !isLeader {
+					log.Printf("Node %d is not the leader, command rejected", *id)
+					continue
+				}
+				log.Printf("Submitted command at index %d (Term: %d)", index, term)
+			}
+		}
+	}()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 	log.Printf("Shutting down Node %d", *id)
+	server.Stop()
+	if kvServer != nil {
+		kvServer.Stop()
+	}
+	transport.Close()
 }
@@ -1,3 +1,5 @@
 module github.com/rushikeshg25/raft
 
 go 1.24.6
+
+require google.golang.org/protobuf v1.36.6
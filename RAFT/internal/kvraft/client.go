@@ -0,0 +1,78 @@
+package kvraft
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Clerk is a client of the key/value service. A Clerk issues one operation
+// at a time; use one Clerk per concurrent caller.
+type Clerk struct {
+	servers  []string
+	sendRPC  func(string, string, interface{}, interface{}) bool
+	clientId int64
+	seq      int64
+	leader   int
+}
+
+// MakeClerk returns a client for the service at servers, indexed by server
+// ID. sendRPC reaches the servers, typically rpc.Transport.Call.
+func MakeClerk(servers []string, sendRPC func(string, string, interface{}, interface{}) bool) *Clerk {
+	return &Clerk{
+		servers:  servers,
+		sendRPC:  sendRPC,
+		clientId: rand.Int63(),
+	}
+}
+
+// Get returns the current value of key, or "" if it does not exist. It
+// keeps retrying until some leader answers.
+func (ck *Clerk) Get(key string) string {
+	args := GetArgs{Key: key}
+
+	for {
+		var reply GetReply
+		ok := ck.sendRPC(ck.servers[ck.leader], "KVServer.Get", &args, &reply)
+		if ok && (reply.Err == OK || reply.Err == ErrNoKey) {
+			return reply.Value
+		}
+		ck.nextServer(ok, reply.LeaderHint)
+	}
+}
+
+func (ck *Clerk) Put(key string, value string) {
+	ck.putAppend(key, value, OpPut)
+}
+
+func (ck *Clerk) Append(key string, value string) {
+	ck.putAppend(key, value, OpAppend)
+}
+
+func (ck *Clerk) putAppend(key string, value string, op OpType) {
+	ck.seq++
+	args := PutAppendArgs{Key: key, Value: value, Op: op, ClientId: ck.clientId, Seq: ck.seq}
+
+	for {
+		var reply PutAppendReply
+		ok := ck.sendRPC(ck.servers[ck.leader], "KVServer.PutAppend", &args, &reply)
+		if ok && reply.Err == OK {
+			return
+		}
+		ck.nextServer(ok, reply.LeaderHint)
+	}
+}
+
+// nextServer follows the leader hint from a reply when there is one, and
+// otherwise tries the next server in turn.
+func (ck *Clerk) nextServer(replied bool, hint int) {
+	if replied && hint >= 0 && hint < len(ck.servers) && hint != ck.leader {
+		ck.leader = hint
+		return
+	}
+
+	ck.leader = (ck.leader + 1) % len(ck.servers)
+	if ck.leader == 0 {
+		// Went through every server without luck; likely mid-election.
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+// Package kvraft is a linearizable key/value service replicated with
+// internal/raft. Writes go through the Raft log; clients tag them with a
+// client ID and sequence number so that retries after a lost reply or a
+// leader change are applied only once. Reads use Raft's ReadIndex.
+package kvraft
+
+import "encoding/gob"
+
+type Err string
+
+const (
+	OK             Err = "OK"
+	ErrNoKey       Err = "ErrNoKey"
+	ErrWrongLeader Err = "ErrWrongLeader"
+	ErrTimeout     Err = "ErrTimeout"
+)
+
+type OpType string
+
+const (
+	OpPut    OpType = "Put"
+	OpAppend OpType = "Append"
+)
+
+// Op is the command stored in the Raft log.
+type Op struct {
+	Type     OpType
+	Key      string
+	Value    string
+	ClientId int64
+	Seq      int64
+}
+
+func init() {
+	// Ops travel inside raft.LogEntry.Command, an interface{}, on disk and
+	// over net/rpc. Over protorpc, OpCodec sends them as kv.proto's Op.
+	gob.Register(Op{})
+}
+
+type PutAppendArgs struct {
+	Key      string
+	Value    string
+	Op       OpType
+	ClientId int64
+	Seq      int64
+}
+
+type PutAppendReply struct {
+	Err Err
+	// LeaderHint is the server the replier believes is leader, or -1.
+	LeaderHint int
+}
+
+// GetArgs carries no client ID or sequence number: reads do not go through
+// the log, so there is nothing to deduplicate.
+type GetArgs struct {
+	Key string
+}
+
+type GetReply struct {
+	Err        Err
+	Value      string
+	LeaderHint int
+}
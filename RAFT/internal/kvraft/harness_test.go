@@ -0,0 +1,151 @@
+package kvraft
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/labrpc"
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/raft"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// cluster runs KVServers on a labrpc network. As in the raft tests, a
+// crashed server is stopped, its End closed and its persister copied, and
+// no goroutine may outlive the test.
+type cluster struct {
+	t   *testing.T
+	net *labrpc.Network
+
+	mu         sync.Mutex
+	addrs      []string
+	servers    []*KVServer
+	ends       []*labrpc.End
+	persisters []*storage.MemoryPersister
+	clerks     []string
+
+	snapshotEvery int
+}
+
+func newCluster(t *testing.T, n int, snapshotEvery int) *cluster {
+	c := &cluster{
+		t:             t,
+		net:           labrpc.NewNetwork(time.Now().UnixNano()),
+		addrs:         make([]string, n),
+		servers:       make([]*KVServer, n),
+		ends:          make([]*labrpc.End, n),
+		persisters:    make([]*storage.MemoryPersister, n),
+		snapshotEvery: snapshotEvery,
+	}
+	for i := range c.addrs {
+		c.addrs[i] = fmt.Sprintf("server-%d", i)
+		c.persisters[i] = storage.NewMemoryPersister()
+	}
+	t.Cleanup(leaktest.Check(t))
+	for i := range c.servers {
+		c.start(i)
+	}
+
+	t.Cleanup(c.cleanup)
+	return c
+}
+
+func (c *cluster) cleanup() {
+	c.mu.Lock()
+	servers := append([]*KVServer(nil), c.servers...)
+	for i, end := range c.ends {
+		end.Close()
+		c.net.DeleteServer(c.addrs[i])
+	}
+	c.mu.Unlock()
+
+	for _, kv := range servers {
+		kv.Stop()
+	}
+}
+
+func (c *cluster) start(i int) {
+	c.mu.Lock()
+	persister := c.persisters[i]
+	end := c.net.MakeEnd(c.addrs[i])
+	c.mu.Unlock()
+
+	kv, err := StartKVServer(i, c.addrs, raft.CallTransport(end.Call), persister, c.snapshotEvery)
+	if err != nil {
+		c.t.Fatalf("failed to start server %d: %v", i, err)
+	}
+
+	c.mu.Lock()
+	c.servers[i] = kv
+	c.ends[i] = end
+	c.mu.Unlock()
+
+	if err := c.net.AddService(c.addrs[i], "Raft", kv.Raft()); err != nil {
+		c.t.Fatalf("failed to register raft %d: %v", i, err)
+	}
+	if err := c.net.AddService(c.addrs[i], "KVServer", kv); err != nil {
+		c.t.Fatalf("failed to register server %d: %v", i, err)
+	}
+}
+
+func (c *cluster) crash(i int) {
+	c.mu.Lock()
+	kv := c.servers[i]
+	c.ends[i].Close()
+	c.net.DeleteServer(c.addrs[i])
+	c.persisters[i] = c.persisters[i].Copy()
+	c.mu.Unlock()
+
+	kv.Stop()
+}
+
+// partition lets only servers in the same group talk to each other. Clerks
+// always join the first group, which tests make the majority.
+func (c *cluster) partition(groups ...[]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addrGroups := make([][]string, len(groups))
+	for g, group := range groups {
+		for _, i := range group {
+			addrGroups[g] = append(addrGroups[g], c.addrs[i])
+		}
+	}
+	addrGroups[0] = append(addrGroups[0], c.clerks...)
+	c.net.Partition(addrGroups...)
+}
+
+func (c *cluster) heal() {
+	c.net.Heal()
+}
+
+func (c *cluster) makeClerk() *Clerk {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addr := fmt.Sprintf("clerk-%d", len(c.clerks))
+	c.clerks = append(c.clerks, addr)
+	return MakeClerk(c.addrs, c.net.MakeEnd(addr).Call)
+}
+
+// raftStateSize returns the largest persisted Raft state among servers.
+func (c *cluster) raftStateSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := 0
+	for _, p := range c.persisters {
+		state, _ := p.ReadState()
+		size = max(size, len(state))
+	}
+	return size
+}
+
+func check(t *testing.T, ck *Clerk, key string, want string) {
+	t.Helper()
+	if got := ck.Get(key); got != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
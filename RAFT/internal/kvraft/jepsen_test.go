@@ -0,0 +1,190 @@
+package kvraft
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/linearizability"
+)
+
+// The tests in this file follow Jepsen: clients drive random operations
+// against the store while a nemesis crashes, restarts and partitions
+// servers, and the recorded history is then checked for linearizability.
+// Each key is an independent register supporting get, put and append.
+
+// kvInput is one client call; op is only meaningful when get is false.
+type kvInput struct {
+	get   bool
+	op    OpType
+	key   string
+	value string
+}
+
+var kvModel = linearizability.Model{
+	Partition: func(history []linearizability.Operation) [][]linearizability.Operation {
+		byKey := make(map[string][]linearizability.Operation)
+		for _, op := range history {
+			key := op.Input.(kvInput).key
+			byKey[key] = append(byKey[key], op)
+		}
+		parts := make([][]linearizability.Operation, 0, len(byKey))
+		for _, part := range byKey {
+			parts = append(parts, part)
+		}
+		return parts
+	},
+	Init: func() interface{} { return "" },
+	Step: func(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+		in := input.(kvInput)
+		value := state.(string)
+		switch {
+		case in.get:
+			return output.(string) == value, value
+		case in.op == OpPut:
+			return true, in.value
+		default:
+			return true, value + in.value
+		}
+	},
+}
+
+// history collects operations from concurrent clients.
+type history struct {
+	mu    sync.Mutex
+	start time.Time
+	ops   []linearizability.Operation
+}
+
+func (h *history) now() int64 {
+	return time.Since(h.start).Nanoseconds()
+}
+
+func (h *history) add(op linearizability.Operation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ops = append(h.ops, op)
+}
+
+type nemesis struct {
+	crashes    bool
+	partitions bool
+	unreliable bool
+}
+
+// runJepsen drives clients against a cluster of n servers for duration
+// while the nemesis injects faults, then heals everything, lets the clients
+// finish and checks the history.
+func runJepsen(t *testing.T, n int, clients int, snapshotEvery int, faults nemesis, duration time.Duration) {
+	c := newCluster(t, n, snapshotEvery)
+	if faults.unreliable {
+		c.net.SetReliable(false)
+	}
+
+	h := &history{start: time.Now()}
+	keys := []string{"x", "y", "z"}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for cli := 0; cli < clients; cli++ {
+		ck := c.makeClerk()
+		wg.Add(1)
+		go func(cli int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(cli)))
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				in := kvInput{key: keys[rng.Intn(len(keys))]}
+				op := linearizability.Operation{ClientId: cli, Call: h.now()}
+				switch rng.Intn(3) {
+				case 0:
+					in.get = true
+					op.Output = ck.Get(in.key)
+				case 1:
+					in.op, in.value = OpPut, fmt.Sprintf("%d.%d;", cli, i)
+					ck.Put(in.key, in.value)
+				default:
+					in.op, in.value = OpAppend, fmt.Sprintf("%d.%d;", cli, i)
+					ck.Append(in.key, in.value)
+				}
+				op.Input = in
+				op.Return = h.now()
+				h.add(op)
+			}
+		}(cli)
+	}
+
+	crashed := make(map[int]bool)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for deadline := time.Now().Add(duration); time.Now().Before(deadline); {
+		time.Sleep(time.Duration(100+rng.Intn(400)) * time.Millisecond)
+
+		switch rng.Intn(3) {
+		case 0:
+			if !faults.partitions {
+				continue
+			}
+			perm := rng.Perm(n)
+			split := 1 + rng.Intn(n-1)
+			c.partition(perm[:split], perm[split:])
+		case 1:
+			c.heal()
+		case 2:
+			if !faults.crashes {
+				continue
+			}
+			// Restart a crashed server, or crash another while a
+			// majority would still be up.
+			i := rng.Intn(n)
+			if crashed[i] {
+				c.start(i)
+				delete(crashed, i)
+			} else if len(crashed) < (n-1)/2 {
+				c.crash(i)
+				crashed[i] = true
+			}
+		}
+	}
+
+	c.heal()
+	c.net.SetReliable(true)
+	for i := range crashed {
+		c.start(i)
+	}
+	close(stop)
+	wg.Wait()
+
+	h.mu.Lock()
+	ops := h.ops
+	h.mu.Unlock()
+	if len(ops) == 0 {
+		t.Fatalf("no operations completed")
+	}
+
+	switch result := linearizability.CheckTimeout(kvModel, ops, 30*time.Second); result {
+	case linearizability.Illegal:
+		t.Fatalf("history of %d operations is not linearizable", len(ops))
+	case linearizability.Unknown:
+		t.Logf("linearizability check of %d operations timed out", len(ops))
+	default:
+		t.Logf("%d operations are linearizable", len(ops))
+	}
+}
+
+func TestLinearizableUnderPartitions(t *testing.T) {
+	runJepsen(t, 5, 5, 0, nemesis{partitions: true}, 5*time.Second)
+}
+
+func TestLinearizableUnderCrashes(t *testing.T) {
+	runJepsen(t, 5, 5, 20, nemesis{crashes: true}, 5*time.Second)
+}
+
+func TestLinearizableUnderAllFaults(t *testing.T) {
+	runJepsen(t, 5, 5, 20, nemesis{crashes: true, partitions: true, unreliable: true}, 5*time.Second)
+}
@@ -0,0 +1,174 @@
+package kvraft
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The service's messages and log commands also have a protobuf encoding,
+// described by kv.proto, for transports such as protorpc that do not carry
+// Go values. As in proto3, zero values are omitted.
+
+// OpCodec encodes the Ops the service writes to the Raft log as the Op
+// message of kv.proto. It is a protorpc.CommandCodec.
+type OpCodec struct{}
+
+func (OpCodec) MarshalCommand(command interface{}) ([]byte, error) {
+	op, ok := command.(Op)
+	if !ok {
+		return nil, fmt.Errorf("kvraft: command is %T, not an Op", command)
+	}
+	var b []byte
+	b = appendString(b, 1, string(op.Type))
+	b = appendString(b, 2, op.Key)
+	b = appendString(b, 3, op.Value)
+	b = appendInt(b, 4, op.ClientId)
+	b = appendInt(b, 5, op.Seq)
+	return b, nil
+}
+
+func (OpCodec) UnmarshalCommand(b []byte) (interface{}, error) {
+	var op Op
+	err := fields(b, func(num protowire.Number, v uint64, data []byte) {
+		switch num {
+		case 1:
+			op.Type = OpType(data)
+		case 2:
+			op.Key = string(data)
+		case 3:
+			op.Value = string(data)
+		case 4:
+			op.ClientId = int64(v)
+		case 5:
+			op.Seq = int64(v)
+		}
+	})
+	return op, err
+}
+
+func (args *GetArgs) MarshalProto() ([]byte, error) {
+	return appendString(nil, 1, args.Key), nil
+}
+
+func (args *GetArgs) UnmarshalProto(b []byte) error {
+	return fields(b, func(num protowire.Number, v uint64, data []byte) {
+		if num == 1 {
+			args.Key = string(data)
+		}
+	})
+}
+
+func (reply *GetReply) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, string(reply.Err))
+	b = appendString(b, 2, reply.Value)
+	b = appendInt(b, 3, int64(reply.LeaderHint))
+	return b, nil
+}
+
+func (reply *GetReply) UnmarshalProto(b []byte) error {
+	return fields(b, func(num protowire.Number, v uint64, data []byte) {
+		switch num {
+		case 1:
+			reply.Err = Err(data)
+		case 2:
+			reply.Value = string(data)
+		case 3:
+			reply.LeaderHint = int(int64(v))
+		}
+	})
+}
+
+func (args *PutAppendArgs) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, args.Key)
+	b = appendString(b, 2, args.Value)
+	b = appendString(b, 3, string(args.Op))
+	b = appendInt(b, 4, args.ClientId)
+	b = appendInt(b, 5, args.Seq)
+	return b, nil
+}
+
+func (args *PutAppendArgs) UnmarshalProto(b []byte) error {
+	return fields(b, func(num protowire.Number, v uint64, data []byte) {
+		switch num {
+		case 1:
+			args.Key = string(data)
+		case 2:
+			args.Value = string(data)
+		case 3:
+			args.Op = OpType(data)
+		case 4:
+			args.ClientId = int64(v)
+		case 5:
+			args.Seq = int64(v)
+		}
+	})
+}
+
+func (reply *PutAppendReply) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, string(reply.Err))
+	b = appendInt(b, 2, int64(reply.LeaderHint))
+	return b, nil
+}
+
+func (reply *PutAppendReply) UnmarshalProto(b []byte) error {
+	return fields(b, func(num protowire.Number, v uint64, data []byte) {
+		switch num {
+		case 1:
+			reply.Err = Err(data)
+		case 2:
+			reply.LeaderHint = int(int64(v))
+		}
+	})
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendInt encodes v as a proto int64.
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// fields calls fn for each field in b with its varint value or, for
+// length-delimited fields, its contents. Other wire types are skipped.
+func fields(b []byte, fn func(num protowire.Number, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			fn(num, v, data)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package kvraft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	messages := []interface {
+		MarshalProto() ([]byte, error)
+		UnmarshalProto([]byte) error
+	}{
+		&GetArgs{Key: "x"},
+		&GetReply{Err: ErrWrongLeader, LeaderHint: -1},
+		&GetReply{Err: OK, Value: "1", LeaderHint: 2},
+		&PutAppendArgs{Key: "x", Value: "2", Op: OpAppend, ClientId: -5, Seq: 9},
+		&PutAppendReply{Err: ErrTimeout, LeaderHint: 1},
+	}
+
+	for _, msg := range messages {
+		b, err := msg.MarshalProto()
+		if err != nil {
+			t.Fatalf("marshal %T: %v", msg, err)
+		}
+		got := reflect.New(reflect.TypeOf(msg).Elem()).Interface().(interface{ UnmarshalProto([]byte) error })
+		if err := got.UnmarshalProto(b); err != nil {
+			t.Fatalf("unmarshal %T: %v", msg, err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("round trip of %T:\n got %+v\nwant %+v", msg, got, msg)
+		}
+	}
+}
+
+func TestOpCodec(t *testing.T) {
+	for _, op := range []Op{
+		{Type: OpPut, Key: "k", Value: "v", ClientId: 7, Seq: 1},
+		{Type: OpAppend, Key: "k", ClientId: -7, Seq: 2},
+		{},
+	} {
+		b, err := OpCodec{}.MarshalCommand(op)
+		if err != nil {
+			t.Fatalf("marshal %+v: %v", op, err)
+		}
+		got, err := OpCodec{}.UnmarshalCommand(b)
+		if err != nil {
+			t.Fatalf("unmarshal %+v: %v", op, err)
+		}
+		if got != op {
+			t.Errorf("round trip of %+v gave %+v", op, got)
+		}
+	}
+
+	// Commands that are not Ops are refused rather than guessed at.
+	if _, err := (OpCodec{}).MarshalCommand("put k v"); err == nil {
+		t.Errorf("marshal of a string command succeeded")
+	}
+}
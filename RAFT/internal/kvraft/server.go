@@ -0,0 +1,252 @@
+package kvraft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// applyTimeout bounds how long a handler waits for its operation to commit
+// before telling the client to retry elsewhere.
+const applyTimeout = 1 * time.Second
+
+type KVServer struct {
+	mu sync.Mutex
+	id int
+	rf *raft.Raft
+
+	data map[string]string
+	// lastSeq is the highest sequence number applied per client; anything
+	// at or below it is a duplicate.
+	lastSeq     map[int64]int64
+	lastApplied int
+	applied     *sync.Cond
+	stopped     bool
+	waiters     map[int]chan Op
+
+	// snapshotEvery asks Raft to compact its log after that many applied
+	// entries; zero disables snapshots.
+	snapshotEvery int
+	snapshotIndex int
+}
+
+// snapshotState is what a KVServer snapshot contains.
+type snapshotState struct {
+	Data    map[string]string
+	LastSeq map[int64]int64
+}
+
+// StartKVServer creates the Raft node backing this server and starts
+// applying committed operations. The caller exposes the returned server
+// (as "KVServer") and its Raft node (as "Raft") through the same transport.
+func StartKVServer(id int, peers []string, transport raft.Transport, persister storage.Persister, snapshotEvery int) (*KVServer, error) {
+	applyCh := make(chan raft.ApplyMsg)
+	rf, err := raft.NewRaft(id, peers, transport, applyCh, persister)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := &KVServer{
+		id:            id,
+		rf:            rf,
+		data:          make(map[string]string),
+		lastSeq:       make(map[int64]int64),
+		waiters:       make(map[int]chan Op),
+		snapshotEvery: snapshotEvery,
+	}
+	kv.applied = sync.NewCond(&kv.mu)
+
+	go kv.applier(applyCh)
+	rf.Start()
+
+	return kv, nil
+}
+
+// Stop stops the Raft node, which ends the apply loop, and fails any reads
+// still waiting to be applied.
+func (kv *KVServer) Stop() {
+	kv.rf.Stop()
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.stopped = true
+	kv.applied.Broadcast()
+}
+
+// Raft returns the node backing this server.
+func (kv *KVServer) Raft() *raft.Raft {
+	return kv.rf
+}
+
+// Get serves reads through Raft's ReadIndex instead of the log, so reads do
+// not grow the log or wait for a commit round of their own.
+func (kv *KVServer) Get(args *GetArgs, reply *GetReply) error {
+	index, err := kv.rf.ReadIndex()
+	if err != nil {
+		reply.Err = ErrWrongLeader
+		reply.LeaderHint = kv.rf.Leader()
+		return nil
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	for kv.lastApplied < index && !kv.stopped {
+		kv.applied.Wait()
+	}
+	if kv.stopped {
+		reply.Err = ErrWrongLeader
+		reply.LeaderHint = -1
+		return nil
+	}
+
+	value, ok := kv.data[args.Key]
+	reply.Err = OK
+	if !ok {
+		reply.Err = ErrNoKey
+	}
+	reply.Value = value
+	reply.LeaderHint = kv.id
+	return nil
+}
+
+func (kv *KVServer) PutAppend(args *PutAppendArgs, reply *PutAppendReply) error {
+	op := Op{Type: args.Op, Key: args.Key, Value: args.Value, ClientId: args.ClientId, Seq: args.Seq}
+	reply.Err, reply.LeaderHint = kv.propose(op)
+	return nil
+}
+
+// propose submits op and waits until it is applied. If a different op shows
+// up at its index, leadership was lost and the client must retry.
+func (kv *KVServer) propose(op Op) (Err, int) {
+	index, _, isLeader := kv.rf.Submit(op)
+	if !isLeader {
+		return ErrWrongLeader, kv.rf.Leader()
+	}
+
+	kv.mu.Lock()
+	ch := make(chan Op, 1)
+	kv.waiters[index] = ch
+	kv.mu.Unlock()
+
+	defer func() {
+		kv.mu.Lock()
+		if kv.waiters[index] == ch {
+			delete(kv.waiters, index)
+		}
+		kv.mu.Unlock()
+	}()
+
+	select {
+	case applied := <-ch:
+		if applied.ClientId != op.ClientId || applied.Seq != op.Seq {
+			return ErrWrongLeader, kv.rf.Leader()
+		}
+		return OK, kv.id
+	case <-time.After(applyTimeout):
+		return ErrTimeout, kv.rf.Leader()
+	}
+}
+
+func (kv *KVServer) applier(applyCh <-chan raft.ApplyMsg) {
+	for msg := range applyCh {
+		if msg.SnapshotValid {
+			if err := kv.restoreSnapshot(msg.Index, msg.Snapshot); err != nil {
+				log.Printf("[KV %d] Failed to restore snapshot at index %d: %v", kv.id, msg.Index, err)
+			}
+			continue
+		}
+
+		kv.mu.Lock()
+		if msg.Index <= kv.lastApplied {
+			kv.mu.Unlock()
+			continue
+		}
+		// Reads wait on lastApplied, so it moves past every index, even one
+		// this service cannot apply.
+		kv.lastApplied = msg.Index
+		kv.applied.Broadcast()
+
+		op, ok := msg.Command.(Op)
+		if !ok {
+			log.Printf("[KV %d] Ignoring unknown command %T at index %d", kv.id, msg.Command, msg.Index)
+		} else if op.Seq > kv.lastSeq[op.ClientId] {
+			switch op.Type {
+			case OpPut:
+				kv.data[op.Key] = op.Value
+			case OpAppend:
+				kv.data[op.Key] += op.Value
+			}
+			kv.lastSeq[op.ClientId] = op.Seq
+		}
+
+		// A waiter handed an unknown command sees a zero Op, which is not
+		// its own, and retries.
+		if ch, ok := kv.waiters[msg.Index]; ok {
+			ch <- op
+			delete(kv.waiters, msg.Index)
+		}
+
+		var snapshot []byte
+		if kv.snapshotEvery > 0 && msg.Index-kv.snapshotIndex >= kv.snapshotEvery {
+			var err error
+			if snapshot, err = kv.encodeSnapshot(); err != nil {
+				log.Printf("[KV %d] Failed to encode snapshot at index %d: %v", kv.id, msg.Index, err)
+			} else {
+				kv.snapshotIndex = msg.Index
+			}
+		}
+		kv.mu.Unlock()
+
+		if snapshot != nil {
+			if err := kv.rf.Snapshot(msg.Index, snapshot); err != nil {
+				log.Printf("[KV %d] Failed to snapshot at index %d: %v", kv.id, msg.Index, err)
+			}
+		}
+	}
+}
+
+// encodeSnapshot must be called with kv.mu held.
+func (kv *KVServer) encodeSnapshot() ([]byte, error) {
+	var buf bytes.Buffer
+	state := snapshotState{Data: kv.data, LastSeq: kv.lastSeq}
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// restoreSnapshot replaces the state with snapshot unless this server has
+// already applied past index. A snapshot that cannot be decoded leaves the
+// state as it was.
+func (kv *KVServer) restoreSnapshot(index int, snapshot []byte) error {
+	var state snapshotState
+	if err := gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&state); err != nil {
+		return err
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if index <= kv.lastApplied {
+		return nil
+	}
+	kv.data = state.Data
+	kv.lastSeq = state.LastSeq
+	if kv.data == nil {
+		kv.data = make(map[string]string)
+	}
+	if kv.lastSeq == nil {
+		kv.lastSeq = make(map[int64]int64)
+	}
+	kv.lastApplied = index
+	kv.snapshotIndex = index
+	kv.applied.Broadcast()
+	return nil
+}
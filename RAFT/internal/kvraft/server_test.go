@@ -0,0 +1,202 @@
+package kvraft
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBasicOperations(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	ck := c.makeClerk()
+
+	check(t, ck, "missing", "")
+
+	ck.Put("a", "1")
+	check(t, ck, "a", "1")
+
+	ck.Append("a", "2")
+	ck.Append("a", "3")
+	check(t, ck, "a", "123")
+
+	ck.Put("a", "x")
+	check(t, ck, "a", "x")
+}
+
+func TestGetsDoNotGrowLog(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	ck := c.makeClerk()
+
+	ck.Put("k", "v")
+	before := c.raftStateSize()
+	for i := 0; i < 100; i++ {
+		check(t, ck, "k", "v")
+	}
+
+	// Allow for a term change, but not for 100 new entries.
+	if after := c.raftStateSize(); after > before+16 {
+		t.Fatalf("raft state grew from %d to %d bytes serving reads", before, after)
+	}
+}
+
+// appendClients runs n clerks that each append "<client>.<i>;" to their own
+// key until stop is closed, and returns how many appends each completed.
+func appendClients(c *cluster, n int, stop chan struct{}) func() []int {
+	var wg sync.WaitGroup
+	counts := make([]int, n)
+	for cli := 0; cli < n; cli++ {
+		ck := c.makeClerk()
+		wg.Add(1)
+		go func(cli int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", cli)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ck.Append(key, fmt.Sprintf("%d.%d;", cli, i))
+				counts[cli] = i + 1
+			}
+		}(cli)
+	}
+	return func() []int {
+		close(stop)
+		wg.Wait()
+		return counts
+	}
+}
+
+// checkAppends verifies every client's appends appear exactly once and in
+// order.
+func checkAppends(t *testing.T, ck *Clerk, counts []int) {
+	t.Helper()
+	for cli, count := range counts {
+		value := ck.Get(fmt.Sprintf("key-%d", cli))
+		parts := strings.Split(strings.TrimSuffix(value, ";"), ";")
+		if count == 0 {
+			continue
+		}
+		if len(parts) != count {
+			t.Fatalf("client %d made %d appends but key holds %d: %q", cli, count, len(parts), value)
+		}
+		for i, part := range parts {
+			if want := fmt.Sprintf("%d.%d", cli, i); part != want {
+				t.Fatalf("client %d append %d is %q, want %q", cli, i, part, want)
+			}
+		}
+	}
+}
+
+func TestConcurrentClientsWithPartitions(t *testing.T) {
+	c := newCluster(t, 5, 0)
+
+	finish := appendClients(c, 5, make(chan struct{}))
+	for round := 0; round < 3; round++ {
+		time.Sleep(500 * time.Millisecond)
+		perm := rand.Perm(5)
+		c.partition(perm[:3], perm[3:])
+		time.Sleep(1 * time.Second)
+		c.heal()
+	}
+	counts := finish()
+
+	checkAppends(t, c.makeClerk(), counts)
+}
+
+func TestUnreliableAppendsApplyOnce(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	c.net.SetReliable(false)
+
+	finish := appendClients(c, 3, make(chan struct{}))
+	time.Sleep(3 * time.Second)
+	counts := finish()
+
+	c.net.SetReliable(true)
+	checkAppends(t, c.makeClerk(), counts)
+}
+
+// TestUnknownCommandDoesNotBlockReads puts an entry the service cannot
+// apply at the end of the log; reads must still get past its index.
+func TestUnknownCommandDoesNotBlockReads(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	ck := c.makeClerk()
+
+	ck.Put("a", "1")
+	submitted := false
+	for !submitted {
+		for _, kv := range c.servers {
+			if _, _, isLeader := kv.Raft().Submit("not an op"); isLeader {
+				submitted = true
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan string, 1)
+	go func() { done <- ck.Get("a") }()
+	select {
+	case got := <-done:
+		if got != "1" {
+			t.Fatalf("Get(a) = %q, want %q", got, "1")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Get waited on an entry the service cannot apply")
+	}
+}
+
+func TestRestartsWithSnapshots(t *testing.T) {
+	c := newCluster(t, 3, 10)
+	ck := c.makeClerk()
+
+	for i := 0; i < 200; i++ {
+		ck.Append("k", fmt.Sprintf("%d;", i))
+	}
+
+	for i := 0; i < 3; i++ {
+		c.crash(i)
+	}
+	for i := 0; i < 3; i++ {
+		c.start(i)
+	}
+
+	var want strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&want, "%d;", i)
+	}
+	check(t, ck, "k", want.String())
+
+	// Without snapshots the 200 entries take up over 15KB.
+	if size := c.raftStateSize(); size > 5000 {
+		t.Fatalf("raft state is %d bytes; log was not compacted", size)
+	}
+}
+
+// TestRestartRemembersDuplicates makes sure the duplicate table survives a
+// snapshot and restart: a retried append from before the crash must not
+// be applied again.
+func TestRestartRemembersDuplicates(t *testing.T) {
+	c := newCluster(t, 3, 5)
+	ck := c.makeClerk()
+
+	for i := 0; i < 10; i++ {
+		ck.Append("k", "x")
+	}
+
+	for i := 0; i < 3; i++ {
+		c.crash(i)
+	}
+	for i := 0; i < 3; i++ {
+		c.start(i)
+	}
+
+	// Resend the last append as if its reply had been lost.
+	ck.seq--
+	ck.Append("k", "x")
+	check(t, ck, "k", strings.Repeat("x", 10))
+}
@@ -0,0 +1,349 @@
+// Package labrpc is an in-process stand-in for net/rpc, in the spirit of the
+// MIT 6.824 labrpc package. Servers and clients live in one process and talk
+// through a Network that can drop, delay, reorder and partition messages, so
+// tests can exercise faults quickly without real sockets.
+//
+// Arguments and replies are gob-encoded on the way through, exactly as they
+// would be over the wire, so a handler never shares memory with its caller.
+// Fault decisions come from a seeded random source; together with a fixed
+// seed this makes a failing schedule of drops and delays reproducible,
+// although goroutine scheduling still varies from run to run.
+package labrpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Network struct {
+	mu sync.Mutex
+	// rng is only used with mu held.
+	rng     *rand.Rand
+	servers map[string]*server
+	// disconnected addresses can neither send nor receive.
+	disconnected map[string]bool
+	// groups maps addresses to partition groups while a partition is in
+	// effect; nil means everyone can reach everyone.
+	groups map[string]int
+
+	reliable       bool
+	longDelays     bool
+	longReordering bool
+	count          int
+}
+
+// End is one client's connection to the network. Its Call method has the
+// same shape as rpc.Call, so it can be passed straight to raft.NewRaft.
+type End struct {
+	net    *Network
+	from   string
+	mu     sync.Mutex
+	closed bool
+}
+
+type server struct {
+	services map[string]*service
+}
+
+type service struct {
+	rcvr    reflect.Value
+	methods map[string]reflect.Method
+}
+
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		rng:          rand.New(rand.NewSource(seed)),
+		servers:      make(map[string]*server),
+		disconnected: make(map[string]bool),
+		reliable:     true,
+	}
+}
+
+// AddService registers rcvr's exported methods of the form
+// func(args *T, reply *R) error under name at address, like
+// rpc.Server.RegisterName. An address can host several services.
+func (n *Network) AddService(address string, name string, rcvr interface{}) error {
+	svc, err := newService(rcvr)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	srv, ok := n.servers[address]
+	if !ok {
+		srv = &server{services: make(map[string]*service)}
+		n.servers[address] = srv
+	}
+	srv.services[name] = svc
+	return nil
+}
+
+// DeleteServer removes every service at address, as if the process had
+// crashed. Calls that are already executing on it have their replies lost.
+func (n *Network) DeleteServer(address string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.servers, address)
+}
+
+// MakeEnd returns an End that sends from address. Closing it cuts off that
+// client for good, which is how a crashed node's goroutines are silenced
+// even after its address comes back with a new instance.
+func (n *Network) MakeEnd(from string) *End {
+	return &End{net: n, from: from}
+}
+
+func (n *Network) Connect(address string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.disconnected, address)
+}
+
+func (n *Network) Disconnect(address string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.disconnected[address] = true
+}
+
+// Partition splits the network so that only addresses in the same group can
+// reach each other. Addresses not listed in any group are isolated.
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, address := range group {
+			n.groups[address] = i
+		}
+	}
+}
+
+// Heal removes any partition. Disconnected addresses stay disconnected.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = nil
+}
+
+// SetReliable turns random request and reply loss and short delays off or on.
+func (n *Network) SetReliable(reliable bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.reliable = reliable
+}
+
+// SetLongDelays makes calls to unreachable servers take up to a second to
+// fail instead of up to 100ms.
+func (n *Network) SetLongDelays(longDelays bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.longDelays = longDelays
+}
+
+// SetLongReordering holds back most replies for a random while, so replies
+// arrive long after, and in a different order than, their requests.
+func (n *Network) SetLongReordering(longReordering bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.longReordering = longReordering
+}
+
+// RPCCount returns the number of calls attempted so far.
+func (n *Network) RPCCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.count
+}
+
+// Close permanently disables the End.
+func (e *End) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+}
+
+func (e *End) isClosed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.closed
+}
+
+// Call invokes "Service.Method" on the server at address and reports whether
+// a reply came back. As with a real network, false means the request or its
+// reply was lost, not necessarily that the handler did not run.
+func (e *End) Call(address string, method string, args interface{}, reply interface{}) bool {
+	n := e.net
+
+	n.mu.Lock()
+	n.count++
+	reliable := n.reliable
+	longReordering := n.longReordering
+	reachable := !e.isClosed() && n.canTalk(e.from, address)
+	srv := n.servers[address]
+	n.mu.Unlock()
+
+	if !reachable || srv == nil {
+		n.sleepFailure()
+		return false
+	}
+
+	if !reliable {
+		n.sleep(27 * time.Millisecond)
+		if n.chance(100) {
+			return false
+		}
+	}
+
+	svcName, methodName, ok := strings.Cut(method, ".")
+	if !ok {
+		return false
+	}
+	svc := srv.services[svcName]
+	if svc == nil {
+		return false
+	}
+
+	var argBuf bytes.Buffer
+	if err := gob.NewEncoder(&argBuf).Encode(args); err != nil {
+		panic(fmt.Sprintf("labrpc: cannot encode args for %s: %v", method, err))
+	}
+
+	replyBytes, ok := svc.dispatch(methodName, argBuf.Bytes())
+	if !ok {
+		return false
+	}
+
+	// The server may have crashed or been cut off while the handler ran.
+	n.mu.Lock()
+	reachable = !e.isClosed() && n.canTalk(e.from, address) && n.servers[address] == srv
+	n.mu.Unlock()
+	if !reachable {
+		return false
+	}
+
+	if !reliable && n.chance(100) {
+		return false
+	}
+
+	if longReordering && n.chance(600) {
+		n.sleep(200*time.Millisecond + n.duration(1000*time.Millisecond))
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(replyBytes)).Decode(reply); err != nil {
+		panic(fmt.Sprintf("labrpc: cannot decode reply for %s: %v", method, err))
+	}
+	return true
+}
+
+// canTalk must be called with n.mu held.
+func (n *Network) canTalk(from string, to string) bool {
+	if n.disconnected[from] || n.disconnected[to] {
+		return false
+	}
+	if n.groups == nil {
+		return true
+	}
+	fromGroup, ok1 := n.groups[from]
+	toGroup, ok2 := n.groups[to]
+	return ok1 && ok2 && fromGroup == toGroup
+}
+
+// chance returns true with probability perMille/1000.
+func (n *Network) chance(perMille int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.rng.Intn(1000) < perMille
+}
+
+func (n *Network) duration(limit time.Duration) time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return time.Duration(n.rng.Int63n(int64(limit)))
+}
+
+func (n *Network) sleep(limit time.Duration) {
+	time.Sleep(n.duration(limit))
+}
+
+// sleepFailure simulates waiting for a reply that never comes.
+func (n *Network) sleepFailure() {
+	n.mu.Lock()
+	limit := 100 * time.Millisecond
+	if n.longDelays {
+		limit = 1000 * time.Millisecond
+	}
+	n.mu.Unlock()
+
+	n.sleep(limit)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func newService(rcvr interface{}) (*service, error) {
+	svc := &service{
+		rcvr:    reflect.ValueOf(rcvr),
+		methods: make(map[string]reflect.Method),
+	}
+
+	typ := reflect.TypeOf(rcvr)
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		mtype := method.Type
+		if mtype.NumIn() != 3 || mtype.NumOut() != 1 ||
+			mtype.In(1).Kind() != reflect.Ptr || mtype.In(2).Kind() != reflect.Ptr ||
+			mtype.Out(0) != errorType {
+			continue
+		}
+		svc.methods[method.Name] = method
+	}
+
+	if len(svc.methods) == 0 {
+		return nil, fmt.Errorf("labrpc: %T has no suitable methods", rcvr)
+	}
+	return svc, nil
+}
+
+func (svc *service) dispatch(name string, argBytes []byte) ([]byte, bool) {
+	method, ok := svc.methods[name]
+	if !ok {
+		return nil, false
+	}
+
+	args := reflect.New(method.Type.In(1).Elem())
+	if err := gob.NewDecoder(bytes.NewReader(argBytes)).Decode(args.Interface()); err != nil {
+		panic(fmt.Sprintf("labrpc: cannot decode args for %s: %v", name, err))
+	}
+	reply := reflect.New(method.Type.In(2).Elem())
+
+	out := method.Func.Call([]reflect.Value{svc.rcvr, args, reply})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return nil, false
+	}
+
+	var replyBuf bytes.Buffer
+	if err := gob.NewEncoder(&replyBuf).Encode(reply.Interface()); err != nil {
+		panic(fmt.Sprintf("labrpc: cannot encode reply for %s: %v", name, err))
+	}
+	return replyBuf.Bytes(), true
+}
@@ -0,0 +1,140 @@
+package labrpc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type EchoArgs struct {
+	Value string
+}
+
+type EchoReply struct {
+	Value string
+}
+
+type echo struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *echo) Echo(args *EchoArgs, reply *EchoReply) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls++
+	reply.Value = args.Value
+	return nil
+}
+
+func (e *echo) Fail(args *EchoArgs, reply *EchoReply) error {
+	return errors.New("always fails")
+}
+
+func newEchoNetwork(t *testing.T, addresses ...string) (*Network, *echo) {
+	net := NewNetwork(1)
+	svc := &echo{}
+	for _, address := range addresses {
+		if err := net.AddService(address, "Echo", svc); err != nil {
+			t.Fatalf("failed to add service: %v", err)
+		}
+	}
+	return net, svc
+}
+
+func TestCallCopiesArgsAndReply(t *testing.T) {
+	net, _ := newEchoNetwork(t, "server")
+	end := net.MakeEnd("client")
+
+	args := EchoArgs{Value: "hello"}
+	var reply EchoReply
+	if !end.Call("server", "Echo.Echo", &args, &reply) {
+		t.Fatalf("call failed on a reliable network")
+	}
+	if reply.Value != "hello" {
+		t.Errorf("expected reply %q, got %q", "hello", reply.Value)
+	}
+
+	if end.Call("server", "Echo.Fail", &args, &reply) {
+		t.Errorf("expected a handler error to fail the call")
+	}
+	if end.Call("server", "Echo.Missing", &args, &reply) {
+		t.Errorf("expected an unknown method to fail the call")
+	}
+	if end.Call("nowhere", "Echo.Echo", &args, &reply) {
+		t.Errorf("expected a call to an unknown address to fail")
+	}
+	if got := net.RPCCount(); got != 4 {
+		t.Errorf("expected 4 RPCs to be counted, got %d", got)
+	}
+}
+
+func TestDisconnectAndClose(t *testing.T) {
+	net, _ := newEchoNetwork(t, "server")
+	end := net.MakeEnd("client")
+	var reply EchoReply
+
+	net.Disconnect("server")
+	if end.Call("server", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call reached a disconnected server")
+	}
+	net.Connect("server")
+	if !end.Call("server", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call failed after reconnecting")
+	}
+
+	end.Close()
+	if end.Call("server", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call succeeded from a closed end")
+	}
+
+	net.DeleteServer("server")
+	if net.MakeEnd("other").Call("server", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call reached a deleted server")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	net, _ := newEchoNetwork(t, "a", "b", "c")
+	var reply EchoReply
+
+	net.Partition([]string{"a", "b"}, []string{"c"})
+	if !net.MakeEnd("a").Call("b", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call failed within a partition")
+	}
+	if net.MakeEnd("a").Call("c", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call crossed the partition")
+	}
+	if net.MakeEnd("d").Call("a", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("unlisted address was not isolated")
+	}
+
+	net.Heal()
+	if !net.MakeEnd("a").Call("c", "Echo.Echo", &EchoArgs{}, &reply) {
+		t.Errorf("call failed after healing the partition")
+	}
+}
+
+func TestUnreliableDropsSomeCalls(t *testing.T) {
+	net, svc := newEchoNetwork(t, "server")
+	net.SetReliable(false)
+	end := net.MakeEnd("client")
+
+	ok := 0
+	for i := 0; i < 100; i++ {
+		var reply EchoReply
+		if end.Call("server", "Echo.Echo", &EchoArgs{Value: "x"}, &reply) {
+			ok++
+		}
+	}
+
+	if ok == 0 || ok == 100 {
+		t.Errorf("expected some but not all calls to succeed, got %d of 100", ok)
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.calls < ok {
+		t.Errorf("handler ran %d times but %d calls succeeded", svc.calls, ok)
+	}
+}
@@ -0,0 +1,77 @@
+// Package leaktest checks that a test leaves no goroutines running.
+package leaktest
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// grace is how long goroutines get to wind down after a test, for example
+// to finish an RPC that a stopped node has abandoned.
+var grace = 5 * time.Second
+
+// Check records the goroutines running now and returns a function that
+// fails t if goroutines started since are still running once a grace period
+// has passed. Typical use is
+//
+//	defer leaktest.Check(t)()
+//
+// or registering the returned function with t.Cleanup before any other
+// cleanup that stops what the test started, since cleanups run last-in
+// first-out.
+func Check(t testing.TB) func() {
+	before := goroutines()
+	return func() {
+		t.Helper()
+
+		var leaked []string
+		deadline := time.Now().Add(grace)
+		for time.Now().Before(deadline) {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		sort.Strings(leaked)
+		t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// goroutines returns the stacks of running goroutines by their header line
+// ("goroutine 7 [running]:" without the state), ignoring the test
+// framework's own.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		header, _, _ := strings.Cut(stack, " [")
+		if strings.Contains(stack, "testing.tRunner") ||
+			strings.Contains(stack, "testing.(*T).Run") ||
+			strings.Contains(stack, "testing.runTests") ||
+			strings.Contains(stack, "leaktest.goroutines") ||
+			strings.Contains(stack, "os/signal.signal_recv") {
+			continue
+		}
+		stacks[header] = stack
+	}
+	return stacks
+}
@@ -0,0 +1,42 @@
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+func TestCheck(t *testing.T) {
+	grace = 200 * time.Millisecond
+	defer func() { grace = 5 * time.Second }()
+
+	rec := &recorder{TB: t}
+	check := Check(rec)
+	done := make(chan struct{})
+	go func() {
+		<-done
+	}()
+	check()
+	if !rec.failed {
+		t.Errorf("blocked goroutine was not reported")
+	}
+
+	rec = &recorder{TB: t}
+	check = Check(rec)
+	close(done)
+	go time.Sleep(50 * time.Millisecond)
+	check()
+	if rec.failed {
+		t.Errorf("goroutines that finished within the grace period were reported")
+	}
+}
@@ -0,0 +1,40 @@
+package linearizability
+
+import "math/bits"
+
+// bitset records which operations have been linearized.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) clear(i int) {
+	b[i/64] &^= 1 << (i % 64)
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset(nil), b...)
+}
+
+func (b bitset) equals(other bitset) bool {
+	for i := range b {
+		if b[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) hash() uint64 {
+	h := uint64(len(b))
+	for _, word := range b {
+		h = bits.RotateLeft64(h, 7) ^ word
+		h *= 0x9e3779b97f4a7c15
+	}
+	return h
+}
@@ -0,0 +1,234 @@
+package linearizability
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result is the outcome of a check.
+type Result int
+
+const (
+	// Ok means the history is linearizable.
+	Ok Result = iota
+	// Illegal means no linearization exists.
+	Illegal
+	// Unknown means the check ran out of time.
+	Unknown
+)
+
+func (r Result) String() string {
+	switch r {
+	case Ok:
+		return "Ok"
+	case Illegal:
+		return "Illegal"
+	}
+	return "Unknown"
+}
+
+// Check reports whether history is linearizable with respect to model. The
+// search is exponential in the worst case; see CheckTimeout.
+func Check(model Model, history []Operation) bool {
+	return CheckTimeout(model, history, 0) == Ok
+}
+
+// CheckTimeout is Check with a time limit, after which it gives up and
+// returns Unknown. A timeout of zero means no limit. Partitions are checked
+// in parallel, and the first illegal one stops the rest.
+func CheckTimeout(model Model, history []Operation, timeout time.Duration) Result {
+	parts := model.partition(history)
+
+	var kill atomic.Bool
+	results := make(chan bool, len(parts))
+	var wg sync.WaitGroup
+	for _, part := range parts {
+		wg.Add(1)
+		go func(part []Operation) {
+			defer wg.Done()
+			ok := checkPart(model, part, &kill)
+			if !ok {
+				kill.Store(true)
+			}
+			results <- ok
+		}(part)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timedOut := false
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			timedOut = true
+			kill.Store(true)
+			<-done
+		}
+	} else {
+		<-done
+	}
+	close(results)
+
+	// A part that was killed returns true without having finished, so a
+	// single false is only trusted as a genuine violation.
+	for ok := range results {
+		if !ok {
+			return Illegal
+		}
+	}
+	if timedOut {
+		return Unknown
+	}
+	return Ok
+}
+
+// entry is a call or return event in the doubly linked list the search
+// walks. A call's match is its return; a return has no match.
+type entry struct {
+	id    int
+	value interface{}
+	match *entry
+	prev  *entry
+	next  *entry
+}
+
+// makeEntries builds the event list for history, ordered by time. When a
+// call and a return share a timestamp the call comes first, treating the
+// two operations as concurrent.
+func makeEntries(history []Operation) *entry {
+	type event struct {
+		id     int
+		time   int64
+		isCall bool
+	}
+	events := make([]event, 0, 2*len(history))
+	for i, op := range history {
+		events = append(events, event{i, op.Call, true}, event{i, op.Return, false})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].isCall && !events[j].isCall
+	})
+
+	head := &entry{id: -1}
+	calls := make([]*entry, len(history))
+	prev := head
+	for _, ev := range events {
+		var e *entry
+		if ev.isCall {
+			e = &entry{id: ev.id, value: history[ev.id].Input}
+			calls[ev.id] = e
+		} else {
+			e = &entry{id: ev.id, value: history[ev.id].Output}
+			calls[ev.id].match = e
+		}
+		e.prev = prev
+		prev.next = e
+		prev = e
+	}
+	return head
+}
+
+// lift removes a call and its return from the list.
+func (e *entry) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// unlift undoes lift.
+func (e *entry) unlift() {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+type cacheEntry struct {
+	linearized bitset
+	state      interface{}
+}
+
+// checkPart searches for a linearization of one partition. It returns true
+// without finishing if kill is set.
+func checkPart(model Model, history []Operation, kill *atomic.Bool) bool {
+	head := makeEntries(history)
+	state := model.Init()
+	linearized := newBitset(len(history))
+	cache := make(map[uint64][]cacheEntry)
+
+	type frame struct {
+		call  *entry
+		state interface{}
+	}
+	var stack []frame
+
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%1024 == 0 && kill.Load() {
+			return true
+		}
+
+		if e.match == nil {
+			// We reached a return before linearizing its call: undo the
+			// most recent choice and try the next candidate instead.
+			if len(stack) == 0 {
+				return false
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			state = top.state
+			linearized.clear(top.call.id)
+			top.call.unlift()
+			e = top.call.next
+			continue
+		}
+
+		ok, next := model.Step(state, e.value, e.match.value)
+		if !ok {
+			e = e.next
+			continue
+		}
+
+		candidate := linearized.clone()
+		candidate.set(e.id)
+		hash := candidate.hash()
+		seen := false
+		for _, c := range cache[hash] {
+			if c.linearized.equals(candidate) && model.equal(c.state, next) {
+				seen = true
+				break
+			}
+		}
+		if seen {
+			e = e.next
+			continue
+		}
+
+		cache[hash] = append(cache[hash], cacheEntry{candidate, next})
+		stack = append(stack, frame{e, state})
+		state = next
+		linearized.set(e.id)
+		e.lift()
+		e = head.next
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package linearizability
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+type registerInput struct {
+	write bool
+	value int
+}
+
+// registerModel is a single integer register, initially 0.
+var registerModel = Model{
+	Init: func() interface{} { return 0 },
+	Step: func(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+		in := input.(registerInput)
+		if in.write {
+			return true, in.value
+		}
+		return output.(int) == state.(int), state
+	},
+}
+
+func write(client int, value int, call int64, ret int64) Operation {
+	return Operation{ClientId: client, Input: registerInput{write: true, value: value}, Call: call, Return: ret}
+}
+
+func read(client int, value int, call int64, ret int64) Operation {
+	return Operation{ClientId: client, Input: registerInput{}, Output: value, Call: call, Return: ret}
+}
+
+func TestRegisterHistories(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []Operation
+		ok      bool
+	}{
+		{"empty", nil, true},
+		{"read during write sees either value", []Operation{
+			write(0, 1, 0, 10),
+			read(1, 0, 2, 3),
+			read(2, 1, 4, 5),
+		}, true},
+		{"stale read after write returned", []Operation{
+			write(0, 1, 0, 5),
+			read(1, 0, 6, 10),
+		}, false},
+		{"read of a value never written", []Operation{
+			write(0, 1, 0, 5),
+			read(1, 2, 0, 10),
+		}, false},
+		{"concurrent writes seen in one order", []Operation{
+			write(0, 1, 0, 100),
+			write(1, 2, 0, 100),
+			read(2, 1, 10, 20),
+			read(2, 2, 30, 40),
+		}, true},
+		{"concurrent writes seen in both orders", []Operation{
+			write(0, 1, 0, 100),
+			write(1, 2, 0, 100),
+			read(2, 1, 10, 20),
+			read(2, 2, 30, 40),
+			read(2, 1, 50, 60),
+		}, false},
+		{"shared timestamp counts as overlap", []Operation{
+			write(0, 1, 0, 5),
+			read(1, 0, 5, 6),
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Check(registerModel, tt.history); got != tt.ok {
+				t.Errorf("Check = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+// randomHistory simulates clients on an atomic register: each operation
+// takes effect at a random instant inside its interval, and outputs are
+// computed in that order, so the history is linearizable by construction.
+func randomHistory(rng *rand.Rand, clients int, opsPerClient int) []Operation {
+	type timed struct {
+		op    Operation
+		point int64
+	}
+	var ops []timed
+	for c := 0; c < clients; c++ {
+		now := int64(rng.Intn(10))
+		for i := 0; i < opsPerClient; i++ {
+			call := now + int64(rng.Intn(5))
+			point := call + int64(rng.Intn(20))
+			ret := point + int64(rng.Intn(20))
+			now = ret + 1
+
+			op := Operation{ClientId: c, Call: call, Return: ret}
+			if rng.Intn(2) == 0 {
+				op.Input = registerInput{write: true, value: rng.Intn(5)}
+			} else {
+				op.Input = registerInput{}
+			}
+			ops = append(ops, timed{op, point})
+		}
+	}
+
+	// Linearization points may coincide; ties go in a fixed order.
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].point < ops[j].point })
+	value := 0
+	history := make([]Operation, len(ops))
+	for i, t := range ops {
+		in := t.op.Input.(registerInput)
+		if in.write {
+			value = in.value
+		} else {
+			t.op.Output = value
+		}
+		history[i] = t.op
+	}
+	rng.Shuffle(len(history), func(i, j int) { history[i], history[j] = history[j], history[i] })
+	return history
+}
+
+func TestRandomLinearizableHistories(t *testing.T) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 200; i++ {
+		history := randomHistory(rng, 1+rng.Intn(5), 1+rng.Intn(10))
+		if result := CheckTimeout(registerModel, history, 10*time.Second); result != Ok {
+			t.Fatalf("linearizable history reported %v: %+v", result, history)
+		}
+	}
+}
+
+func TestRandomCorruptedHistories(t *testing.T) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 200; i++ {
+		history := randomHistory(rng, 1+rng.Intn(5), 1+rng.Intn(10))
+
+		// No write produces a negative value, so a read of one can never
+		// be explained.
+		history = append(history, read(99, -1, 0, 1000))
+		if result := CheckTimeout(registerModel, history, 10*time.Second); result != Illegal {
+			t.Fatalf("corrupted history reported %v: %+v", result, history)
+		}
+	}
+}
+
+func TestPartitionedHistory(t *testing.T) {
+	type keyed struct {
+		key string
+		in  registerInput
+	}
+	model := Model{
+		Partition: func(history []Operation) [][]Operation {
+			byKey := make(map[string][]Operation)
+			for _, op := range history {
+				key := op.Input.(keyed).key
+				byKey[key] = append(byKey[key], op)
+			}
+			var parts [][]Operation
+			for _, part := range byKey {
+				parts = append(parts, part)
+			}
+			return parts
+		},
+		Init: registerModel.Init,
+		Step: func(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+			return registerModel.Step(state, input.(keyed).in, output)
+		},
+	}
+
+	history := []Operation{
+		{Input: keyed{"a", registerInput{write: true, value: 1}}, Call: 0, Return: 5},
+		{Input: keyed{"b", registerInput{}}, Output: 0, Call: 6, Return: 10},
+		{Input: keyed{"a", registerInput{}}, Output: 1, Call: 6, Return: 10},
+	}
+	if !Check(model, history) {
+		t.Errorf("independent keys reported not linearizable")
+	}
+
+	history = append(history, Operation{Input: keyed{"a", registerInput{}}, Output: 0, Call: 11, Return: 12})
+	if Check(model, history) {
+		t.Errorf("stale read on key a reported linearizable")
+	}
+}
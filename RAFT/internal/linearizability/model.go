@@ -0,0 +1,52 @@
+// Package linearizability checks whether a concurrent history of operations
+// on some object is linearizable: whether every operation can be given a
+// single instant between its call and its return such that, in that order,
+// the operations are a legal sequential execution of the object.
+//
+// The search follows Lowe's refinement of the Wing & Gong algorithm, as
+// used by Porcupine: operations are linearized one at a time in a depth
+// first search over a linked list of call and return events, with a cache
+// of already-explored (linearized set, state) pairs to prune repeats.
+package linearizability
+
+// Operation is one completed call in a history. Call and Return are
+// timestamps from a single clock, typically nanoseconds since the test
+// started; an operation may take effect at any instant between them.
+type Operation struct {
+	ClientId int
+	Input    interface{}
+	Call     int64
+	Output   interface{}
+	Return   int64
+}
+
+// Model describes the sequential specification of the object under test.
+type Model struct {
+	// Partition optionally splits a history into independent sub-histories
+	// that are checked separately, such as one per key of a key/value
+	// store. The whole history is linearizable iff every part is.
+	Partition func(history []Operation) [][]Operation
+	// Init returns the initial state.
+	Init func() interface{}
+	// Step applies input to state. It reports whether output is a legal
+	// result of doing so, and returns the new state. Step must not modify
+	// state in place.
+	Step func(state interface{}, input interface{}, output interface{}) (bool, interface{})
+	// Equal reports whether two states are the same. If nil, states are
+	// compared with ==.
+	Equal func(a, b interface{}) bool
+}
+
+func (m Model) equal(a, b interface{}) bool {
+	if m.Equal != nil {
+		return m.Equal(a, b)
+	}
+	return a == b
+}
+
+func (m Model) partition(history []Operation) [][]Operation {
+	if m.Partition != nil {
+		return m.Partition(history)
+	}
+	return [][]Operation{history}
+}
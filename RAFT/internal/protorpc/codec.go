@@ -0,0 +1,377 @@
+package protorpc
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+// CommandCodec converts the commands in log entries to and from the bytes
+// of LogEntry.command. Raft treats commands as opaque, so the service that
+// submits them defines their encoding; every node must use the same one.
+type CommandCodec interface {
+	MarshalCommand(command interface{}) ([]byte, error)
+	UnmarshalCommand(b []byte) (interface{}, error)
+}
+
+// StringCommands carries string commands as their UTF-8 bytes, as for the
+// lines typed into the demo.
+type StringCommands struct{}
+
+func (StringCommands) MarshalCommand(command interface{}) ([]byte, error) {
+	s, ok := command.(string)
+	if !ok {
+		return nil, fmt.Errorf("protorpc: command is %T, not a string", command)
+	}
+	return []byte(s), nil
+}
+
+func (StringCommands) UnmarshalCommand(b []byte) (interface{}, error) {
+	return string(b), nil
+}
+
+// Message is implemented by the argument and reply types of services
+// registered alongside Raft, which encode themselves as protobuf messages.
+type Message interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(b []byte) error
+}
+
+// marshal encodes one of the raft RPC argument or reply types as the
+// matching message in raft.proto, with commands encoding the commands of
+// log entries, or a Message as itself. As in proto3, zero values are
+// omitted.
+func marshal(msg interface{}, commands CommandCodec) ([]byte, error) {
+	var b []byte
+	switch m := msg.(type) {
+	case *raft.RequestVoteArgs:
+		b = appendInt(b, 1, m.Term)
+		b = appendInt(b, 2, m.CandidateId)
+		b = appendInt(b, 3, m.LastLogIndex)
+		b = appendInt(b, 4, m.LastLogTerm)
+		b = appendBool(b, 5, m.PreVote)
+		b = appendBool(b, 6, m.Transfer)
+	case *raft.RequestVoteReply:
+		b = appendInt(b, 1, m.Term)
+		b = appendBool(b, 2, m.VoteGranted)
+	case *raft.AppendEntriesArgs:
+		b = appendInt(b, 1, m.Term)
+		b = appendInt(b, 2, m.LeaderId)
+		b = appendInt(b, 3, m.PrevLogIndex)
+		b = appendInt(b, 4, m.PrevLogTerm)
+		for _, entry := range m.Entries {
+			e, err := marshalEntry(entry, commands)
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, 5, protowire.BytesType)
+			b = protowire.AppendBytes(b, e)
+		}
+		b = appendInt(b, 6, m.LeaderCommit)
+	case *raft.AppendEntriesReply:
+		b = appendInt(b, 1, m.Term)
+		b = appendBool(b, 2, m.Success)
+		b = appendInt(b, 3, m.ConflictTerm)
+		b = appendInt(b, 4, m.ConflictIndex)
+	case *raft.InstallSnapshotArgs:
+		b = appendInt(b, 1, m.Term)
+		b = appendInt(b, 2, m.LeaderId)
+		b = appendInt(b, 3, m.LastIncludedIndex)
+		b = appendInt(b, 4, m.LastIncludedTerm)
+		b = appendServers(b, 5, m.Config)
+		if len(m.Data) > 0 {
+			b = protowire.AppendTag(b, 6, protowire.BytesType)
+			b = protowire.AppendBytes(b, m.Data)
+		}
+	case *raft.InstallSnapshotReply:
+		b = appendInt(b, 1, m.Term)
+	case *raft.TimeoutNowArgs:
+		b = appendInt(b, 1, m.Term)
+		b = appendInt(b, 2, m.LeaderId)
+	case *raft.TimeoutNowReply:
+		b = appendInt(b, 1, m.Term)
+	case Message:
+		return m.MarshalProto()
+	default:
+		return nil, fmt.Errorf("protorpc: cannot marshal %T", msg)
+	}
+	return b, nil
+}
+
+// unmarshal decodes b into msg, which must be a pointer to one of the types
+// marshal accepts. Unknown fields are skipped.
+func unmarshal(b []byte, msg interface{}, commands CommandCodec) error {
+	switch m := msg.(type) {
+	case *raft.RequestVoteArgs:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.CandidateId = int(v)
+			case 3:
+				m.LastLogIndex = int(v)
+			case 4:
+				m.LastLogTerm = int(v)
+			case 5:
+				m.PreVote = v != 0
+			case 6:
+				m.Transfer = v != 0
+			}
+			return nil
+		})
+	case *raft.RequestVoteReply:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.VoteGranted = v != 0
+			}
+			return nil
+		})
+	case *raft.AppendEntriesArgs:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.LeaderId = int(v)
+			case 3:
+				m.PrevLogIndex = int(v)
+			case 4:
+				m.PrevLogTerm = int(v)
+			case 5:
+				entry, err := unmarshalEntry(data, commands)
+				if err != nil {
+					return err
+				}
+				m.Entries = append(m.Entries, entry)
+			case 6:
+				m.LeaderCommit = int(v)
+			}
+			return nil
+		})
+	case *raft.AppendEntriesReply:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.Success = v != 0
+			case 3:
+				m.ConflictTerm = int(v)
+			case 4:
+				m.ConflictIndex = int(v)
+			}
+			return nil
+		})
+	case *raft.InstallSnapshotArgs:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.LeaderId = int(v)
+			case 3:
+				m.LastIncludedIndex = int(v)
+			case 4:
+				m.LastIncludedTerm = int(v)
+			case 5:
+				server, err := unmarshalServer(data)
+				if err != nil {
+					return err
+				}
+				m.Config = append(m.Config, server)
+			case 6:
+				m.Data = append([]byte(nil), data...)
+			}
+			return nil
+		})
+	case *raft.InstallSnapshotReply:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			if num == 1 {
+				m.Term = int(v)
+			}
+			return nil
+		})
+	case *raft.TimeoutNowArgs:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				m.Term = int(v)
+			case 2:
+				m.LeaderId = int(v)
+			}
+			return nil
+		})
+	case *raft.TimeoutNowReply:
+		return fields(b, func(num protowire.Number, v uint64, data []byte) error {
+			if num == 1 {
+				m.Term = int(v)
+			}
+			return nil
+		})
+	case Message:
+		return m.UnmarshalProto(b)
+	}
+	return fmt.Errorf("protorpc: cannot unmarshal into %T", msg)
+}
+
+// errNoCommandCodec is returned for log entries carrying commands when the
+// transport or server was given no CommandCodec.
+var errNoCommandCodec = errors.New("protorpc: no command codec")
+
+func marshalEntry(entry raft.LogEntry, commands CommandCodec) ([]byte, error) {
+	var b []byte
+	b = appendInt(b, 1, entry.Term)
+	b = appendInt(b, 2, int(entry.Type))
+	if entry.Type == raft.CommandEntry {
+		if commands == nil {
+			return nil, errNoCommandCodec
+		}
+		command, err := commands.MarshalCommand(entry.Command)
+		if err != nil {
+			return nil, err
+		}
+		if len(command) > 0 {
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendBytes(b, command)
+		}
+	}
+	b = appendServers(b, 4, entry.Config)
+	return b, nil
+}
+
+func unmarshalEntry(b []byte, commands CommandCodec) (raft.LogEntry, error) {
+	var entry raft.LogEntry
+	var command []byte
+	err := fields(b, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			entry.Term = int(v)
+		case 2:
+			entry.Type = raft.EntryType(v)
+		case 3:
+			command = data
+		case 4:
+			server, err := unmarshalServer(data)
+			if err != nil {
+				return err
+			}
+			entry.Config = append(entry.Config, server)
+		}
+		return nil
+	})
+	if err != nil || entry.Type != raft.CommandEntry {
+		return entry, err
+	}
+	// An empty command is omitted like any other zero value, so decode
+	// one even when field 3 is missing.
+	if commands == nil {
+		return entry, errNoCommandCodec
+	}
+	entry.Command, err = commands.UnmarshalCommand(command)
+	return entry, err
+}
+
+func appendServers(b []byte, num protowire.Number, servers []raft.Server) []byte {
+	for _, server := range servers {
+		var s []byte
+		s = appendInt(s, 1, server.ID)
+		s = appendString(s, 2, server.Address)
+		s = appendBool(s, 3, server.Learner)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return b
+}
+
+func unmarshalServer(b []byte) (raft.Server, error) {
+	var server raft.Server
+	err := fields(b, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			server.ID = int(v)
+		case 2:
+			server.Address = string(data)
+		case 3:
+			server.Learner = v != 0
+		}
+		return nil
+	})
+	return server, err
+}
+
+// appendInt encodes v as a proto int64, so negative values such as a -1
+// ConflictTerm take ten bytes.
+func appendInt(b []byte, num protowire.Number, v int) []byte {
+	return appendInt64(b, num, int64(v))
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// fields calls fn for each field in b with its varint value or, for
+// length-delimited fields, its contents. Other wire types are skipped.
+func fields(b []byte, fn func(num protowire.Number, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case protowire.BytesType:
+			data, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			if err := fn(num, 0, data); err != nil {
+				return err
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package protorpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	config := []raft.Server{{ID: 0, Address: "a:1"}, {ID: 1, Address: "b:2"}, {ID: 2, Address: "c:3", Learner: true}}
+	messages := []interface{}{
+		&raft.RequestVoteArgs{Term: 3, CandidateId: 2, LastLogIndex: 10, LastLogTerm: 2, PreVote: true, Transfer: true},
+		&raft.RequestVoteReply{Term: 3, VoteGranted: true},
+		&raft.AppendEntriesArgs{
+			Term: 4, LeaderId: 1, PrevLogIndex: 7, PrevLogTerm: 3, LeaderCommit: 6,
+			Entries: []raft.LogEntry{
+				{Term: 4, Type: raft.NoopEntry},
+				{Term: 4, Type: raft.CommandEntry, Command: "set x"},
+				{Term: 4, Type: raft.CommandEntry, Command: ""},
+				{Term: 4, Type: raft.ConfigEntry, Config: config},
+			},
+		},
+		&raft.AppendEntriesArgs{Term: 4, LeaderId: 1},
+		&raft.AppendEntriesReply{Term: 4, ConflictTerm: -1, ConflictIndex: 3},
+		&raft.InstallSnapshotArgs{Term: 5, LeaderId: 0, LastIncludedIndex: 100, LastIncludedTerm: 4, Config: config, Data: []byte("state")},
+		&raft.InstallSnapshotReply{Term: 5},
+		&raft.TimeoutNowArgs{Term: 6, LeaderId: 2},
+		&raft.TimeoutNowReply{Term: 6},
+	}
+
+	for _, msg := range messages {
+		b, err := marshal(msg, StringCommands{})
+		if err != nil {
+			t.Fatalf("marshal %T: %v", msg, err)
+		}
+		got := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+		if err := unmarshal(b, got, StringCommands{}); err != nil {
+			t.Fatalf("unmarshal %T: %v", msg, err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("round trip of %T:\n got %+v\nwant %+v", msg, got, msg)
+		}
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	b, _ := marshal(&raft.TimeoutNowReply{Term: 7}, nil)
+	// Field 9, fixed64, as a newer peer might send.
+	b = append(b, 9<<3|1, 1, 2, 3, 4, 5, 6, 7, 8)
+
+	var reply raft.TimeoutNowReply
+	if err := unmarshal(b, &reply, nil); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if reply.Term != 7 {
+		t.Errorf("Term = %d, want 7", reply.Term)
+	}
+}
+
+func TestUnmarshalRejectsTruncatedInput(t *testing.T) {
+	b, _ := marshal(&raft.InstallSnapshotArgs{Term: 1, Data: []byte("snapshot")}, nil)
+	var args raft.InstallSnapshotArgs
+	if err := unmarshal(b[:len(b)-2], &args, nil); err == nil {
+		t.Errorf("unmarshal of a truncated message succeeded")
+	}
+}
@@ -0,0 +1,86 @@
+package protorpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Requests and replies are framed as in gRPC over HTTP/2: the body is a
+// one-byte compressed flag, always 0 here, a four-byte big-endian length
+// and the protobuf message. The call's outcome is a grpc-status trailer,
+// 0 for success, with a percent-encoded grpc-message describing a failure.
+// A failed call may instead carry both in its headers and have no body.
+const (
+	contentType     = "application/grpc"
+	frameHeaderSize = 5
+)
+
+// maxMessageSize bounds a message, which is dominated by snapshots.
+const maxMessageSize = 64 << 20
+
+// gRPC status codes used by the server.
+const (
+	codeOK              = "0"
+	codeInvalidArgument = "3"
+	codeInternal        = "13"
+	codeUnavailable     = "14"
+)
+
+// methodPath is the gRPC path of method, named "<Service>.<Method>". Every
+// service is in the proto package raft.
+func methodPath(method string) string {
+	return "/raft." + strings.Replace(method, ".", "/", 1)
+}
+
+// isGRPC reports whether a Content-Type is gRPC's, which may name a
+// subtype such as application/grpc+proto.
+func isGRPC(ct string) bool {
+	return ct == contentType || strings.HasPrefix(ct, contentType+"+") || strings.HasPrefix(ct, contentType+";")
+}
+
+func frame(msg []byte) []byte {
+	b := make([]byte, frameHeaderSize, frameHeaderSize+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readMessage reads one framed message from r. It returns io.EOF if r
+// holds no message at all.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("protorpc: truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("protorpc: compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("protorpc: message of %d bytes is too large", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.New("protorpc: truncated message")
+	}
+	return msg, nil
+}
+
+// encodeGRPCMessage percent-encodes the bytes of s that may not appear in
+// an HTTP/2 header value, as grpc-message requires.
+func encodeGRPCMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
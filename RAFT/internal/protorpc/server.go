@@ -0,0 +1,139 @@
+// Package protorpc carries Raft's RPCs, and those of any service registered
+// alongside it, as protobuf messages (see raft.proto) in gRPC's wire format
+// over HTTP/2 without TLS. Each call is a POST to /raft.<Service>/<Method>,
+// and every call to a peer is multiplexed over a single connection.
+package protorpc
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+type Server struct {
+	node     *raft.Raft
+	commands CommandCodec
+	services map[string]http.HandlerFunc
+
+	mu      sync.Mutex
+	server  *http.Server
+	stopped bool
+}
+
+// NewServer returns a server for node whose log commands are encoded with
+// commands, which must match the peers' transports.
+func NewServer(node *raft.Raft, commands CommandCodec) *Server {
+	return &Server{node: node, commands: commands, services: make(map[string]http.HandlerFunc)}
+}
+
+// Register exposes rpc as method, named "<Service>.<Method>" like the
+// key/value service's "KVServer.Get", on the same listener as the Raft
+// node. The argument and reply types must implement Message. It must be
+// called before Start.
+func Register[Args, Reply any](s *Server, method string, rpc func(*Args, *Reply) error) {
+	s.services[method] = handle(rpc, s.commands)
+}
+
+func (s *Server) Start(address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+methodPath("Raft.RequestVote"), handle(s.node.RequestVote, s.commands))
+	mux.HandleFunc("POST "+methodPath("Raft.AppendEntries"), handle(s.node.AppendEntries, s.commands))
+	mux.HandleFunc("POST "+methodPath("Raft.InstallSnapshot"), handle(s.node.InstallSnapshot, s.commands))
+	mux.HandleFunc("POST "+methodPath("Raft.TimeoutNow"), handle(s.node.TimeoutNow, s.commands))
+	for method, h := range s.services {
+		mux.HandleFunc("POST "+methodPath(method), h)
+	}
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Handler: mux, Protocols: &protocols}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		listener.Close()
+		return errors.New("protorpc: server stopped")
+	}
+	s.server = server
+	s.mu.Unlock()
+
+	log.Printf("[Server] Listening on %s (gRPC over HTTP/2)", address)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Server] Serve error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the listener and every open connection, then stops the node.
+// It is safe to call more than once and from several goroutines.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		if s.server != nil {
+			s.server.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	s.node.Stop()
+}
+
+// handle adapts an RPC handler to a gRPC method. A handler error, such as
+// raft.ErrStopped, becomes UNAVAILABLE so the caller sees no reply.
+func handle[Args, Reply any](rpc func(*Args, *Reply) error, commands CommandCodec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isGRPC(r.Header.Get("Content-Type")) {
+			http.Error(w, "protorpc: expected "+contentType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := readMessage(http.MaxBytesReader(w, r.Body, frameHeaderSize+maxMessageSize))
+		if err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+
+		var args Args
+		if err := unmarshal(body, &args, commands); err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+
+		var reply Reply
+		if err := rpc(&args, &reply); err != nil {
+			writeStatus(w, codeUnavailable, err.Error())
+			return
+		}
+
+		out, err := marshal(&reply, commands)
+		if err != nil {
+			writeStatus(w, codeInternal, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(frame(out))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", codeOK)
+	}
+}
+
+// writeStatus sends a response with no message whose headers carry the
+// status, which gRPC calls Trailers-Only.
+func writeStatus(w http.ResponseWriter, code string, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Grpc-Status", code)
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,122 @@
+package protorpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+// Transport is a raft.Transport that speaks to protorpc servers. HTTP/2
+// multiplexes concurrent calls to a peer over one pooled connection.
+type Transport struct {
+	timeout  time.Duration
+	commands CommandCodec
+	client   *http.Client
+}
+
+var _ raft.Transport = (*Transport)(nil)
+
+// NewTransport returns a Transport that gives up on a call, including the
+// dial, after timeout, and encodes log commands with commands.
+func NewTransport(timeout time.Duration, commands CommandCodec) *Transport {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &Transport{
+		timeout:  timeout,
+		commands: commands,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Protocols:       &protocols,
+				IdleConnTimeout: 90 * time.Second,
+			},
+		},
+	}
+}
+
+func (t *Transport) RequestVote(ctx context.Context, address string, args *raft.RequestVoteArgs, reply *raft.RequestVoteReply) error {
+	return t.invoke(ctx, address, "Raft.RequestVote", args, reply)
+}
+
+func (t *Transport) AppendEntries(ctx context.Context, address string, args *raft.AppendEntriesArgs, reply *raft.AppendEntriesReply) error {
+	return t.invoke(ctx, address, "Raft.AppendEntries", args, reply)
+}
+
+func (t *Transport) InstallSnapshot(ctx context.Context, address string, args *raft.InstallSnapshotArgs, reply *raft.InstallSnapshotReply) error {
+	return t.invoke(ctx, address, "Raft.InstallSnapshot", args, reply)
+}
+
+func (t *Transport) TimeoutNow(ctx context.Context, address string, args *raft.TimeoutNowArgs, reply *raft.TimeoutNowReply) error {
+	return t.invoke(ctx, address, "Raft.TimeoutNow", args, reply)
+}
+
+// Call invokes a method registered with Register, such as "KVServer.Get",
+// whose argument and reply types implement Message. It has the signature
+// kvraft.MakeClerk expects.
+func (t *Transport) Call(address string, method string, args interface{}, reply interface{}) bool {
+	return t.invoke(context.Background(), address, method, args, reply) == nil
+}
+
+// Close closes idle connections. Calls in progress are unaffected.
+func (t *Transport) Close() {
+	t.client.CloseIdleConnections()
+}
+
+// invoke calls method, named "<Service>.<Method>", on the server at
+// address.
+func (t *Transport) invoke(ctx context.Context, address string, method string, args interface{}, reply interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	body, err := marshal(args, t.commands)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+methodPath(method), bytes.NewReader(frame(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Te", "trailers")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		out, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("protorpc: %s: %s: %s", method, resp.Status, bytes.TrimSpace(out))
+	}
+
+	out, err := readMessage(resp.Body)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("protorpc: %s: %w", method, err)
+	}
+	// Trailers arrive once the body has been read to the end.
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	code := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if code != codeOK {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return fmt.Errorf("protorpc: %s: grpc-status %s: %s", method, code, message)
+	}
+	if out == nil {
+		return fmt.Errorf("protorpc: %s: no reply", method)
+	}
+	return unmarshal(out, reply, t.commands)
+}
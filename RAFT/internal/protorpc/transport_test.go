@@ -0,0 +1,218 @@
+package protorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/kvraft"
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/raft"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// freeAddresses returns n loopback addresses nothing is listening on.
+func freeAddresses(t *testing.T, n int) []string {
+	addrs := make([]string, n)
+	for i := range addrs {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to find a free port: %v", err)
+		}
+		addrs[i] = l.Addr().String()
+		defer l.Close()
+	}
+	return addrs
+}
+
+func TestClusterOverHTTP2(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	addrs := freeAddresses(t, 3)
+	transport := NewTransport(500*time.Millisecond, StringCommands{})
+	defer transport.Close()
+
+	nodes := make([]*raft.Raft, len(addrs))
+	applyChs := make([]chan raft.ApplyMsg, len(addrs))
+	for i, addr := range addrs {
+		applyChs[i] = make(chan raft.ApplyMsg, 16)
+		node, err := raft.NewRaft(i, addrs, transport, applyChs[i], storage.NewMemoryPersister())
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		server := NewServer(node, StringCommands{})
+		if err := server.Start(addr); err != nil {
+			t.Fatalf("failed to start server %d: %v", i, err)
+		}
+		defer server.Stop()
+		nodes[i] = node
+	}
+	for _, node := range nodes {
+		node.Start()
+	}
+
+	var leader *raft.Raft
+	for deadline := time.Now().Add(5 * time.Second); leader == nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("no leader elected")
+		}
+		for _, node := range nodes {
+			if _, isLeader := node.GetState(); isLeader {
+				leader = node
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		command := fmt.Sprintf("cmd-%d", i)
+		index, _, ok := leader.Submit(command)
+		if !ok {
+			t.Fatalf("leader rejected %q", command)
+		}
+		for j, applyCh := range applyChs {
+			select {
+			case msg := <-applyCh:
+				if msg.Index != index || msg.Command != command {
+					t.Fatalf("node %d applied %v at %d, want %q at %d", j, msg.Command, msg.Index, command, index)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("node %d did not apply %q", j, command)
+			}
+		}
+	}
+}
+
+func TestHandlerErrorIsNoReply(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	addr := freeAddresses(t, 1)[0]
+	transport := NewTransport(500*time.Millisecond, StringCommands{})
+	defer transport.Close()
+
+	node, err := raft.NewRaft(0, []string{addr}, transport, make(chan raft.ApplyMsg), storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	server := NewServer(node, StringCommands{})
+	if err := server.Start(addr); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// The node was never started, so it handles RPCs; once stopped it
+	// refuses them.
+	var reply raft.RequestVoteReply
+	if err := transport.RequestVote(t.Context(), addr, &raft.RequestVoteArgs{Term: 1, CandidateId: 1}, &reply); err != nil {
+		t.Fatalf("RequestVote failed: %v", err)
+	}
+	if !reply.VoteGranted || reply.Term != 1 {
+		t.Fatalf("RequestVote reply %+v, want a vote in term 1", reply)
+	}
+
+	node.Stop()
+	if err := transport.RequestVote(t.Context(), addr, &raft.RequestVoteArgs{Term: 2, CandidateId: 1}, &reply); err == nil {
+		t.Fatalf("RequestVote to a stopped node succeeded")
+	}
+}
+
+func TestKVOverHTTP2(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	addrs := freeAddresses(t, 3)
+	transport := NewTransport(500*time.Millisecond, kvraft.OpCodec{})
+	defer transport.Close()
+
+	for i, addr := range addrs {
+		kv, err := kvraft.StartKVServer(i, addrs, transport, storage.NewMemoryPersister(), 0)
+		if err != nil {
+			t.Fatalf("failed to start key/value server %d: %v", i, err)
+		}
+		defer kv.Stop()
+		server := NewServer(kv.Raft(), kvraft.OpCodec{})
+		Register(server, "KVServer.Get", kv.Get)
+		Register(server, "KVServer.PutAppend", kv.PutAppend)
+		if err := server.Start(addr); err != nil {
+			t.Fatalf("failed to start server %d: %v", i, err)
+		}
+		defer server.Stop()
+	}
+
+	clerk := kvraft.MakeClerk(addrs, transport.Call)
+	clerk.Put("x", "1")
+	clerk.Append("x", "2")
+	if got := clerk.Get("x"); got != "12" {
+		t.Errorf("Get(x) = %q, want %q", got, "12")
+	}
+}
+
+// TestGRPCWireFormat checks the framing a gRPC client would see, using a
+// plain HTTP/2 client.
+func TestGRPCWireFormat(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	addr := freeAddresses(t, 1)[0]
+	node, err := raft.NewRaft(0, []string{addr}, NewTransport(time.Second, nil), make(chan raft.ApplyMsg), storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	server := NewServer(node, nil)
+	if err := server.Start(addr); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	defer client.CloseIdleConnections()
+
+	call := func(body []byte) *http.Response {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/raft.Raft/RequestVote", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// RequestVoteArgs{term: 1, candidate_id: 1}, framed by hand.
+	msg := []byte{1 << 3, 1, 2 << 3, 1}
+	body := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+	resp := call(body)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/grpc" {
+		t.Errorf("Content-Type = %q, want application/grpc", ct)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	if len(out) < 5 || out[0] != 0 || int(binary.BigEndian.Uint32(out[1:])) != len(out)-5 {
+		t.Fatalf("reply %x is not one uncompressed length-prefixed message", out)
+	}
+	var reply raft.RequestVoteReply
+	if err := unmarshal(out[5:], &reply, nil); err != nil || !reply.VoteGranted || reply.Term != 1 {
+		t.Errorf("reply %+v (%v), want a vote in term 1", reply, err)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("grpc-status trailer = %q, want 0", status)
+	}
+
+	// A compressed message is refused with a status and no reply.
+	body[0] = 1
+	resp = call(body)
+	if status := resp.Header.Get("Grpc-Status"); status != "3" {
+		t.Errorf("grpc-status for a compressed message = %q, want 3", status)
+	}
+}
@@ -0,0 +1,107 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInitialElection(t *testing.T) {
+	c := newCluster(t, 3)
+
+	leader := c.waitForLeader()
+	term, _ := c.node(leader).GetState()
+
+	// With no faults the leader keeps its term.
+	time.Sleep(1 * time.Second)
+	if again, isLeader := c.node(leader).GetState(); again != term || !isLeader {
+		t.Errorf("leadership changed without faults: term %d -> %d, leader=%v", term, again, isLeader)
+	}
+}
+
+func TestReElection(t *testing.T) {
+	c := newCluster(t, 3)
+
+	leader1 := c.waitForLeader()
+
+	c.disconnect(leader1)
+	leader2 := c.waitForLeader()
+	if leader2 == leader1 {
+		t.Fatalf("disconnected leader %d is still the newest leader", leader1)
+	}
+
+	// The old leader stepped down once it lost its quorum, so it rejoins
+	// as a follower without disturbing the new one.
+	c.connect(leader1)
+	if got := c.waitForLeader(); got != leader2 {
+		t.Fatalf("leader changed from %d to %d after old leader rejoined", leader2, got)
+	}
+
+	// Without a quorum nobody can be elected.
+	leader3 := c.waitForLeader()
+	other := (leader3 + 1) % 3
+	c.disconnect(leader3)
+	c.disconnect(other)
+	time.Sleep(1 * time.Second)
+	c.checkNoLeader()
+
+	c.connect(other)
+	c.waitForLeader()
+	c.connect(leader3)
+	c.waitForLeader()
+}
+
+func TestElectionUnderPartitions(t *testing.T) {
+	c := newCluster(t, 5)
+
+	for round := 0; round < 4; round++ {
+		leader := c.waitForLeader()
+		minority := []int{leader, (leader + 1) % 5}
+		majority := []int{(leader + 2) % 5, (leader + 3) % 5, (leader + 4) % 5}
+
+		c.partition(minority, majority)
+		c.waitForLeader(majority...)
+
+		c.heal()
+	}
+
+	c.one("after partitions", 5)
+}
+
+// TestLeaderStepsDownWithoutQuorum isolates the leader, which must notice it
+// can no longer reach a majority and stop acting as leader.
+func TestLeaderStepsDownWithoutQuorum(t *testing.T) {
+	c := newCluster(t, 3)
+
+	leader := c.waitForLeader()
+	c.partition([]int{leader}, []int{(leader + 1) % 3, (leader + 2) % 3})
+
+	time.Sleep(1 * time.Second)
+	if _, isLeader := c.node(leader).GetState(); isLeader {
+		t.Fatalf("isolated node %d still believes it is the leader", leader)
+	}
+	c.waitForLeader((leader+1)%3, (leader+2)%3)
+}
+
+// TestPartitionedFollowerDoesNotDisrupt cuts a follower off for many
+// election timeouts. PreVote keeps its term from growing, so it rejoins
+// without forcing the leader out.
+func TestPartitionedFollowerDoesNotDisrupt(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("before", 3)
+	leader := c.waitForLeader()
+	term, _ := c.node(leader).GetState()
+	follower := (leader + 1) % 3
+
+	c.disconnect(follower)
+	time.Sleep(2 * time.Second)
+	if followerTerm, _ := c.node(follower).GetState(); followerTerm != term {
+		t.Fatalf("isolated follower moved from term %d to %d", term, followerTerm)
+	}
+
+	c.connect(follower)
+	c.one("after rejoin", 3)
+	if again, isLeader := c.node(leader).GetState(); again != term || !isLeader {
+		t.Fatalf("rejoining follower disrupted leader %d: term %d -> %d, leader=%v", leader, term, again, isLeader)
+	}
+}
@@ -0,0 +1,505 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/labrpc"
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// cluster runs Raft nodes on a labrpc network. A crashed node is stopped,
+// its End closed and its persister copied, so nothing the old instance
+// still has in flight can reach the network or touch the state its
+// replacement restarts from. Once the test ends, every node is stopped and
+// no goroutine may be left behind.
+//
+// While the cluster runs, a monitor checks election safety (at most one
+// leader per term) and log matching (logs that agree on an entry's term
+// agree on everything before it), and every applied command is checked
+// against what other nodes applied at the same index.
+type cluster struct {
+	t   *testing.T
+	net *labrpc.Network
+
+	mu         sync.Mutex
+	addrs      []string
+	nodes      []*Raft
+	ends       []*labrpc.End
+	persisters []*storage.MemoryPersister
+	applied    []map[int]interface{}
+	lastIndex  []int
+	alive      []bool
+	connected  []bool
+	generation []int
+	leaders    map[int]int
+	finished   bool
+
+	// bootstrap is the peer list each node is started with; joining nodes
+	// start with none.
+	bootstrap [][]string
+
+	// snapshotEvery makes every node snapshot its applied commands each
+	// time that many entries have been applied; zero disables snapshots.
+	snapshotEvery int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newCluster(t *testing.T, n int) *cluster {
+	return newJoinCluster(t, n, n, 0)
+}
+
+func newSnapshotCluster(t *testing.T, n int, snapshotEvery int) *cluster {
+	return newJoinCluster(t, n, n, snapshotEvery)
+}
+
+// newJoinCluster bootstraps the first voters nodes as the configuration and
+// starts the rest as joining nodes that wait to be added.
+func newJoinCluster(t *testing.T, n int, voters int, snapshotEvery int) *cluster {
+	c := &cluster{
+		t:             t,
+		net:           labrpc.NewNetwork(time.Now().UnixNano()),
+		addrs:         make([]string, n),
+		nodes:         make([]*Raft, n),
+		ends:          make([]*labrpc.End, n),
+		persisters:    make([]*storage.MemoryPersister, n),
+		applied:       make([]map[int]interface{}, n),
+		lastIndex:     make([]int, n),
+		alive:         make([]bool, n),
+		connected:     make([]bool, n),
+		generation:    make([]int, n),
+		leaders:       make(map[int]int),
+		bootstrap:     make([][]string, n),
+		snapshotEvery: snapshotEvery,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for i := range c.addrs {
+		c.addrs[i] = fmt.Sprintf("node-%d", i)
+		c.persisters[i] = storage.NewMemoryPersister()
+	}
+	t.Cleanup(leaktest.Check(t))
+	for i := 0; i < voters; i++ {
+		c.bootstrap[i] = c.addrs[:voters]
+	}
+	for i := range c.nodes {
+		c.start(i)
+	}
+
+	go c.monitor()
+	t.Cleanup(c.cleanup)
+	return c
+}
+
+func (c *cluster) cleanup() {
+	close(c.stop)
+	<-c.done
+	c.checkLogMatching()
+
+	c.mu.Lock()
+	c.finished = true
+	nodes := append([]*Raft(nil), c.nodes...)
+	for i, end := range c.ends {
+		end.Close()
+		c.net.DeleteServer(c.addrs[i])
+	}
+	c.mu.Unlock()
+
+	for _, rf := range nodes {
+		rf.Stop()
+	}
+}
+
+// errorf reports a failure from a background goroutine, which may outlive
+// the test when it belongs to a crashed node. Callers must hold c.mu.
+func (c *cluster) errorf(format string, args ...interface{}) {
+	if !c.finished {
+		c.t.Errorf(format, args...)
+	}
+}
+
+func (c *cluster) start(i int) {
+	c.mu.Lock()
+	c.generation[i]++
+	gen := c.generation[i]
+	persister := c.persisters[i]
+	end := c.net.MakeEnd(c.addrs[i])
+	c.mu.Unlock()
+
+	applyCh := make(chan ApplyMsg)
+	rf, err := NewRaft(i, c.bootstrap[i], CallTransport(end.Call), applyCh, persister)
+	if err != nil {
+		c.t.Fatalf("failed to start node %d: %v", i, err)
+	}
+
+	c.mu.Lock()
+	c.nodes[i] = rf
+	c.ends[i] = end
+	c.applied[i] = make(map[int]interface{})
+	c.lastIndex[i] = 0
+	c.alive[i] = true
+	c.connected[i] = true
+	c.mu.Unlock()
+
+	if err := c.net.AddService(c.addrs[i], "Raft", rf); err != nil {
+		c.t.Fatalf("failed to register node %d: %v", i, err)
+	}
+	c.net.Connect(c.addrs[i])
+
+	go c.applier(i, gen, rf, applyCh)
+	rf.Start()
+}
+
+func (c *cluster) applier(i int, gen int, rf *Raft, applyCh chan ApplyMsg) {
+	for msg := range applyCh {
+		c.mu.Lock()
+		if c.generation[i] != gen {
+			c.mu.Unlock()
+			continue
+		}
+
+		if msg.SnapshotValid {
+			var applied map[int]interface{}
+			if err := gob.NewDecoder(bytes.NewReader(msg.Snapshot)).Decode(&applied); err != nil {
+				c.errorf("node %d failed to decode snapshot: %v", i, err)
+			}
+			c.applied[i] = applied
+			c.lastIndex[i] = msg.Index
+			c.mu.Unlock()
+			continue
+		}
+
+		if msg.Index <= c.lastIndex[i] {
+			c.errorf("node %d applied index %d after %d", i, msg.Index, c.lastIndex[i])
+		}
+		for j := range c.applied {
+			if prev, ok := c.applied[j][msg.Index]; ok && prev != msg.Command {
+				c.errorf("node %d applied %v at index %d but node %d applied %v", i, msg.Command, msg.Index, j, prev)
+			}
+		}
+		c.applied[i][msg.Index] = msg.Command
+		c.lastIndex[i] = msg.Index
+
+		var snapshot []byte
+		if c.snapshotEvery > 0 && len(c.applied[i])%c.snapshotEvery == 0 {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(c.applied[i]); err != nil {
+				c.errorf("node %d failed to encode snapshot: %v", i, err)
+			}
+			snapshot = buf.Bytes()
+		}
+		c.mu.Unlock()
+
+		if snapshot != nil {
+			if err := rf.Snapshot(msg.Index, snapshot); err != nil {
+				c.mu.Lock()
+				c.errorf("node %d failed to snapshot: %v", i, err)
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (c *cluster) crash(i int) {
+	c.mu.Lock()
+	rf := c.nodes[i]
+	c.ends[i].Close()
+	c.net.DeleteServer(c.addrs[i])
+	c.alive[i] = false
+	c.connected[i] = false
+	c.generation[i]++
+	c.persisters[i] = c.persisters[i].Copy()
+	c.mu.Unlock()
+
+	rf.Stop()
+}
+
+func (c *cluster) disconnect(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.net.Disconnect(c.addrs[i])
+	c.connected[i] = false
+}
+
+func (c *cluster) connect(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.net.Connect(c.addrs[i])
+	c.connected[i] = c.alive[i]
+}
+
+// partition lets only nodes in the same group talk to each other.
+func (c *cluster) partition(groups ...[]int) {
+	addrGroups := make([][]string, len(groups))
+	for g, group := range groups {
+		for _, i := range group {
+			addrGroups[g] = append(addrGroups[g], c.addrs[i])
+		}
+	}
+	c.net.Partition(addrGroups...)
+}
+
+func (c *cluster) heal() {
+	c.net.Heal()
+}
+
+func (c *cluster) node(i int) *Raft {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.nodes[i]
+}
+
+// currentLeaders returns the live nodes that believe they lead, by term.
+func (c *cluster) currentLeaders() map[int][]int {
+	c.mu.Lock()
+	nodes := append([]*Raft(nil), c.nodes...)
+	alive := append([]bool(nil), c.alive...)
+	c.mu.Unlock()
+
+	leaders := make(map[int][]int)
+	for i, rf := range nodes {
+		if !alive[i] {
+			continue
+		}
+		if term, isLeader := rf.GetState(); isLeader {
+			leaders[term] = append(leaders[term], i)
+		}
+	}
+	return leaders
+}
+
+// waitForLeader returns the leader of the newest term among connected
+// nodes, or among servers if given, waiting until there is one.
+func (c *cluster) waitForLeader(servers ...int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		connected := append([]bool(nil), c.connected...)
+		c.mu.Unlock()
+		if len(servers) > 0 {
+			candidates := make([]bool, len(connected))
+			for _, i := range servers {
+				candidates[i] = connected[i]
+			}
+			connected = candidates
+		}
+
+		newest, leader := -1, -1
+		for term, ids := range c.currentLeaders() {
+			for _, id := range ids {
+				if connected[id] && term > newest {
+					newest, leader = term, id
+				}
+			}
+		}
+		if leader != -1 {
+			return leader
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatalf("no leader elected")
+	return -1
+}
+
+// checkNoLeader fails if any connected node believes it is the leader.
+func (c *cluster) checkNoLeader() {
+	c.mu.Lock()
+	connected := append([]bool(nil), c.connected...)
+	c.mu.Unlock()
+
+	for term, ids := range c.currentLeaders() {
+		for _, id := range ids {
+			if connected[id] {
+				c.t.Fatalf("node %d is leader in term %d without a majority", id, term)
+			}
+		}
+	}
+}
+
+// waitForApplied waits until command is applied at index on the given
+// servers, or on every live node if none are given.
+func (c *cluster) waitForApplied(index int, command interface{}, servers ...int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		if len(servers) == 0 {
+			for i := range c.nodes {
+				if c.alive[i] {
+					servers = append(servers, i)
+				}
+			}
+		}
+		done := true
+		for _, i := range servers {
+			if c.applied[i][index] != command {
+				done = false
+			}
+		}
+		c.mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatalf("command %v was not applied at index %d on servers %v", command, index, servers)
+}
+
+// nApplied returns how many nodes have applied a command at index.
+func (c *cluster) nApplied(index int) (int, interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	var command interface{}
+	for i := range c.applied {
+		if cmd, ok := c.applied[i][index]; ok {
+			count++
+			command = cmd
+		}
+	}
+	return count, command
+}
+
+// one submits command to whichever node is leader, retrying through leader
+// changes and lost RPCs, until at least expected nodes have applied it.
+// It returns the index the command committed at.
+func (c *cluster) one(command interface{}, expected int) int {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		index := -1
+		for i := range c.nodes {
+			c.mu.Lock()
+			rf, ok := c.nodes[i], c.connected[i]
+			c.mu.Unlock()
+			if !ok {
+				continue
+			}
+			if idx, _, isLeader := rf.Submit(command); isLeader {
+				index = idx
+				break
+			}
+		}
+
+		if index != -1 {
+			wait := time.Now().Add(2 * time.Second)
+			for time.Now().Before(wait) {
+				if count, cmd := c.nApplied(index); count >= expected && cmd == command {
+					return index
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	c.t.Fatalf("command %v was never applied on %d nodes", command, expected)
+	return -1
+}
+
+// changeConfig retries change on the current leader until a new leader has
+// committed in its term and accepts configuration changes, and until any
+// learner being promoted has caught up.
+func (c *cluster) changeConfig(change func(rf *Raft) error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		leader := c.waitForLeader()
+		err := change(c.node(leader))
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, ErrConfigChangeInProgress) && !errors.Is(err, ErrNotLeader) && !errors.Is(err, ErrLearnerBehind) {
+			c.t.Fatalf("configuration change failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatalf("configuration change was never accepted")
+}
+
+func (c *cluster) monitor() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		for term, ids := range c.currentLeaders() {
+			c.mu.Lock()
+			for _, id := range ids {
+				if prev, ok := c.leaders[term]; ok && prev != id {
+					c.errorf("term %d has two leaders: %d and %d", term, prev, id)
+				}
+				c.leaders[term] = id
+			}
+			c.mu.Unlock()
+		}
+		c.checkLogMatching()
+	}
+}
+
+type logView struct {
+	snapshotIndex int
+	entries       []LogEntry
+}
+
+// checkLogMatching verifies the Log Matching Property on every pair of
+// logs: if two logs hold an entry with the same index and term, they hold
+// identical entries up to that index (as far as neither has compacted).
+func (c *cluster) checkLogMatching() {
+	c.mu.Lock()
+	nodes := append([]*Raft(nil), c.nodes...)
+	c.mu.Unlock()
+
+	views := make([]logView, len(nodes))
+	for i, rf := range nodes {
+		rf.mu.Lock()
+		views[i] = logView{snapshotIndex: rf.snapshotIndex, entries: append([]LogEntry(nil), rf.log...)}
+		rf.mu.Unlock()
+	}
+
+	entryAt := func(v logView, index int) (LogEntry, bool) {
+		if index <= v.snapshotIndex || index >= v.snapshotIndex+len(v.entries) {
+			return LogEntry{}, false
+		}
+		return v.entries[index-v.snapshotIndex], true
+	}
+
+	for a := range views {
+		for b := a + 1; b < len(views); b++ {
+			last := min(views[a].snapshotIndex+len(views[a].entries), views[b].snapshotIndex+len(views[b].entries)) - 1
+			for index := last; index > 0; index-- {
+				ea, okA := entryAt(views[a], index)
+				eb, okB := entryAt(views[b], index)
+				if !okA || !okB || ea.Term != eb.Term {
+					continue
+				}
+				for i := index; i > 0; i-- {
+					ea, okA := entryAt(views[a], i)
+					eb, okB := entryAt(views[b], i)
+					if !okA || !okB {
+						break
+					}
+					if ea.Term != eb.Term || ea.Type != eb.Type || ea.Command != eb.Command {
+						c.mu.Lock()
+						c.errorf("logs of nodes %d and %d match at index %d but differ at %d", a, b, index, i)
+						c.mu.Unlock()
+						return
+					}
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLearnerDoesNotCountTowardQuorum(t *testing.T) {
+	c := newJoinCluster(t, 4, 3, 0)
+
+	c.changeConfig(func(rf *Raft) error { return rf.AddLearner(3, c.addrs[3]) })
+	leader := c.waitForLeader()
+	index, _, ok := c.node(leader).Submit("replicated")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(index, "replicated", 0, 1, 2, 3)
+	if role := c.node(3).Status().Role; role != "Learner" {
+		t.Fatalf("node 3 has role %s, want Learner", role)
+	}
+
+	// The leader and the learner are not a majority of three voters.
+	for i := 0; i < 3; i++ {
+		if i != leader {
+			c.disconnect(i)
+		}
+	}
+	stranded, _, ok := c.node(leader).Submit("stranded")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if count, _ := c.nApplied(stranded); count > 0 {
+		t.Fatalf("command committed on %d nodes with only a learner's help", count)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.connect(i)
+	}
+	c.one("after", 4)
+}
+
+func TestLearnerNeverCampaigns(t *testing.T) {
+	c := newJoinCluster(t, 4, 3, 0)
+
+	c.changeConfig(func(rf *Raft) error { return rf.AddLearner(3, c.addrs[3]) })
+	c.one("before", 4)
+	term, _ := c.node(3).GetState()
+
+	c.disconnect(3)
+	time.Sleep(1 * time.Second)
+	if again, _ := c.node(3).GetState(); again != term {
+		t.Fatalf("isolated learner moved from term %d to %d", term, again)
+	}
+	if role := c.node(3).Status().Role; role != "Learner" {
+		t.Fatalf("isolated learner has role %s", role)
+	}
+
+	// Voters that lose their leader elect a new one without the learner.
+	c.connect(3)
+	old := c.waitForLeader()
+	c.disconnect(old)
+	leader := c.waitForLeader()
+	if leader == 3 {
+		t.Fatalf("learner became leader")
+	}
+	c.connect(old)
+	c.one("after", 4)
+}
+
+func TestPromoteLearner(t *testing.T) {
+	c := newJoinCluster(t, 4, 3, 0)
+
+	c.changeConfig(func(rf *Raft) error { return rf.AddLearner(3, c.addrs[3]) })
+	c.one("before", 4)
+	c.changeConfig(func(rf *Raft) error { return rf.PromoteLearner(3) })
+	c.one("promoted", 4)
+
+	if role := c.node(3).Status().Role; role != "Follower" {
+		t.Fatalf("promoted node has role %s, want Follower", role)
+	}
+	for _, server := range c.node(3).Configuration() {
+		if server.Learner {
+			t.Fatalf("server %d is still a learner after promotion", server.ID)
+		}
+	}
+
+	// As a voter it can now lead.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		leader := c.waitForLeader()
+		if leader == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("promoted node never took over leadership")
+		}
+		c.node(leader).TransferLeadership(3)
+	}
+	c.one("led by the promoted node", 4)
+}
+
+func TestPromoteLearnerWaitsForCatchUp(t *testing.T) {
+	rf := newTestNode(t)
+	rf.mu.Lock()
+	rf.currentTerm = 1
+	rf.becomeLeader()
+	rf.commitIndex = rf.lastLogIndex()
+	rf.mu.Unlock()
+
+	if err := rf.AddLearner(3, "d"); err != nil {
+		t.Fatalf("AddLearner failed: %v", err)
+	}
+
+	rf.mu.Lock()
+	quorum := rf.quorum()
+	rf.commitIndex = rf.lastLogIndex()
+	rf.mu.Unlock()
+	if quorum != 2 {
+		t.Errorf("quorum of three voters and a learner is %d, want 2", quorum)
+	}
+
+	if err := rf.PromoteLearner(1); err == nil {
+		t.Errorf("PromoteLearner of a voter succeeded")
+	}
+	if err := rf.PromoteLearner(3); !errors.Is(err, ErrLearnerBehind) {
+		t.Fatalf("expected ErrLearnerBehind, got %v", err)
+	}
+
+	rf.mu.Lock()
+	rf.matchIndex[3] = rf.commitIndex
+	rf.mu.Unlock()
+	if err := rf.PromoteLearner(3); err != nil {
+		t.Fatalf("PromoteLearner failed: %v", err)
+	}
+	for _, server := range rf.Configuration() {
+		if server.Learner {
+			t.Errorf("server %d is still a learner", server.ID)
+		}
+	}
+}
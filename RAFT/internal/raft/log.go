@@ -0,0 +1,73 @@
+package raft
+
+// The log is 1-indexed as in the Raft paper. rf.log[0] is a sentinel that
+// stands for the last entry covered by the snapshot: it sits at index
+// rf.snapshotIndex and carries that entry's term. Without a snapshot it is
+// index 0 with term 0, so index 0 can always be used as PrevLogIndex.
+// Always go through these helpers rather than indexing rf.log directly.
+
+func (rf *Raft) lastLogIndex() int {
+	return rf.snapshotIndex + len(rf.log) - 1
+}
+
+func (rf *Raft) lastLogTerm() int {
+	return rf.log[len(rf.log)-1].Term
+}
+
+func (rf *Raft) snapshotTerm() int {
+	return rf.log[0].Term
+}
+
+// entry returns the entry at index, which must lie between snapshotIndex and
+// lastLogIndex.
+func (rf *Raft) entry(index int) LogEntry {
+	return rf.log[index-rf.snapshotIndex]
+}
+
+func (rf *Raft) termAt(index int) int {
+	return rf.entry(index).Term
+}
+
+// entriesFrom returns a copy of up to limit entries starting at index, safe
+// to hand to an RPC after rf.mu is released.
+func (rf *Raft) entriesFrom(index int, limit int) []LogEntry {
+	tail := rf.log[index-rf.snapshotIndex:]
+	entries := make([]LogEntry, min(len(tail), limit))
+	copy(entries, tail)
+	return entries
+}
+
+// truncateFrom drops every entry at index and after.
+func (rf *Raft) truncateFrom(index int) {
+	rf.log = rf.log[:index-rf.snapshotIndex]
+}
+
+// compactTo discards every entry up to and including index, which becomes
+// the new sentinel with the given term; config is the configuration in
+// effect at index. Entries after index are kept only if the log agrees with
+// the snapshot at index; otherwise the whole log is superseded by the
+// snapshot.
+func (rf *Raft) compactTo(index int, term int, config []Server) {
+	var tail []LogEntry
+	if index <= rf.lastLogIndex() && rf.termAt(index) == term {
+		tail = rf.log[index-rf.snapshotIndex+1:]
+	}
+
+	compacted := make([]LogEntry, 0, len(tail)+1)
+	compacted = append(compacted, LogEntry{Term: term})
+	compacted = append(compacted, tail...)
+
+	rf.log = compacted
+	rf.snapshotIndex = index
+	rf.snapshotConfig = config
+}
+
+// isLogUpToDate reports whether a log ending at lastIndex/lastTerm is at
+// least as up-to-date as ours (Raft paper §5.4.1): the later last term wins,
+// and with equal terms the longer log wins.
+func (rf *Raft) isLogUpToDate(lastIndex int, lastTerm int) bool {
+	if lastTerm != rf.lastLogTerm() {
+		return lastTerm > rf.lastLogTerm()
+	}
+	return lastIndex >= rf.lastLogIndex()
+}
@@ -0,0 +1,235 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrConfigChangeInProgress is returned while an earlier configuration
+	// change is uncommitted, or before a new leader has committed an entry
+	// from its own term. Callers should retry shortly.
+	ErrConfigChangeInProgress = errors.New("raft: a configuration change is already in progress")
+	// ErrLearnerBehind is returned by PromoteLearner while the learner has
+	// not yet replicated everything the leader has committed.
+	ErrLearnerBehind = errors.New("raft: learner has not caught up")
+)
+
+// Membership changes use the single-server approach from the Raft thesis
+// (§4.1): each change adds or removes one server, so the old and new
+// majorities always overlap. A configuration takes effect as soon as its
+// entry is appended, and only one change may be uncommitted at a time.
+//
+// A new server can first join as a learner, which receives the log without
+// counting toward any majority, and be promoted once it has caught up. The
+// cluster then never waits on a voter that is still copying the log.
+
+// Configuration returns a copy of the latest configuration in the log.
+func (rf *Raft) Configuration() []Server {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return append([]Server(nil), rf.config...)
+}
+
+// AddServer proposes a configuration that adds server id at address. The
+// change is in effect once this returns and is complete once it commits.
+func (rf *Raft) AddServer(id int, address string) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.checkConfigChange(); err != nil {
+		return err
+	}
+	if rf.isMember(id) {
+		return fmt.Errorf("raft: server %d is already a member", id)
+	}
+
+	config := append(append([]Server(nil), rf.config...), Server{ID: id, Address: address})
+	return rf.proposeConfig(config)
+}
+
+// AddLearner proposes a configuration that adds server id at address as a
+// learner. Learners replicate the log and serve as read replicas but do not
+// vote; PromoteLearner makes one a voter.
+func (rf *Raft) AddLearner(id int, address string) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.checkConfigChange(); err != nil {
+		return err
+	}
+	if rf.isMember(id) {
+		return fmt.Errorf("raft: server %d is already a member", id)
+	}
+
+	config := append(append([]Server(nil), rf.config...), Server{ID: id, Address: address, Learner: true})
+	return rf.proposeConfig(config)
+}
+
+// PromoteLearner proposes a configuration in which learner id votes. It
+// returns ErrLearnerBehind until the learner holds every committed entry,
+// so callers should retry until it succeeds.
+func (rf *Raft) PromoteLearner(id int) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.checkConfigChange(); err != nil {
+		return err
+	}
+	if !rf.isMember(id) || rf.isVoter(id) {
+		return fmt.Errorf("raft: server %d is not a learner", id)
+	}
+	if rf.matchIndex[id] < rf.commitIndex {
+		return ErrLearnerBehind
+	}
+
+	config := make([]Server, len(rf.config))
+	for i, server := range rf.config {
+		if server.ID == id {
+			server.Learner = false
+		}
+		config[i] = server
+	}
+	return rf.proposeConfig(config)
+}
+
+// RemoveServer proposes a configuration without server id. Removing the
+// leader itself is allowed: it steps down once the change commits.
+func (rf *Raft) RemoveServer(id int) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.checkConfigChange(); err != nil {
+		return err
+	}
+	if !rf.isMember(id) {
+		return fmt.Errorf("raft: server %d is not a member", id)
+	}
+
+	config := make([]Server, 0, len(rf.config)-1)
+	for _, server := range rf.config {
+		if server.ID != id {
+			config = append(config, server)
+		}
+	}
+	return rf.proposeConfig(config)
+}
+
+// checkConfigChange enforces one uncommitted change at a time. Waiting for
+// the leader to commit in its own term closes the gap where a change from a
+// previous leader is still pending but not yet visible as committed.
+// Callers must hold rf.mu.
+func (rf *Raft) checkConfigChange() error {
+	if rf.role != Leader {
+		return ErrNotLeader
+	}
+	if rf.configIndex > rf.commitIndex || rf.termAt(rf.commitIndex) != rf.currentTerm {
+		return ErrConfigChangeInProgress
+	}
+	return nil
+}
+
+// proposeConfig appends config to the log and switches to it immediately.
+// Callers must hold rf.mu.
+func (rf *Raft) proposeConfig(config []Server) error {
+	rf.log = append(rf.log, LogEntry{Term: rf.currentTerm, Type: ConfigEntry, Config: config})
+	index := rf.lastLogIndex()
+	if err := rf.persist(); err != nil {
+		rf.truncateFrom(index)
+		return err
+	}
+
+	log.Printf("[Node %d] Proposed configuration %v at index %d", rf.id, config, index)
+
+	rf.config = config
+	rf.configIndex = index
+	rf.trackPeers()
+	rf.matchIndex[rf.id] = index
+	rf.nextIndex[rf.id] = index + 1
+	rf.advanceCommitIndex()
+
+	rf.replicateAll()
+	return nil
+}
+
+// configAt returns the configuration in effect at index and the index of
+// the entry that introduced it.
+func (rf *Raft) configAt(index int) ([]Server, int) {
+	for i := index; i > rf.snapshotIndex; i-- {
+		if entry := rf.entry(i); entry.Type == ConfigEntry {
+			return entry.Config, i
+		}
+	}
+	return rf.snapshotConfig, rf.snapshotIndex
+}
+
+// reloadConfig picks up the latest configuration after the log changed
+// under us, including when a truncation removed an uncommitted change.
+// Callers must hold rf.mu.
+func (rf *Raft) reloadConfig() {
+	rf.config, rf.configIndex = rf.configAt(rf.lastLogIndex())
+	if rf.role == Follower || rf.role == Learner {
+		rf.role = rf.followerRole()
+	}
+}
+
+// followerRole is the role this node takes when it is not leading or
+// campaigning. Callers must hold rf.mu.
+func (rf *Raft) followerRole() NodeRole {
+	if rf.isMember(rf.id) && !rf.isVoter(rf.id) {
+		return Learner
+	}
+	return Follower
+}
+
+// trackPeers starts tracking replication progress for servers that joined
+// the configuration. Callers must hold rf.mu and be the leader.
+func (rf *Raft) trackPeers() {
+	for _, server := range rf.config {
+		if _, ok := rf.nextIndex[server.ID]; !ok {
+			rf.nextIndex[server.ID] = rf.lastLogIndex() + 1
+			rf.matchIndex[server.ID] = 0
+			rf.lastAck[server.ID] = time.Now()
+			rf.progress[server.ID] = &progress{probing: true}
+		}
+	}
+}
+
+func (rf *Raft) isMember(id int) bool {
+	_, ok := rf.addressOf(id)
+	return ok
+}
+
+// isVoter reports whether id is a member that is not a learner.
+func (rf *Raft) isVoter(id int) bool {
+	for _, server := range rf.config {
+		if server.ID == id {
+			return !server.Learner
+		}
+	}
+	return false
+}
+
+func (rf *Raft) addressOf(id int) (string, bool) {
+	for _, server := range rf.config {
+		if server.ID == id {
+			return server.Address, true
+		}
+	}
+	return "", false
+}
+
+// quorum is a majority of the voters; learners are not counted.
+func (rf *Raft) quorum() int {
+	voters := 0
+	for _, server := range rf.config {
+		if !server.Learner {
+			voters++
+		}
+	}
+	return voters/2 + 1
+}
@@ -0,0 +1,152 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAddServer(t *testing.T) {
+	c := newJoinCluster(t, 4, 3, 0)
+
+	leader := c.waitForLeader()
+	before, _, ok := c.node(leader).Submit("before")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(before, "before", 0, 1, 2)
+
+	c.changeConfig(func(rf *Raft) error { return rf.AddServer(3, c.addrs[3]) })
+
+	leader = c.waitForLeader()
+	after, _, ok := c.node(leader).Submit("after")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(after, "after", 0, 1, 2, 3)
+	c.waitForApplied(before, "before", 3)
+
+	if config := c.node(3).Configuration(); len(config) != 4 {
+		t.Errorf("expected joined node to see 4 servers, got %v", config)
+	}
+}
+
+func TestRemoveFollower(t *testing.T) {
+	c := newCluster(t, 3)
+
+	leader := c.waitForLeader()
+	removed := (leader + 1) % 3
+	c.changeConfig(func(rf *Raft) error { return rf.RemoveServer(removed) })
+	c.crash(removed)
+
+	leader = c.waitForLeader()
+	index, _, ok := c.node(leader).Submit("two-node cluster")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(index, "two-node cluster")
+
+	for _, server := range c.node(leader).Configuration() {
+		if server.ID == removed {
+			t.Errorf("removed server %d is still in the configuration", removed)
+		}
+	}
+}
+
+func TestRemoveLeader(t *testing.T) {
+	c := newCluster(t, 3)
+
+	old := c.waitForLeader()
+	c.changeConfig(func(rf *Raft) error { return rf.RemoveServer(old) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	leader := old
+	for leader == old && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		leader = c.waitForLeader()
+	}
+	if leader == old {
+		t.Fatalf("removed leader %d never stepped down", old)
+	}
+
+	index, _, ok := c.node(leader).Submit("after removal")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	remaining := []int{}
+	for i := range c.nodes {
+		if i != old {
+			remaining = append(remaining, i)
+		}
+	}
+	c.waitForApplied(index, "after removal", remaining...)
+
+	if _, isLeader := c.node(old).GetState(); isLeader {
+		t.Errorf("removed server %d became leader again", old)
+	}
+}
+
+func TestOneConfigChangeAtATime(t *testing.T) {
+	rf := newTestNode(t)
+
+	if err := rf.AddServer(3, "d"); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader from a follower, got %v", err)
+	}
+
+	rf.mu.Lock()
+	rf.currentTerm = 1
+	rf.becomeLeader()
+	rf.mu.Unlock()
+
+	if err := rf.AddServer(3, "d"); !errors.Is(err, ErrConfigChangeInProgress) {
+		t.Errorf("expected ErrConfigChangeInProgress before the no-op commits, got %v", err)
+	}
+
+	rf.mu.Lock()
+	rf.commitIndex = rf.lastLogIndex()
+	rf.mu.Unlock()
+
+	if err := rf.AddServer(3, "d"); err != nil {
+		t.Fatalf("AddServer failed: %v", err)
+	}
+	if err := rf.RemoveServer(1); !errors.Is(err, ErrConfigChangeInProgress) {
+		t.Errorf("expected ErrConfigChangeInProgress while the add is uncommitted, got %v", err)
+	}
+	if config := rf.Configuration(); len(config) != 4 {
+		t.Errorf("expected the new configuration to apply immediately, got %v", config)
+	}
+}
+
+func TestTruncatedConfigEntryIsRolledBack(t *testing.T) {
+	rf := newTestNode(t, LogEntry{Term: 1})
+
+	newConfig := []Server{{ID: 0, Address: "a"}, {ID: 1, Address: "b"}}
+	args := AppendEntriesArgs{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		PrevLogTerm:  1,
+		Entries:      []LogEntry{{Term: 2, Type: ConfigEntry, Config: newConfig}},
+	}
+	var reply AppendEntriesReply
+	if err := rf.AppendEntries(&args, &reply); err != nil || !reply.Success {
+		t.Fatalf("AppendEntries failed: %v %+v", err, reply)
+	}
+	if config := rf.Configuration(); len(config) != 2 {
+		t.Fatalf("expected 2-server configuration, got %v", config)
+	}
+
+	args = AppendEntriesArgs{
+		Term:         3,
+		LeaderId:     2,
+		PrevLogIndex: 1,
+		PrevLogTerm:  1,
+		Entries:      []LogEntry{{Term: 3}},
+	}
+	if err := rf.AppendEntries(&args, &reply); err != nil || !reply.Success {
+		t.Fatalf("AppendEntries failed: %v %+v", err, reply)
+	}
+	if config := rf.Configuration(); len(config) != 3 {
+		t.Errorf("expected the bootstrap configuration back, got %v", config)
+	}
+}
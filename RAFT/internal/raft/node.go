@@ -1,16 +1,26 @@
 package raft
 
 import (
+	"context"
+	"errors"
 	"log"
 	"math/rand"
 	"time"
 )
 
+// ErrStopped is returned by RPC handlers and blocking calls on a node that
+// has been stopped.
+var ErrStopped = errors.New("raft: node stopped")
+
 func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error {
 	rf.mu.Lock()
 	defer rf.mu.Unlock()
 
-	log.Printf("[Node %d] Received RequestVote from %d (Term: %d)", rf.id, args.CandidateId, args.Term)
+	if rf.killed() {
+		return ErrStopped
+	}
+
+	log.Printf("[Node %d] Received RequestVote from %d (Term: %d, PreVote: %v)", rf.id, args.CandidateId, args.Term, args.PreVote)
 
 	if args.Term < rf.currentTerm {
 		reply.Term = rf.currentTerm
@@ -18,25 +28,53 @@ func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) erro
 		return nil
 	}
 
+	// While we still hear from a leader, a candidate is either partitioned
+	// from it or removed from the configuration; ignore it rather than let
+	// its higher term depose a working leader.
+	if rf.hasLeader() && !args.Transfer {
+		reply.Term = rf.currentTerm
+		reply.VoteGranted = false
+		return nil
+	}
+
+	// A pre-vote only predicts the outcome; it changes no state here.
+	if args.PreVote {
+		reply.Term = rf.currentTerm
+		reply.VoteGranted = args.Term > rf.currentTerm && rf.isLogUpToDate(args.LastLogIndex, args.LastLogTerm)
+		return nil
+	}
+
+	changed := false
 	if args.Term > rf.currentTerm {
-		rf.currentTerm = args.Term
-		rf.role = Follower
-		rf.votedFor = -1
+		rf.stepDown(args.Term)
+		changed = true
 	}
 
 	reply.Term = rf.currentTerm
 
-	canVote := rf.votedFor == -1 || rf.votedFor == args.CandidateId
+	// Only vote for candidates whose log holds every entry we have, so a
+	// leader always holds every committed entry.
+	canVote := (rf.votedFor == -1 || rf.votedFor == args.CandidateId) &&
+		rf.isLogUpToDate(args.LastLogIndex, args.LastLogTerm)
 
 	if canVote {
+		changed = changed || rf.votedFor != args.CandidateId
 		rf.votedFor = args.CandidateId
 		rf.lastContact = time.Now()
 		reply.VoteGranted = true
-		log.Printf("[Node %d] Voted for %d in Term %d", rf.id, args.CandidateId, rf.currentTerm)
+		rf.metrics.votesGranted.Add(1)
 	} else {
 		reply.VoteGranted = false
 	}
 
+	if err := rf.persistIf(changed); err != nil {
+		return err
+	}
+
+	if reply.VoteGranted {
+		log.Printf("[Node %d] Voted for %d in Term %d", rf.id, args.CandidateId, rf.currentTerm)
+	}
+
 	return nil
 }
 
@@ -44,6 +82,10 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply
 	rf.mu.Lock()
 	defer rf.mu.Unlock()
 
+	if rf.killed() {
+		return ErrStopped
+	}
+
 	if args.Term < rf.currentTerm {
 		reply.Term = rf.currentTerm
 		reply.Success = false
@@ -52,79 +94,313 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply
 
 	rf.lastContact = time.Now()
 
+	changed := false
 	if args.Term > rf.currentTerm {
-		rf.currentTerm = args.Term
-		rf.role = Follower
-		rf.votedFor = -1
+		rf.stepDown(args.Term)
+		changed = true
 	} else if rf.role == Candidate {
 		rf.role = Follower
 	}
+	rf.leaderId = args.LeaderId
 
 	reply.Term = rf.currentTerm
-	reply.Success = true
+	reply.Success = false
+
+	if args.PrevLogIndex > rf.lastLogIndex() {
+		reply.ConflictTerm = -1
+		reply.ConflictIndex = rf.lastLogIndex() + 1
+		return rf.persistIf(changed)
+	}
+
+	// Entries up to snapshotIndex are committed and already compacted away;
+	// ask the leader to resume right after the snapshot.
+	if args.PrevLogIndex < rf.snapshotIndex {
+		reply.ConflictTerm = -1
+		reply.ConflictIndex = rf.snapshotIndex + 1
+		return rf.persistIf(changed)
+	}
 
+	if rf.termAt(args.PrevLogIndex) != args.PrevLogTerm {
+		reply.ConflictTerm = rf.termAt(args.PrevLogIndex)
+		i := args.PrevLogIndex
+		for i > rf.snapshotIndex+1 && rf.termAt(i-1) == reply.ConflictTerm {
+			i--
+		}
+		reply.ConflictIndex = i
+		return rf.persistIf(changed)
+	}
+
+	for i, entry := range args.Entries {
+		index := args.PrevLogIndex + 1 + i
+		if index <= rf.lastLogIndex() {
+			if rf.termAt(index) == entry.Term {
+				continue
+			}
+			log.Printf("[Node %d] Truncating conflicting entries from index %d", rf.id, index)
+			rf.truncateFrom(index)
+		}
+		rf.log = append(rf.log, args.Entries[i:]...)
+		changed = true
+		break
+	}
+
+	if changed {
+		rf.reloadConfig()
+	}
+
+	if err := rf.persistIf(changed); err != nil {
+		return err
+	}
+
+	// Only the prefix this request matched is known to agree with the
+	// leader. A delayed heartbeat may name an earlier PrevLogIndex than
+	// entries this node already took from the same leader, so commitIndex
+	// only ever moves up.
+	if commit := min(args.LeaderCommit, args.PrevLogIndex+len(args.Entries)); commit > rf.commitIndex {
+		rf.commitIndex = commit
+		rf.applyCond.Signal()
+	}
+
+	reply.Success = true
 	return nil
 }
 
+// GetState returns the current term and whether this node believes it is
+// the leader.
+func (rf *Raft) GetState() (int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.currentTerm, rf.role == Leader
+}
+
+// Leader returns the ID of the leader of the current term as far as this
+// node knows, or -1. Followers use it to redirect clients.
+func (rf *Raft) Leader() int {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.leaderId
+}
+
+// hasLeader reports whether this node is the leader or heard from one within
+// the minimum election timeout. Callers must hold rf.mu.
+func (rf *Raft) hasLeader() bool {
+	if rf.role == Leader {
+		return true
+	}
+	return rf.leaderId != -1 && time.Since(rf.lastContact) < rf.election
+}
+
 func (rf *Raft) Start() {
 	rf.mu.Lock()
 	rf.lastContact = time.Now()
 	rf.mu.Unlock()
+
+	rf.wg.Add(2)
 	go rf.ticker()
+	go rf.applier()
+}
+
+// Stop shuts the node down. The ticker and applier exit, RPCs in flight are
+// abandoned, RPC handlers refuse further requests and applyCh is closed, so
+// a service ranging over it finishes too. Stop may be called more than once
+// and from several goroutines; every call returns once the node has stopped.
+func (rf *Raft) Stop() {
+	rf.stopOnce.Do(func() {
+		rf.mu.Lock()
+		rf.cancel()
+		rf.role = Follower
+		rf.leaderId = -1
+		rf.applyCond.Broadcast()
+		rf.readCond.Broadcast()
+		rf.mu.Unlock()
+
+		rf.wg.Wait()
+		close(rf.applyCh)
+		log.Printf("[Node %d] Stopped", rf.id)
+	})
+}
+
+// killed reports whether Stop has been called.
+func (rf *Raft) killed() bool {
+	return rf.ctx.Err() != nil
 }
 
 func (rf *Raft) ticker() {
+	defer rf.wg.Done()
+
 	for {
 		rf.mu.Lock()
 		role := rf.role
 		lastContact := rf.lastContact
 		rf.mu.Unlock()
 
+		var wait time.Duration
 		switch role {
 		case Follower, Candidate:
 			timeout := rf.randomElectionTimeout()
 			if time.Since(lastContact) > timeout {
 				rf.startElection()
 			}
-			time.Sleep(20 * time.Millisecond)
+			wait = 20 * time.Millisecond
 		case Leader:
-			rf.sendHeartbeats()
-			time.Sleep(rf.heartbeat)
+			rf.checkQuorum()
+			rf.broadcastAppendEntries()
+			wait = rf.heartbeat
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-rf.ctx.Done():
+			return
 		}
 	}
 }
 
+// call runs rpc against the transport, counting failures. The context is
+// cancelled by Stop, which abandons RPCs in flight.
+func (rf *Raft) call(rpc func(ctx context.Context) error) bool {
+	if err := rpc(rf.ctx); err != nil {
+		if rf.ctx.Err() == nil {
+			rf.metrics.rpcFailures.Add(1)
+		}
+		return false
+	}
+	return true
+}
+
 func (rf *Raft) randomElectionTimeout() time.Duration {
 	r := rand.Intn(150)
 	return rf.election + time.Duration(r)*time.Millisecond
 }
 
+// startElection runs a pre-vote before campaigning: only if a majority
+// would vote for us in the next term do we actually increment currentTerm.
+// A node that cannot win, such as one cut off from the rest of the cluster,
+// therefore never inflates its term and disrupts the leader when it
+// reconnects.
 func (rf *Raft) startElection() {
 	rf.mu.Lock()
+	// Learners and servers outside the configuration (joining or removed)
+	// never campaign.
+	if !rf.isVoter(rf.id) {
+		rf.lastContact = time.Now()
+		rf.mu.Unlock()
+		return
+	}
+
+	// Having timed out, we no longer believe in the old leader; otherwise
+	// hasLeader would keep us rejecting other pre-votes after our own fails.
+	rf.leaderId = -1
+	rf.lastContact = time.Now()
+	if rf.quorum() == 1 {
+		rf.campaign(false)
+		rf.mu.Unlock()
+		return
+	}
+
+	term := rf.currentTerm
+	config := rf.config
+	quorum := rf.quorum()
+	id := rf.id
+	args := RequestVoteArgs{
+		Term:         term + 1,
+		CandidateId:  id,
+		LastLogIndex: rf.lastLogIndex(),
+		LastLogTerm:  rf.lastLogTerm(),
+		PreVote:      true,
+	}
+	rf.mu.Unlock()
+
+	log.Printf("[Node %d] Starting pre-vote for Term %d", id, term+1)
+
+	votes := 1
+	for _, server := range config {
+		if server.ID == id || server.Learner {
+			continue
+		}
+
+		go func(peerAddr string) {
+			var reply RequestVoteReply
+			if !rf.call(func(ctx context.Context) error {
+				return rf.transport.RequestVote(ctx, peerAddr, &args, &reply)
+			}) {
+				return
+			}
+
+			rf.mu.Lock()
+			defer rf.mu.Unlock()
+
+			if reply.Term > rf.currentTerm {
+				rf.stepDown(reply.Term)
+				rf.persistOrLog()
+				return
+			}
+
+			// A leader may have made itself known while the pre-vote was
+			// out, in which case there is nothing to campaign for.
+			if rf.hasLeader() || rf.currentTerm != term || !reply.VoteGranted {
+				return
+			}
+
+			votes++
+			if votes == quorum {
+				rf.campaign(false)
+			}
+		}(server.Address)
+	}
+}
+
+// campaign starts a real election in the next term. transfer is set when the
+// leader asked for the election through TimeoutNow. Callers must hold rf.mu.
+func (rf *Raft) campaign(transfer bool) {
+	if rf.killed() {
+		return
+	}
 	rf.role = Candidate
 	rf.currentTerm++
 	rf.votedFor = rf.id
+	rf.leaderId = -1
 	rf.lastContact = time.Now()
 	term := rf.currentTerm
-	peers := rf.peers
+	config := rf.config
+	quorum := rf.quorum()
 	id := rf.id
-	rf.mu.Unlock()
+	lastLogIndex := rf.lastLogIndex()
+	lastLogTerm := rf.lastLogTerm()
+	if err := rf.persist(); err != nil {
+		// Without a durable vote for ourselves we could vote for someone
+		// else in this term after a restart, so do not campaign.
+		log.Printf("[Node %d] Failed to persist state, abandoning election: %v", id, err)
+		return
+	}
+	rf.metrics.electionsStarted.Add(1)
+	if quorum == 1 {
+		rf.becomeLeader()
+		return
+	}
 
-	log.Printf("[Node %d] Starting election for Term %d", rf.id, term)
+	log.Printf("[Node %d] Starting election for Term %d", id, term)
 
 	votes := 1
-	for i, addr := range peers {
-		if i == id {
+	for _, server := range config {
+		if server.ID == id || server.Learner {
 			continue
 		}
 
 		go func(peerAddr string) {
 			args := RequestVoteArgs{
-				Term:        term,
-				CandidateId: id,
+				Term:         term,
+				CandidateId:  id,
+				LastLogIndex: lastLogIndex,
+				LastLogTerm:  lastLogTerm,
+				Transfer:     transfer,
 			}
 			var reply RequestVoteReply
-			if rf.sendRPC(peerAddr, "Raft.RequestVote", &args, &reply) {
+			if rf.call(func(ctx context.Context) error {
+				return rf.transport.RequestVote(ctx, peerAddr, &args, &reply)
+			}) {
 				rf.mu.Lock()
 				defer rf.mu.Unlock()
 
@@ -133,61 +409,98 @@ func (rf *Raft) startElection() {
 				}
 
 				if reply.Term > rf.currentTerm {
-					rf.currentTerm = reply.Term
-					rf.role = Follower
-					rf.votedFor = -1
+					rf.stepDown(reply.Term)
+					rf.persistOrLog()
 					return
 				}
 
 				if reply.VoteGranted {
 					votes++
-					if votes > len(peers)/2 {
-						log.Printf("[Node %d] Became LEADER for Term %d", rf.id, rf.currentTerm)
-						rf.role = Leader
-						rf.nextIndex = make([]int, len(peers))
-						rf.matchIndex = make([]int, len(peers))
-						for i := range rf.nextIndex {
-							rf.nextIndex[i] = len(rf.log)
-						}
+					if votes >= quorum {
+						rf.becomeLeader()
 					}
 				}
 			}
-		}(addr)
+		}(server.Address)
 	}
 }
 
-func (rf *Raft) sendHeartbeats() {
+// becomeLeader takes over as leader and appends a no-op entry, which lets
+// the new leader commit an entry from its own term (and with it every
+// earlier entry) without waiting for a client command. Callers must hold
+// rf.mu.
+func (rf *Raft) becomeLeader() {
+	log.Printf("[Node %d] Became LEADER for Term %d", rf.id, rf.currentTerm)
+	rf.role = Leader
+	rf.leaderId = rf.id
+	rf.transferTarget = -1
+	rf.nextIndex = make(map[int]int)
+	rf.matchIndex = make(map[int]int)
+	rf.lastAck = make(map[int]time.Time)
+	rf.progress = make(map[int]*progress)
+	rf.trackPeers()
+
+	rf.log = append(rf.log, LogEntry{Term: rf.currentTerm, Type: NoopEntry})
+	if err := rf.persist(); err != nil {
+		log.Printf("[Node %d] Failed to persist no-op entry: %v", rf.id, err)
+		rf.truncateFrom(rf.lastLogIndex())
+	}
+
+	rf.matchIndex[rf.id] = rf.lastLogIndex()
+	rf.nextIndex[rf.id] = rf.lastLogIndex() + 1
+	rf.advanceCommitIndex()
+}
+
+// checkQuorum steps down a leader that has not heard back from a majority of
+// the configuration within the minimum election timeout. By then the rest of
+// the cluster may have elected someone else, and since followers ignore
+// candidates while they hear from a leader, a leader that lingered on could
+// keep clients waiting on a minority forever.
+func (rf *Raft) checkQuorum() {
 	rf.mu.Lock()
-	term := rf.currentTerm
-	peers := rf.peers
-	id := rf.id
-	rf.mu.Unlock()
+	defer rf.mu.Unlock()
 
-	for i, addr := range peers {
-		if i == id {
-			continue
-		}
+	if rf.role != Leader {
+		return
+	}
 
-		go func(peerAddr string) {
-			args := AppendEntriesArgs{
-				Term:     term,
-				LeaderId: id,
-			}
-			var reply AppendEntriesReply
-			if rf.sendRPC(peerAddr, "Raft.AppendEntries", &args, &reply) {
-				rf.mu.Lock()
-				defer rf.mu.Unlock()
+	if rf.ackedSince(time.Now().Add(-rf.election)) < rf.quorum() {
+		log.Printf("[Node %d] Lost contact with a majority, stepping down in Term %d", rf.id, rf.currentTerm)
+		rf.role = Follower
+		rf.leaderId = -1
+		rf.lastContact = time.Now()
+	}
+}
 
-				if rf.role != Leader || rf.currentTerm != term {
-					return
-				}
+// recordAck notes that peer answered a request sent at sent in the current
+// term. Callers must hold rf.mu.
+func (rf *Raft) recordAck(peer int, sent time.Time) {
+	if sent.After(rf.lastAck[peer]) {
+		rf.lastAck[peer] = sent
+	}
+	rf.readCond.Broadcast()
+}
 
-				if reply.Term > rf.currentTerm {
-					rf.currentTerm = reply.Term
-					rf.role = Follower
-					rf.votedFor = -1
-				}
-			}
-		}(addr)
+// ackedSince counts the voters that have answered a request sent at or
+// after t, including the leader itself. Callers must hold rf.mu.
+func (rf *Raft) ackedSince(t time.Time) int {
+	count := 0
+	for _, server := range rf.config {
+		if server.Learner {
+			continue
+		}
+		if server.ID == rf.id || !rf.lastAck[server.ID].Before(t) {
+			count++
+		}
 	}
+	return count
+}
+
+// stepDown moves to a newer term as a follower. Callers must hold rf.mu.
+func (rf *Raft) stepDown(term int) {
+	rf.currentTerm = term
+	rf.role = rf.followerRole()
+	rf.votedFor = -1
+	rf.leaderId = -1
+	rf.transferTarget = -1
 }
@@ -0,0 +1,180 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+var noRPC = CallTransport(func(string, string, interface{}, interface{}) bool { return false })
+
+func newTestNode(t *testing.T, entries ...LogEntry) *Raft {
+	rf, err := NewRaft(0, []string{"a", "b", "c"}, noRPC, make(chan ApplyMsg), storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	rf.log = append(rf.log, entries...)
+	rf.currentTerm = rf.lastLogTerm()
+	return rf
+}
+
+func TestRequestVoteElectionRestriction(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastLogIndex int
+		lastLogTerm  int
+		granted      bool
+	}{
+		{"older last term", 5, 1, false},
+		{"same term shorter log", 1, 2, false},
+		{"same term same length", 2, 2, true},
+		{"same term longer log", 3, 2, true},
+		{"newer last term", 1, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rf := newTestNode(t, LogEntry{Term: 1}, LogEntry{Term: 2})
+
+			var reply RequestVoteReply
+			args := RequestVoteArgs{
+				Term:         3,
+				CandidateId:  1,
+				LastLogIndex: tt.lastLogIndex,
+				LastLogTerm:  tt.lastLogTerm,
+			}
+			if err := rf.RequestVote(&args, &reply); err != nil {
+				t.Fatalf("RequestVote failed: %v", err)
+			}
+			if reply.VoteGranted != tt.granted {
+				t.Errorf("expected VoteGranted=%v, got %v", tt.granted, reply.VoteGranted)
+			}
+			if reply.Term != 3 {
+				t.Errorf("expected node to adopt term 3, got %d", reply.Term)
+			}
+		})
+	}
+}
+
+func TestAppendEntriesConflictHint(t *testing.T) {
+	tests := []struct {
+		name          string
+		prevLogIndex  int
+		prevLogTerm   int
+		success       bool
+		conflictTerm  int
+		conflictIndex int
+	}{
+		{"log too short", 8, 2, false, -1, 6},
+		{"mismatch names first index of the term", 4, 3, false, 2, 3},
+		{"mismatch in the first term", 2, 2, false, 1, 1},
+		{"match", 5, 2, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rf := newTestNode(t, LogEntry{Term: 1}, LogEntry{Term: 1}, LogEntry{Term: 2}, LogEntry{Term: 2}, LogEntry{Term: 2})
+
+			var reply AppendEntriesReply
+			args := AppendEntriesArgs{
+				Term:         2,
+				LeaderId:     1,
+				PrevLogIndex: tt.prevLogIndex,
+				PrevLogTerm:  tt.prevLogTerm,
+			}
+			if err := rf.AppendEntries(&args, &reply); err != nil {
+				t.Fatalf("AppendEntries failed: %v", err)
+			}
+			if reply.Success != tt.success {
+				t.Fatalf("expected Success=%v, got %v", tt.success, reply.Success)
+			}
+			if !tt.success && (reply.ConflictTerm != tt.conflictTerm || reply.ConflictIndex != tt.conflictIndex) {
+				t.Errorf("expected conflict term %d at %d, got term %d at %d", tt.conflictTerm, tt.conflictIndex, reply.ConflictTerm, reply.ConflictIndex)
+			}
+		})
+	}
+}
+
+func TestStaleHeartbeatKeepsCommitIndex(t *testing.T) {
+	rf := newTestNode(t)
+
+	// A batch appends three entries and commits two of them.
+	batch := AppendEntriesArgs{
+		Term:         1,
+		LeaderId:     1,
+		Entries:      []LogEntry{{Term: 1}, {Term: 1}, {Term: 1}},
+		LeaderCommit: 2,
+	}
+	var reply AppendEntriesReply
+	if err := rf.AppendEntries(&batch, &reply); err != nil || !reply.Success {
+		t.Fatalf("batch rejected: success=%v err=%v", reply.Success, err)
+	}
+	if rf.commitIndex != 2 {
+		t.Fatalf("commitIndex is %d after the batch, want 2", rf.commitIndex)
+	}
+
+	// A heartbeat sent before the batch was acknowledged still names an
+	// earlier entry as its predecessor.
+	heartbeat := AppendEntriesArgs{
+		Term:         1,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		PrevLogTerm:  1,
+		LeaderCommit: 3,
+	}
+	if err := rf.AppendEntries(&heartbeat, &reply); err != nil || !reply.Success {
+		t.Fatalf("heartbeat rejected: success=%v err=%v", reply.Success, err)
+	}
+	if rf.commitIndex != 2 {
+		t.Errorf("stale heartbeat moved commitIndex to %d, want 2", rf.commitIndex)
+	}
+}
+
+func TestCommittedEntriesAreApplied(t *testing.T) {
+	applyCh := make(chan ApplyMsg)
+	rf, err := NewRaft(0, []string{"a", "b", "c"}, noRPC, applyCh, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	rf.wg.Add(1)
+	go rf.applier()
+	defer rf.Stop()
+
+	expect := func(index int, command string) {
+		t.Helper()
+		select {
+		case msg := <-applyCh:
+			if msg.Index != index || msg.Term != 1 || msg.Command != command {
+				t.Fatalf("applied %v at %d (term %d), want %q at %d (term 1)", msg.Command, msg.Index, msg.Term, command, index)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q was not applied", command)
+		}
+	}
+
+	args := AppendEntriesArgs{
+		Term:         1,
+		LeaderId:     1,
+		Entries:      []LogEntry{{Term: 1, Command: "x"}, {Term: 1, Command: "y"}},
+		LeaderCommit: 1,
+	}
+	var reply AppendEntriesReply
+	if err := rf.AppendEntries(&args, &reply); err != nil || !reply.Success {
+		t.Fatalf("AppendEntries rejected: success=%v err=%v", reply.Success, err)
+	}
+	expect(1, "x")
+
+	// Only committed entries are delivered.
+	select {
+	case msg := <-applyCh:
+		t.Fatalf("applied uncommitted entry %d", msg.Index)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	heartbeat := AppendEntriesArgs{Term: 1, LeaderId: 1, PrevLogIndex: 2, PrevLogTerm: 1, LeaderCommit: 2}
+	if err := rf.AppendEntries(&heartbeat, &reply); err != nil || !reply.Success {
+		t.Fatalf("heartbeat rejected: success=%v err=%v", reply.Success, err)
+	}
+	expect(2, "y")
+}
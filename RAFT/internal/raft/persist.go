@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+// persistentState is the part of Raft's state that must survive a crash
+// (Figure 2 of the Raft paper), plus where the log starts after compaction.
+// Commands stored in the log are encoded with gob, so their concrete types
+// must be registered with gob.Register.
+type persistentState struct {
+	CurrentTerm    int
+	VotedFor       int
+	Log            []LogEntry
+	SnapshotIndex  int
+	SnapshotConfig []Server
+}
+
+// persistentSnapshot wraps the service's snapshot with the position it
+// covers, so a snapshot saved just before a crash can be reconciled with an
+// older state on restart.
+type persistentSnapshot struct {
+	Index  int
+	Term   int
+	Config []Server
+	Data   []byte
+}
+
+func (rf *Raft) encodeState() ([]byte, error) {
+	var buf bytes.Buffer
+	state := persistentState{
+		CurrentTerm:    rf.currentTerm,
+		VotedFor:       rf.votedFor,
+		Log:            rf.log,
+		SnapshotIndex:  rf.snapshotIndex,
+		SnapshotConfig: rf.snapshotConfig,
+	}
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// persist writes currentTerm, votedFor and the log to stable storage. It has
+// to succeed before the node answers an RPC that depends on the change.
+// Callers must hold rf.mu.
+func (rf *Raft) persist() error {
+	state, err := rf.encodeState()
+	if err != nil {
+		return err
+	}
+	return rf.persister.SaveState(state)
+}
+
+// persistWithSnapshot is persist for when the snapshot changed as well.
+// Callers must hold rf.mu.
+func (rf *Raft) persistWithSnapshot() error {
+	state, err := rf.encodeState()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	snapshot := persistentSnapshot{
+		Index:  rf.snapshotIndex,
+		Term:   rf.snapshotTerm(),
+		Config: rf.snapshotConfig,
+		Data:   rf.snapshot,
+	}
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return err
+	}
+
+	return rf.persister.SaveStateAndSnapshot(state, buf.Bytes())
+}
+
+// persistOrLog is used where there is no caller to report a failure to.
+// Losing one of these writes only makes the node forget a newer term, which
+// is safe. Callers must hold rf.mu.
+func (rf *Raft) persistOrLog() {
+	if err := rf.persist(); err != nil {
+		log.Printf("[Node %d] Failed to persist state: %v", rf.id, err)
+	}
+}
+
+func (rf *Raft) persistIf(changed bool) error {
+	if !changed {
+		return nil
+	}
+	return rf.persist()
+}
+
+func (rf *Raft) readPersist() error {
+	data, err := rf.persister.ReadState()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		var state persistentState
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+			return err
+		}
+
+		rf.currentTerm = state.CurrentTerm
+		rf.votedFor = state.VotedFor
+		rf.log = state.Log
+		rf.snapshotIndex = state.SnapshotIndex
+		rf.snapshotConfig = state.SnapshotConfig
+	}
+
+	data, err = rf.persister.ReadSnapshot()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		var snapshot persistentSnapshot
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+			return err
+		}
+
+		// We crashed between writing the snapshot and the state.
+		if snapshot.Index > rf.snapshotIndex {
+			rf.compactTo(snapshot.Index, snapshot.Term, snapshot.Config)
+		}
+		rf.snapshot = snapshot.Data
+	}
+
+	rf.reloadConfig()
+
+	// Everything in the snapshot is committed; the applier hands it to the
+	// service before any entries.
+	rf.commitIndex = rf.snapshotIndex
+	return nil
+}
@@ -0,0 +1,94 @@
+package raft
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+func TestRestartRemembersTermAndVote(t *testing.T) {
+	persister := storage.NewMemoryPersister()
+	noRPC := CallTransport(func(string, string, interface{}, interface{}) bool { return false })
+
+	rf, err := NewRaft(0, []string{"a", "b", "c"}, noRPC, make(chan ApplyMsg), persister)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	var reply RequestVoteReply
+	if err := rf.RequestVote(&RequestVoteArgs{Term: 3, CandidateId: 1}, &reply); err != nil {
+		t.Fatalf("RequestVote failed: %v", err)
+	}
+	if !reply.VoteGranted {
+		t.Fatalf("expected vote to be granted to node 1")
+	}
+
+	restarted, err := NewRaft(0, []string{"a", "b", "c"}, noRPC, make(chan ApplyMsg), persister.Copy())
+	if err != nil {
+		t.Fatalf("failed to restart node: %v", err)
+	}
+	if term, _ := restarted.GetState(); term != 3 {
+		t.Errorf("expected restored term 3, got %d", term)
+	}
+
+	reply = RequestVoteReply{}
+	if err := restarted.RequestVote(&RequestVoteArgs{Term: 3, CandidateId: 2}, &reply); err != nil {
+		t.Fatalf("RequestVote failed: %v", err)
+	}
+	if reply.VoteGranted {
+		t.Errorf("restarted node voted twice in term 3")
+	}
+}
+
+func TestCrashRestartMidElection(t *testing.T) {
+	c := newCluster(t, 3)
+
+	// The cluster monitor fails the test if two nodes lead the same term.
+	for round := 0; round < 6; round++ {
+		time.Sleep(time.Duration(rand.Intn(400)) * time.Millisecond)
+
+		i := rand.Intn(3)
+		term, _ := c.node(i).GetState()
+		c.crash(i)
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Millisecond)
+		c.start(i)
+
+		if restored, _ := c.node(i).GetState(); restored < term {
+			t.Errorf("node %d restarted at term %d after crashing at term %d", i, restored, term)
+		}
+	}
+
+	c.waitForLeader()
+}
+
+func TestCommittedEntriesSurviveFullRestart(t *testing.T) {
+	c := newCluster(t, 3)
+
+	leader := c.waitForLeader()
+	index, _, ok := c.node(leader).Submit("first")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(index, "first")
+
+	for i := range c.nodes {
+		c.crash(i)
+	}
+	for i := range c.nodes {
+		c.start(i)
+	}
+
+	leader = c.waitForLeader()
+	second, _, ok := c.node(leader).Submit("second")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	if second <= index {
+		t.Errorf("second command reused index %d after restart", second)
+	}
+
+	c.waitForApplied(second, "second")
+	c.waitForApplied(index, "first")
+}
@@ -0,0 +1,101 @@
+package raft
+
+import (
+	"log"
+	"time"
+)
+
+// leaseFraction is how much of the minimum election timeout a leader trusts
+// as its lease. The remainder absorbs clock drift between servers.
+const leaseFraction = 0.9
+
+// SetLeaseReads switches ReadIndex between confirming leadership with a
+// heartbeat round on every call (the default) and trusting a lease: for a
+// little less than the election timeout after a majority acknowledged a
+// heartbeat, no other leader can be elected, because followers ignore
+// candidates while they hear from a leader. Lease reads save a round trip
+// but are only safe if clocks on different servers advance at nearly the
+// same rate.
+func (rf *Raft) SetLeaseReads(enabled bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	rf.leaseReads = enabled
+}
+
+// ReadIndex lets a service serve a read without appending it to the log
+// (Raft thesis §6.4). It confirms this node is still the leader and returns
+// an index such that once the service has applied everything up to it, its
+// state reflects every write committed before ReadIndex was called. The
+// index is always one the service observes, either as a command or as a
+// snapshot, since no-op and configuration entries are not delivered.
+//
+// ReadIndex blocks until those entries have been handed to the service; the
+// service must still wait until it has processed them. It returns
+// ErrNotLeader if this node is not the leader or cannot confirm it within
+// an election timeout.
+func (rf *Raft) ReadIndex() (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.role != Leader {
+		return -1, ErrNotLeader
+	}
+	term := rf.currentTerm
+	start := time.Now()
+
+	lease := time.Duration(float64(rf.election) * leaseFraction)
+	if !rf.leaseHeld(lease) {
+		go rf.broadcastAppendEntries()
+	}
+
+	// Nothing wakes readCond when the deadline passes, so arrange for it.
+	timer := time.AfterFunc(rf.election, func() {
+		rf.mu.Lock()
+		defer rf.mu.Unlock()
+		rf.readCond.Broadcast()
+	})
+	defer timer.Stop()
+
+	// Until the leader commits an entry from its own term (the no-op from
+	// becomeLeader) it may not know about everything already committed.
+	for !rf.readConfirmed(start, lease) || rf.termAt(rf.commitIndex) != term {
+		if rf.role != Leader || rf.currentTerm != term || time.Since(start) >= rf.election {
+			log.Printf("[Node %d] Could not confirm leadership for read in Term %d", rf.id, term)
+			return -1, ErrNotLeader
+		}
+		rf.readCond.Wait()
+	}
+
+	index := rf.commitIndex
+	for index > rf.snapshotIndex && rf.entry(index).Type != CommandEntry {
+		index--
+	}
+
+	for rf.lastApplied < index {
+		if rf.killed() {
+			return -1, ErrStopped
+		}
+		rf.readCond.Wait()
+	}
+	return index, nil
+}
+
+// readConfirmed reports whether a majority has acknowledged this leader
+// after a read that started at start, or, with lease reads, recently enough
+// that the lease still holds. Callers must hold rf.mu.
+func (rf *Raft) readConfirmed(start time.Time, lease time.Duration) bool {
+	return rf.ackedSince(start) >= rf.quorum() || rf.leaseHeld(lease)
+}
+
+// leaseHeld reports whether lease reads are on and a majority acknowledged
+// this leader within the last lease. A leader handing over leadership holds
+// no lease: TimeoutNow lets the target win votes from followers that still
+// hear from this leader, so it may lead before the lease runs out. Callers
+// must hold rf.mu.
+func (rf *Raft) leaseHeld(lease time.Duration) bool {
+	if !rf.leaseReads || rf.transferTarget != -1 {
+		return false
+	}
+	return rf.ackedSince(time.Now().Add(-lease)) >= rf.quorum()
+}
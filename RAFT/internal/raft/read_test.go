@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadIndexCoversCommittedWrites(t *testing.T) {
+	c := newCluster(t, 3)
+
+	index := c.one("write", 3)
+
+	leader := c.waitForLeader()
+	readIndex, err := c.node(leader).ReadIndex()
+	if err != nil {
+		t.Fatalf("ReadIndex on leader %d failed: %v", leader, err)
+	}
+	if readIndex < index {
+		t.Fatalf("ReadIndex returned %d, before committed write at %d", readIndex, index)
+	}
+
+	follower := (leader + 1) % 3
+	if _, err := c.node(follower).ReadIndex(); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("ReadIndex on follower %d returned %v, want ErrNotLeader", follower, err)
+	}
+}
+
+// TestReadIndexSkipsNoops checks the returned index is one the service will
+// see, even when the newest committed entry is the leader's no-op.
+func TestReadIndexSkipsNoops(t *testing.T) {
+	c := newCluster(t, 3)
+
+	index := c.one("write", 3)
+
+	leader := c.waitForLeader()
+	c.crash(leader)
+	c.start(leader)
+	leader = c.waitForLeader()
+
+	readIndex, err := c.node(leader).ReadIndex()
+	if err != nil {
+		t.Fatalf("ReadIndex on leader %d failed: %v", leader, err)
+	}
+	if readIndex != index {
+		t.Fatalf("ReadIndex returned %d, want last command index %d", readIndex, index)
+	}
+}
+
+func TestReadIndexFailsWithoutQuorum(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("write", 3)
+	leader := c.waitForLeader()
+	c.partition([]int{leader}, []int{(leader + 1) % 3, (leader + 2) % 3})
+
+	if _, err := c.node(leader).ReadIndex(); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("isolated leader served a read: %v", err)
+	}
+}
+
+func TestLeaseReadExpires(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("write", 3)
+	leader := c.waitForLeader()
+	c.node(leader).SetLeaseReads(true)
+	time.Sleep(200 * time.Millisecond)
+
+	// Heartbeats just went out, so the lease outlives the partition for a
+	// moment and the read needs no round trip.
+	c.partition([]int{leader}, []int{(leader + 1) % 3, (leader + 2) % 3})
+	if _, err := c.node(leader).ReadIndex(); err != nil {
+		t.Fatalf("read within the lease failed: %v", err)
+	}
+
+	time.Sleep(c.node(leader).election)
+	if _, err := c.node(leader).ReadIndex(); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("read after the lease expired returned %v, want ErrNotLeader", err)
+	}
+}
+
+// TestLeaseReadDuringTransfer checks a leader handing over leadership stops
+// trusting its lease, since the target may already lead, but can still
+// serve reads it confirms with a heartbeat round.
+func TestLeaseReadDuringTransfer(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("write", 3)
+	leader := c.waitForLeader()
+	target := (leader + 1) % 3
+	other := (leader + 2) % 3
+	rf := c.node(leader)
+	rf.SetLeaseReads(true)
+	time.Sleep(200 * time.Millisecond)
+
+	// With the target unreachable the transfer stays in progress until it
+	// times out.
+	c.disconnect(target)
+	done := make(chan error, 1)
+	go func() { done <- rf.TransferLeadership(target) }()
+	for {
+		rf.mu.Lock()
+		transferring := rf.transferTarget == target
+		rf.mu.Unlock()
+		if transferring {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := rf.ReadIndex(); err != nil {
+		t.Fatalf("read confirmed by %d during the transfer failed: %v", other, err)
+	}
+
+	c.disconnect(other)
+	if _, err := rf.ReadIndex(); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("read during the transfer returned %v, want ErrNotLeader", err)
+	}
+	if err := <-done; !errors.Is(err, ErrTransferTimeout) {
+		t.Fatalf("transfer to disconnected node returned %v, want ErrTransferTimeout", err)
+	}
+}
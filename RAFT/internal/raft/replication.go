@@ -0,0 +1,372 @@
+package raft
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Submit appends command to the leader's log and starts replicating it.
+// It returns the index the command will occupy if it is ever committed, the
+// current term, and whether this node believes it is the leader. Submit does
+// not wait for the command to commit. A leader handing over leadership
+// refuses new commands, since they would only delay the transfer.
+func (rf *Raft) Submit(command interface{}) (int, int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.role != Leader || rf.transferTarget != -1 {
+		return -1, rf.currentTerm, false
+	}
+
+	rf.log = append(rf.log, LogEntry{Term: rf.currentTerm, Command: command})
+	index := rf.lastLogIndex()
+	if err := rf.persist(); err != nil {
+		log.Printf("[Node %d] Failed to persist command: %v", rf.id, err)
+		rf.truncateFrom(index)
+		return -1, rf.currentTerm, false
+	}
+	rf.matchIndex[rf.id] = index
+	rf.nextIndex[rf.id] = index + 1
+	rf.advanceCommitIndex()
+
+	log.Printf("[Node %d] Appended command at index %d (Term: %d)", rf.id, index, rf.currentTerm)
+
+	rf.replicateAll()
+
+	return index, rf.currentTerm, true
+}
+
+// Replication is flow controlled per peer, much like etcd's raft. A peer
+// starts in probe mode, where a single AppendEntries is outstanding at a
+// time while the leader looks for the point where the logs agree. Once one
+// succeeds the peer moves to pipelined mode: the leader sends the next
+// batch of up to maxEntries entries without waiting for replies, advancing
+// nextIndex optimistically, with up to window requests in flight. Entries
+// submitted while the window is full wait and go out together in one batch
+// as replies free it up. A rejection or lost request drops the peer back to
+// probe mode, resuming from the conflict hint or its matchIndex.
+type progress struct {
+	probing  bool
+	inflight int
+	// epoch changes whenever the peer drops back to probe mode, so that
+	// replies to requests sent before then do not touch inflight.
+	epoch int
+}
+
+// SetPipeline sets how many AppendEntries may be in flight to each peer and
+// how many entries each may carry. A window of 1 disables pipelining.
+func (rf *Raft) SetPipeline(window int, maxEntries int) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	rf.window = max(1, window)
+	rf.maxEntries = max(1, maxEntries)
+}
+
+// broadcastAppendEntries runs on every heartbeat tick. Each peer gets new
+// entries if flow control allows, and an empty heartbeat otherwise, so that
+// followers hear from the leader even while their window is full.
+func (rf *Raft) broadcastAppendEntries() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.role != Leader {
+		return
+	}
+	for _, server := range rf.config {
+		if server.ID == rf.id {
+			continue
+		}
+		if !rf.replicate(server.ID) {
+			rf.sendHeartbeat(server.ID)
+		}
+	}
+}
+
+// replicateAll pushes new entries to every peer. Callers must hold rf.mu.
+func (rf *Raft) replicateAll() {
+	for _, server := range rf.config {
+		if server.ID != rf.id {
+			rf.replicate(server.ID)
+		}
+	}
+}
+
+// replicate sends peer as many AppendEntries as flow control allows and
+// reports whether it sent anything. Followers that need entries we have
+// already compacted get the snapshot instead. Callers must hold rf.mu.
+func (rf *Raft) replicate(peer int) bool {
+	pr, ok := rf.progress[peer]
+	peerAddr, member := rf.addressOf(peer)
+	if rf.role != Leader || !ok || !member {
+		return false
+	}
+
+	if rf.nextIndex[peer] <= rf.snapshotIndex {
+		if pr.inflight > 0 {
+			return false
+		}
+		args := InstallSnapshotArgs{
+			Term:              rf.currentTerm,
+			LeaderId:          rf.id,
+			LastIncludedIndex: rf.snapshotIndex,
+			LastIncludedTerm:  rf.snapshotTerm(),
+			Config:            rf.snapshotConfig,
+			Data:              rf.snapshot,
+		}
+		pr.inflight++
+		go rf.sendSnapshot(peer, peerAddr, &args, pr.epoch)
+		return true
+	}
+
+	sent := false
+	for {
+		if pr.probing && pr.inflight > 0 {
+			return sent
+		}
+		if !pr.probing && (pr.inflight >= rf.window || rf.nextIndex[peer] > rf.lastLogIndex()) {
+			return sent
+		}
+
+		prevLogIndex := rf.nextIndex[peer] - 1
+		args := AppendEntriesArgs{
+			Term:         rf.currentTerm,
+			LeaderId:     rf.id,
+			PrevLogIndex: prevLogIndex,
+			PrevLogTerm:  rf.termAt(prevLogIndex),
+			Entries:      rf.entriesFrom(prevLogIndex+1, rf.maxEntries),
+			LeaderCommit: rf.commitIndex,
+		}
+		pr.inflight++
+		if !pr.probing {
+			rf.nextIndex[peer] += len(args.Entries)
+		}
+		go rf.sendAppendEntries(peer, peerAddr, &args, pr.epoch, false)
+		sent = true
+
+		if pr.probing {
+			return sent
+		}
+	}
+}
+
+// sendHeartbeat sends an empty AppendEntries that asserts leadership and
+// carries the commit index without affecting flow control. It claims only
+// what the peer is known to hold, so it does not fail just because
+// pipelined entries before it are still in flight. Callers must hold rf.mu.
+func (rf *Raft) sendHeartbeat(peer int) {
+	peerAddr, ok := rf.addressOf(peer)
+	if !ok {
+		return
+	}
+	prevLogIndex := max(rf.matchIndex[peer], rf.snapshotIndex)
+	args := AppendEntriesArgs{
+		Term:         rf.currentTerm,
+		LeaderId:     rf.id,
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm:  rf.termAt(prevLogIndex),
+		LeaderCommit: rf.commitIndex,
+	}
+	go rf.sendAppendEntries(peer, peerAddr, &args, rf.progress[peer].epoch, true)
+}
+
+// sendAppendEntries sends one request built by replicate or sendHeartbeat
+// and handles the reply.
+func (rf *Raft) sendAppendEntries(peer int, peerAddr string, args *AppendEntriesArgs, epoch int, heartbeat bool) {
+	var reply AppendEntriesReply
+	sent := time.Now()
+	replied := rf.call(func(ctx context.Context) error {
+		return rf.transport.AppendEntries(ctx, peerAddr, args, &reply)
+	})
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if replied && reply.Term > rf.currentTerm {
+		rf.stepDown(reply.Term)
+		rf.persistOrLog()
+		return
+	}
+
+	pr, ok := rf.progress[peer]
+	if rf.role != Leader || rf.currentTerm != args.Term || !ok {
+		return
+	}
+
+	current := epoch == pr.epoch && !heartbeat
+	if current {
+		pr.inflight--
+	}
+
+	if !replied {
+		// The request may or may not have arrived; resend from what the
+		// peer is known to hold on the next tick.
+		if current && !pr.probing {
+			rf.probe(peer, rf.matchIndex[peer]+1)
+		}
+		return
+	}
+	rf.recordAck(peer, sent)
+
+	if reply.Success {
+		match := args.PrevLogIndex + len(args.Entries)
+		if match > rf.matchIndex[peer] {
+			rf.matchIndex[peer] = match
+			rf.advanceCommitIndex()
+		}
+		if heartbeat {
+			return
+		}
+		if pr.probing && current {
+			pr.probing = false
+		}
+		rf.nextIndex[peer] = max(rf.nextIndex[peer], rf.matchIndex[peer]+1)
+		rf.replicate(peer)
+		return
+	}
+
+	// Heartbeats only claim entries the peer may have dropped since, and
+	// stale rejections have been superseded by a later probe.
+	if !current || args.PrevLogIndex < rf.matchIndex[peer] {
+		return
+	}
+
+	next := reply.ConflictIndex
+	if reply.ConflictTerm != -1 {
+		for i := rf.lastLogIndex(); i > rf.snapshotIndex; i-- {
+			if rf.termAt(i) == reply.ConflictTerm {
+				next = i + 1
+				break
+			}
+			if rf.termAt(i) < reply.ConflictTerm {
+				break
+			}
+		}
+	}
+	rf.probe(peer, max(rf.matchIndex[peer]+1, min(next, rf.lastLogIndex()+1)))
+	rf.replicate(peer)
+}
+
+// probe drops peer back to probe mode, to resume at next. Replies to
+// requests already in flight are then ignored for flow control. Callers
+// must hold rf.mu.
+func (rf *Raft) probe(peer int, next int) {
+	pr := rf.progress[peer]
+	pr.probing = true
+	pr.inflight = 0
+	pr.epoch++
+	rf.nextIndex[peer] = next
+}
+
+// advanceCommitIndex commits the highest index stored on a majority of the
+// voters in the current configuration. Only entries from the current term are committed
+// by counting replicas; earlier entries are committed indirectly (Raft paper
+// §5.4.2). Callers must hold rf.mu.
+func (rf *Raft) advanceCommitIndex() {
+	for n := rf.lastLogIndex(); n > rf.commitIndex; n-- {
+		if rf.termAt(n) != rf.currentTerm {
+			break
+		}
+
+		count := 0
+		for _, server := range rf.config {
+			if !server.Learner && rf.matchIndex[server.ID] >= n {
+				count++
+			}
+		}
+
+		if count >= rf.quorum() {
+			log.Printf("[Node %d] Committed up to index %d (Term: %d)", rf.id, n, rf.currentTerm)
+			rf.commitIndex = n
+			rf.applyCond.Signal()
+			break
+		}
+	}
+
+	// A leader that removed itself keeps leading until the change commits,
+	// without counting its own log, and then hands over.
+	if rf.role == Leader && rf.configIndex <= rf.commitIndex && !rf.isMember(rf.id) {
+		log.Printf("[Node %d] Removed from the configuration, stepping down", rf.id)
+		rf.role = Follower
+		rf.leaderId = -1
+	}
+}
+
+// applier is the only goroutine that sends on applyCh, which is what
+// guarantees every committed entry is delivered once and in order. The lock
+// is released while sending so a slow consumer does not stall the node.
+// When the snapshot is ahead of what has been applied (after a restart or an
+// InstallSnapshot) it is delivered first, in place of the entries it covers.
+func (rf *Raft) applier() {
+	defer rf.wg.Done()
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	for {
+		for rf.lastApplied >= rf.commitIndex && !rf.killed() {
+			rf.applyCond.Wait()
+		}
+		if rf.killed() {
+			return
+		}
+
+		if rf.lastApplied < rf.snapshotIndex {
+			msg := ApplyMsg{
+				Index:         rf.snapshotIndex,
+				Term:          rf.snapshotTerm(),
+				SnapshotValid: true,
+				Snapshot:      rf.snapshot,
+			}
+
+			rf.mu.Unlock()
+			ok := rf.deliver(msg)
+			rf.mu.Lock()
+			if !ok {
+				return
+			}
+
+			rf.lastApplied = max(rf.lastApplied, msg.Index)
+			rf.readCond.Broadcast()
+			continue
+		}
+
+		start, end := rf.lastApplied+1, rf.commitIndex
+		msgs := make([]ApplyMsg, 0, end-start+1)
+		for i := start; i <= end; i++ {
+			entry := rf.entry(i)
+			if entry.Type != CommandEntry {
+				continue
+			}
+			msgs = append(msgs, ApplyMsg{
+				Index:   i,
+				Term:    entry.Term,
+				Command: entry.Command,
+			})
+		}
+
+		rf.mu.Unlock()
+		for _, msg := range msgs {
+			if !rf.deliver(msg) {
+				rf.mu.Lock()
+				return
+			}
+		}
+		rf.mu.Lock()
+
+		rf.lastApplied = max(rf.lastApplied, end)
+		rf.readCond.Broadcast()
+	}
+}
+
+// deliver sends msg on applyCh unless the node is stopped first, so a
+// service that has stopped reading cannot keep the applier from exiting.
+func (rf *Raft) deliver(msg ApplyMsg) bool {
+	select {
+	case rf.applyCh <- msg:
+		return true
+	case <-rf.ctx.Done():
+		return false
+	}
+}
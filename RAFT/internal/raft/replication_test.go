@@ -0,0 +1,328 @@
+package raft
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBasicAgreement(t *testing.T) {
+	c := newCluster(t, 3)
+
+	prev := 0
+	for i := 0; i < 5; i++ {
+		index := c.one(fmt.Sprintf("cmd-%d", i), 3)
+		if index <= prev {
+			t.Errorf("command %d committed at index %d, not after %d", i, index, prev)
+		}
+		prev = index
+	}
+}
+
+func TestFollowerCatchesUpAfterDisconnect(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("before", 3)
+
+	leader := c.waitForLeader()
+	follower := (leader + 1) % 3
+	c.disconnect(follower)
+
+	c.one("while away 1", 2)
+	c.one("while away 2", 2)
+
+	c.connect(follower)
+	index := c.one("after", 3)
+	c.waitForApplied(index, "after")
+}
+
+func TestNoCommitWithoutMajority(t *testing.T) {
+	c := newCluster(t, 5)
+
+	c.one("before", 5)
+
+	leader := c.waitForLeader()
+	for i := 1; i <= 3; i++ {
+		c.disconnect((leader + i) % 5)
+	}
+
+	index, _, ok := c.node(leader).Submit("stranded")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	time.Sleep(1 * time.Second)
+	if count, _ := c.nApplied(index); count > 0 {
+		t.Fatalf("command committed on %d nodes without a majority", count)
+	}
+
+	for i := 1; i <= 3; i++ {
+		c.connect((leader + i) % 5)
+	}
+	c.one("after", 5)
+}
+
+// TestPartitionedLeaderLogIsOverwritten strands a leader with uncommitted
+// entries, lets the majority move on, then heals the partition; the stale
+// entries must be replaced by the majority's log.
+func TestPartitionedLeaderLogIsOverwritten(t *testing.T) {
+	c := newCluster(t, 5)
+
+	c.one("before", 5)
+
+	leader := c.waitForLeader()
+	c.partition([]int{leader, (leader + 1) % 5}, []int{(leader + 2) % 5, (leader + 3) % 5, (leader + 4) % 5})
+	for i := 0; i < 5; i++ {
+		c.node(leader).Submit(fmt.Sprintf("stale-%d", i))
+	}
+
+	for i := 0; i < 5; i++ {
+		c.one(fmt.Sprintf("majority-%d", i), 3)
+	}
+
+	c.heal()
+	index := c.one("after heal", 5)
+	c.waitForApplied(index, "after heal")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.applied {
+		for _, command := range c.applied[i] {
+			if s, ok := command.(string); ok && len(s) > 5 && s[:5] == "stale" {
+				t.Errorf("node %d applied stranded command %q", i, s)
+			}
+		}
+	}
+}
+
+func TestConcurrentSubmits(t *testing.T) {
+	c := newCluster(t, 3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.one(fmt.Sprintf("concurrent-%d", i), 3)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestUnreliableAgreement(t *testing.T) {
+	c := newCluster(t, 5)
+	c.net.SetReliable(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.one(fmt.Sprintf("unreliable-%d", i), 1)
+		}(i)
+	}
+	wg.Wait()
+
+	c.net.SetReliable(true)
+	c.one("reliable again", 5)
+}
+
+// TestFigure8Unreliable mixes crashes, disconnections, message loss and
+// long reordering, the setting of Figure 8 in the Raft paper, where an
+// entry from an old term can look replicated on a majority without being
+// safely committed. The harness checks election safety and log matching
+// throughout.
+func TestFigure8Unreliable(t *testing.T) {
+	c := newCluster(t, 5)
+	c.net.SetReliable(false)
+	c.net.SetLongReordering(true)
+
+	c.one("start", 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; time.Now().Before(deadline); i++ {
+		for j := range c.nodes {
+			c.node(j).Submit(fmt.Sprintf("fig8-%d", i))
+		}
+
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+
+		n := rand.Intn(5)
+		switch rand.Intn(3) {
+		case 0:
+			c.disconnect(n)
+		case 1:
+			c.connect(n)
+		case 2:
+			c.mu.Lock()
+			alive := c.alive[n]
+			c.mu.Unlock()
+			if alive {
+				c.crash(n)
+			} else {
+				c.start(n)
+			}
+		}
+	}
+
+	c.net.SetReliable(true)
+	c.net.SetLongReordering(false)
+	for i := range c.nodes {
+		c.mu.Lock()
+		alive := c.alive[i]
+		c.mu.Unlock()
+		if !alive {
+			c.start(i)
+		}
+		c.connect(i)
+	}
+
+	c.one("end", 5)
+}
+
+// pendingCall is an AppendEntries captured by a fake transport, answered
+// by sending a reply (or nil, for a lost request) on respond.
+type pendingCall struct {
+	args    *AppendEntriesArgs
+	respond chan *AppendEntriesReply
+}
+
+// newPipelineLeader returns a leader of term 1 with a 10-entry log (plus its
+// no-op) whose AppendEntries are captured on calls instead of being sent.
+func newPipelineLeader(t *testing.T, window int, maxEntries int) (*Raft, chan pendingCall) {
+	entries := make([]LogEntry, 10)
+	for i := range entries {
+		entries[i] = LogEntry{Term: 1, Command: i}
+	}
+	rf := newTestNode(t, entries...)
+
+	calls := make(chan pendingCall, 16)
+	rf.transport = CallTransport(func(_ string, method string, args interface{}, reply interface{}) bool {
+		call := pendingCall{args: args.(*AppendEntriesArgs), respond: make(chan *AppendEntriesReply)}
+		calls <- call
+		r := <-call.respond
+		if r == nil {
+			return false
+		}
+		*reply.(*AppendEntriesReply) = *r
+		return true
+	})
+	t.Cleanup(rf.Stop)
+
+	rf.mu.Lock()
+	rf.becomeLeader()
+	rf.window = window
+	rf.maxEntries = maxEntries
+	rf.mu.Unlock()
+	return rf, calls
+}
+
+// nextCalls collects n captured requests ordered by PrevLogIndex.
+func nextCalls(t *testing.T, calls chan pendingCall, n int) []pendingCall {
+	t.Helper()
+	var got []pendingCall
+	for len(got) < n {
+		select {
+		case call := <-calls:
+			got = append(got, call)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("got %d requests, want %d", len(got), n)
+		}
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].args.PrevLogIndex < got[j].args.PrevLogIndex })
+
+	select {
+	case call := <-calls:
+		t.Fatalf("unexpected extra request with PrevLogIndex %d", call.args.PrevLogIndex)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return got
+}
+
+func TestPipelineFlowControl(t *testing.T) {
+	rf, calls := newPipelineLeader(t, 2, 3)
+	const peer = 1
+
+	// A new peer is probed with one request at a time, starting at the
+	// leader's no-op.
+	rf.mu.Lock()
+	rf.replicate(peer)
+	rf.replicate(peer)
+	rf.mu.Unlock()
+	probe := nextCalls(t, calls, 1)[0]
+	if probe.args.PrevLogIndex != 10 || len(probe.args.Entries) != 1 {
+		t.Fatalf("probe has PrevLogIndex %d and %d entries, want 10 and 1", probe.args.PrevLogIndex, len(probe.args.Entries))
+	}
+
+	// The follower is missing everything.
+	probe.respond <- &AppendEntriesReply{Term: 1, ConflictTerm: -1, ConflictIndex: 1}
+	probe = nextCalls(t, calls, 1)[0]
+	if probe.args.PrevLogIndex != 0 || len(probe.args.Entries) != 3 {
+		t.Fatalf("second probe has PrevLogIndex %d and %d entries, want 0 and 3", probe.args.PrevLogIndex, len(probe.args.Entries))
+	}
+
+	// Success switches to pipelining: two batches go out at once.
+	probe.respond <- &AppendEntriesReply{Term: 1, Success: true}
+	batches := nextCalls(t, calls, 2)
+	if batches[0].args.PrevLogIndex != 3 || batches[1].args.PrevLogIndex != 6 {
+		t.Fatalf("pipelined batches start after %d and %d, want 3 and 6", batches[0].args.PrevLogIndex, batches[1].args.PrevLogIndex)
+	}
+
+	// Acknowledging one frees a slot for the rest of the log.
+	batches[0].respond <- &AppendEntriesReply{Term: 1, Success: true}
+	last := nextCalls(t, calls, 1)[0]
+	if last.args.PrevLogIndex != 9 || len(last.args.Entries) != 2 {
+		t.Fatalf("final batch has PrevLogIndex %d and %d entries, want 9 and 2", last.args.PrevLogIndex, len(last.args.Entries))
+	}
+
+	// A lost request drops back to probing from what the peer holds.
+	batches[1].respond <- nil
+	var probing bool
+	var next int
+	for deadline := time.Now().Add(1 * time.Second); time.Now().Before(deadline); {
+		rf.mu.Lock()
+		probing, next = rf.progress[peer].probing, rf.nextIndex[peer]
+		rf.mu.Unlock()
+		if probing {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !probing || next != 7 {
+		t.Fatalf("after a lost request: probing=%v nextIndex=%d, want true and 7", probing, next)
+	}
+
+	// The reply to the request sent before that no longer counts against
+	// the window, but still records what the peer holds.
+	last.respond <- &AppendEntriesReply{Term: 1, Success: true}
+	resumed := nextCalls(t, calls, 1)[0]
+	if resumed.args.PrevLogIndex != 11 {
+		t.Fatalf("resumed with PrevLogIndex %d, want 11", resumed.args.PrevLogIndex)
+	}
+	resumed.respond <- nil
+}
+
+func TestPipelinedAgreementUnreliable(t *testing.T) {
+	c := newCluster(t, 5)
+	for i := range c.nodes {
+		c.node(i).SetPipeline(8, 5)
+	}
+	c.net.SetReliable(false)
+	c.net.SetLongReordering(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.one(fmt.Sprintf("pipelined-%d", i), 1)
+		}(i)
+	}
+	wg.Wait()
+
+	c.net.SetReliable(true)
+	c.net.SetLongReordering(false)
+	c.one("reliable again", 5)
+}
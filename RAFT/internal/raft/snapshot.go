@@ -0,0 +1,113 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Snapshot tells Raft that the service has captured its state, up to and
+// including index, in data. The log is discarded through index and the
+// snapshot replaces it on disk. Snapshots at or below the current one are
+// ignored.
+func (rf *Raft) Snapshot(index int, data []byte) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if index <= rf.snapshotIndex {
+		return nil
+	}
+	if index > rf.commitIndex {
+		return fmt.Errorf("raft: cannot snapshot index %d beyond commit index %d", index, rf.commitIndex)
+	}
+
+	config, _ := rf.configAt(index)
+	rf.compactTo(index, rf.termAt(index), config)
+	rf.snapshot = data
+
+	log.Printf("[Node %d] Compacted log through index %d", rf.id, index)
+
+	return rf.persistWithSnapshot()
+}
+
+func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.killed() {
+		return ErrStopped
+	}
+
+	if args.Term < rf.currentTerm {
+		reply.Term = rf.currentTerm
+		return nil
+	}
+
+	rf.lastContact = time.Now()
+
+	changed := false
+	if args.Term > rf.currentTerm {
+		rf.stepDown(args.Term)
+		changed = true
+	} else if rf.role == Candidate {
+		rf.role = Follower
+	}
+	rf.leaderId = args.LeaderId
+
+	reply.Term = rf.currentTerm
+
+	// We already hold every entry the snapshot covers.
+	if args.LastIncludedIndex <= rf.commitIndex {
+		return rf.persistIf(changed)
+	}
+
+	log.Printf("[Node %d] Installing snapshot through index %d from %d", rf.id, args.LastIncludedIndex, args.LeaderId)
+
+	rf.compactTo(args.LastIncludedIndex, args.LastIncludedTerm, args.Config)
+	rf.reloadConfig()
+	rf.snapshot = args.Data
+	if err := rf.persistWithSnapshot(); err != nil {
+		return err
+	}
+
+	rf.commitIndex = args.LastIncludedIndex
+	rf.applyCond.Signal()
+	return nil
+}
+
+// sendSnapshot sends the snapshot replicate prepared for a peer that is
+// behind the start of the log, then resumes probing right after it.
+func (rf *Raft) sendSnapshot(peer int, peerAddr string, args *InstallSnapshotArgs, epoch int) {
+	var reply InstallSnapshotReply
+	sent := time.Now()
+	replied := rf.call(func(ctx context.Context) error {
+		return rf.transport.InstallSnapshot(ctx, peerAddr, args, &reply)
+	})
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if replied && reply.Term > rf.currentTerm {
+		rf.stepDown(reply.Term)
+		rf.persistOrLog()
+		return
+	}
+
+	pr, ok := rf.progress[peer]
+	if rf.role != Leader || rf.currentTerm != args.Term || !ok {
+		return
+	}
+	if epoch == pr.epoch {
+		pr.inflight--
+	}
+	if !replied {
+		return
+	}
+	rf.recordAck(peer, sent)
+
+	rf.matchIndex[peer] = max(rf.matchIndex[peer], args.LastIncludedIndex)
+	rf.advanceCommitIndex()
+	rf.probe(peer, rf.matchIndex[peer]+1)
+	rf.replicate(peer)
+}
@@ -0,0 +1,122 @@
+package raft
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSnapshotCompactsLog(t *testing.T) {
+	rf := newTestNode(t, LogEntry{Term: 1}, LogEntry{Term: 1}, LogEntry{Term: 2}, LogEntry{Term: 2})
+	rf.commitIndex = 3
+
+	if err := rf.Snapshot(5, []byte("too far")); err == nil {
+		t.Errorf("expected error snapshotting beyond the commit index")
+	}
+
+	if err := rf.Snapshot(3, []byte("state")); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if rf.snapshotIndex != 3 || rf.snapshotTerm() != 2 {
+		t.Errorf("expected snapshot at index 3 term 2, got index %d term %d", rf.snapshotIndex, rf.snapshotTerm())
+	}
+	if rf.lastLogIndex() != 4 || len(rf.log) != 2 {
+		t.Errorf("expected one entry after the snapshot, got last index %d and %d slots", rf.lastLogIndex(), len(rf.log))
+	}
+
+	if err := rf.Snapshot(2, []byte("older")); err != nil {
+		t.Fatalf("stale Snapshot failed: %v", err)
+	}
+	if rf.snapshotIndex != 3 {
+		t.Errorf("stale snapshot moved snapshotIndex to %d", rf.snapshotIndex)
+	}
+}
+
+func TestInstallSnapshotKeepsMatchingSuffix(t *testing.T) {
+	rf := newTestNode(t, LogEntry{Term: 1}, LogEntry{Term: 1}, LogEntry{Term: 2})
+
+	args := InstallSnapshotArgs{Term: 2, LeaderId: 1, LastIncludedIndex: 2, LastIncludedTerm: 1, Data: []byte("state")}
+	var reply InstallSnapshotReply
+	if err := rf.InstallSnapshot(&args, &reply); err != nil {
+		t.Fatalf("InstallSnapshot failed: %v", err)
+	}
+
+	if rf.lastLogIndex() != 3 || rf.termAt(3) != 2 {
+		t.Errorf("expected entry 3 to survive the snapshot, last index %d", rf.lastLogIndex())
+	}
+	if rf.commitIndex != 2 {
+		t.Errorf("expected commit index 2, got %d", rf.commitIndex)
+	}
+
+	args = InstallSnapshotArgs{Term: 3, LeaderId: 2, LastIncludedIndex: 5, LastIncludedTerm: 3, Data: []byte("newer")}
+	if err := rf.InstallSnapshot(&args, &reply); err != nil {
+		t.Fatalf("InstallSnapshot failed: %v", err)
+	}
+	if rf.lastLogIndex() != 5 || len(rf.log) != 1 {
+		t.Errorf("expected the snapshot to replace the whole log, last index %d", rf.lastLogIndex())
+	}
+}
+
+func TestLaggingFollowerCatchesUpFromSnapshot(t *testing.T) {
+	c := newSnapshotCluster(t, 3, 5)
+
+	leader := c.waitForLeader()
+	lagging := (leader + 1) % 3
+	c.crash(lagging)
+
+	indices := make([]int, 23)
+	for i := range indices {
+		command := fmt.Sprintf("cmd-%d", i)
+		index, _, ok := c.node(leader).Submit(command)
+		if !ok {
+			t.Fatalf("leader %d rejected command", leader)
+		}
+		c.waitForApplied(index, command)
+		indices[i] = index
+	}
+
+	rf := c.node(leader)
+	rf.mu.Lock()
+	compacted := rf.snapshotIndex
+	rf.mu.Unlock()
+	if compacted < 20 {
+		t.Fatalf("expected leader to compact through index 20, got %d", compacted)
+	}
+
+	c.start(lagging)
+	c.waitForApplied(indices[22], "cmd-22")
+	c.waitForApplied(indices[0], "cmd-0")
+}
+
+func TestRestartRestoresSnapshot(t *testing.T) {
+	c := newSnapshotCluster(t, 3, 3)
+
+	leader := c.waitForLeader()
+	indices := make([]int, 7)
+	for i := range indices {
+		command := fmt.Sprintf("cmd-%d", i)
+		index, _, ok := c.node(leader).Submit(command)
+		if !ok {
+			t.Fatalf("leader %d rejected command", leader)
+		}
+		c.waitForApplied(index, command)
+		indices[i] = index
+	}
+
+	for i := range c.nodes {
+		c.crash(i)
+	}
+	for i := range c.nodes {
+		c.start(i)
+	}
+
+	// The snapshot is delivered before anything new commits.
+	c.waitForApplied(indices[5], "cmd-5")
+
+	leader = c.waitForLeader()
+	next, _, ok := c.node(leader).Submit("after-restart")
+	if !ok {
+		t.Fatalf("leader %d rejected command", leader)
+	}
+	c.waitForApplied(next, "after-restart")
+	c.waitForApplied(indices[6], "cmd-6")
+}
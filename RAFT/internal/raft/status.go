@@ -0,0 +1,104 @@
+package raft
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Status is a point-in-time view of a node for debugging and monitoring.
+type Status struct {
+	ID            int
+	Role          string
+	Term          int
+	VotedFor      int
+	Leader        int
+	CommitIndex   int
+	LastApplied   int
+	SnapshotIndex int
+	LastLogIndex  int
+	// LogLength is the number of entries held in memory, after snapshotIndex.
+	LogLength int
+	// LastContact is when a follower last heard from a leader or granted a
+	// vote.
+	LastContact time.Time
+	// Peers is only filled in on the leader.
+	Peers []PeerStatus
+}
+
+type PeerStatus struct {
+	ID         int
+	Address    string
+	Learner    bool
+	NextIndex  int
+	MatchIndex int
+	// Probing is true while the leader looks for where the peer's log
+	// agrees with its own; otherwise up to the window of Inflight
+	// AppendEntries are pipelined.
+	Probing  bool
+	Inflight int
+	// LastContact is when the leader sent the latest request the peer
+	// answered.
+	LastContact time.Time
+}
+
+// Metrics are counters since the node was created.
+type Metrics struct {
+	ElectionsStarted uint64
+	VotesGranted     uint64
+	RPCFailures      uint64
+}
+
+type counters struct {
+	electionsStarted atomic.Uint64
+	votesGranted     atomic.Uint64
+	rpcFailures      atomic.Uint64
+}
+
+// Status returns the node's current state.
+func (rf *Raft) Status() Status {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	status := Status{
+		ID:            rf.id,
+		Role:          rf.role.String(),
+		Term:          rf.currentTerm,
+		VotedFor:      rf.votedFor,
+		Leader:        rf.leaderId,
+		CommitIndex:   rf.commitIndex,
+		LastApplied:   rf.lastApplied,
+		SnapshotIndex: rf.snapshotIndex,
+		LastLogIndex:  rf.lastLogIndex(),
+		LogLength:     len(rf.log) - 1,
+		LastContact:   rf.lastContact,
+	}
+
+	if rf.role == Leader {
+		for _, server := range rf.config {
+			if server.ID == rf.id {
+				continue
+			}
+			status.Peers = append(status.Peers, PeerStatus{
+				ID:          server.ID,
+				Address:     server.Address,
+				Learner:     server.Learner,
+				NextIndex:   rf.nextIndex[server.ID],
+				MatchIndex:  rf.matchIndex[server.ID],
+				Probing:     rf.progress[server.ID].probing,
+				Inflight:    rf.progress[server.ID].inflight,
+				LastContact: rf.lastAck[server.ID],
+			})
+		}
+	}
+
+	return status
+}
+
+// Metrics returns the node's counters.
+func (rf *Raft) Metrics() Metrics {
+	return Metrics{
+		ElectionsStarted: rf.metrics.electionsStarted.Load(),
+		VotesGranted:     rf.metrics.votesGranted.Load(),
+		RPCFailures:      rf.metrics.rpcFailures.Load(),
+	}
+}
@@ -0,0 +1,83 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+func TestStopIsSafeConcurrently(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	noRPC := CallTransport(func(string, string, interface{}, interface{}) bool { return false })
+	applyCh := make(chan ApplyMsg)
+	rf, err := NewRaft(0, []string{"self"}, noRPC, applyCh, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	rf.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rf.Stop()
+		}()
+	}
+	wg.Wait()
+	rf.Stop()
+
+	if _, ok := <-applyCh; ok {
+		t.Errorf("applyCh is still open after Stop")
+	}
+	if _, isLeader := rf.GetState(); isLeader {
+		t.Errorf("stopped node still reports itself as leader")
+	}
+	if _, _, isLeader := rf.Submit("late"); isLeader {
+		t.Errorf("stopped node accepted a command")
+	}
+
+	var reply AppendEntriesReply
+	if err := rf.AppendEntries(&AppendEntriesArgs{Term: 5}, &reply); !errors.Is(err, ErrStopped) {
+		t.Errorf("AppendEntries on a stopped node returned %v, want ErrStopped", err)
+	}
+}
+
+// TestStopAbandonsInFlightRPCs stops a node whose RPCs never return; Stop
+// must not wait for them.
+func TestStopAbandonsInFlightRPCs(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	hang := CallTransport(func(string, string, interface{}, interface{}) bool {
+		<-block
+		return false
+	})
+	rf, err := NewRaft(0, []string{"a", "b", "c"}, hang, make(chan ApplyMsg), storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	rf.Start()
+
+	// Past the longest election timeout, pre-votes are waiting on replies
+	// that never come.
+	time.Sleep(600 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		rf.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Stop is waiting for RPCs that never return")
+	}
+}
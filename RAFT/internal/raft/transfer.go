@@ -0,0 +1,146 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrTransferInProgress = errors.New("raft: a leadership transfer is already in progress")
+	// ErrTransferTimeout is returned when the target did not take over
+	// within an election timeout. The old leader keeps leading.
+	ErrTransferTimeout = errors.New("raft: leadership transfer timed out")
+)
+
+// TransferLeadership hands leadership to server target, for example before
+// restarting this node (Raft thesis §3.10). The leader stops accepting
+// commands, brings target's log up to date and then sends it TimeoutNow so
+// it starts an election at once instead of waiting for its timer.
+//
+// It returns nil once target is known to lead. If target has not taken over
+// within an election timeout, the transfer is abandoned, a leader that is
+// still in place resumes accepting commands, and ErrTransferTimeout is
+// returned.
+func (rf *Raft) TransferLeadership(target int) error {
+	rf.mu.Lock()
+	if rf.role != Leader {
+		rf.mu.Unlock()
+		return ErrNotLeader
+	}
+	if target == rf.id {
+		rf.mu.Unlock()
+		return nil
+	}
+	if !rf.isVoter(target) {
+		rf.mu.Unlock()
+		return fmt.Errorf("raft: server %d is not a voting member", target)
+	}
+	if rf.transferTarget != -1 {
+		rf.mu.Unlock()
+		return ErrTransferInProgress
+	}
+	rf.transferTarget = target
+	term := rf.currentTerm
+	id := rf.id
+	deadline := time.Now().Add(rf.election)
+	rf.mu.Unlock()
+
+	log.Printf("[Node %d] Transferring leadership to %d in Term %d", id, target, term)
+
+	sent := false
+	for time.Now().Before(deadline) {
+		if rf.killed() {
+			return ErrStopped
+		}
+
+		rf.mu.Lock()
+		if rf.currentTerm != term || rf.role != Leader {
+			leader := rf.leaderId
+			rf.mu.Unlock()
+			if leader == target {
+				return nil
+			}
+			if leader != -1 {
+				return fmt.Errorf("raft: server %d took over instead of %d", leader, target)
+			}
+			// Stepped down; wait to hear from the new leader.
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		caughtUp := rf.matchIndex[target] == rf.lastLogIndex()
+		if !caughtUp {
+			rf.replicate(target)
+		}
+		rf.mu.Unlock()
+
+		if caughtUp && !sent {
+			sent = rf.sendTimeoutNow(target, term)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.role == Leader && rf.currentTerm == term {
+		log.Printf("[Node %d] Leadership transfer to %d timed out, resuming as leader", rf.id, target)
+		rf.transferTarget = -1
+	}
+	return ErrTransferTimeout
+}
+
+// sendTimeoutNow tells target to start an election right away and reports
+// whether it answered.
+func (rf *Raft) sendTimeoutNow(target int, term int) bool {
+	rf.mu.Lock()
+	peerAddr, ok := rf.addressOf(target)
+	if rf.role != Leader || rf.currentTerm != term || !ok {
+		rf.mu.Unlock()
+		return false
+	}
+	args := TimeoutNowArgs{Term: term, LeaderId: rf.id}
+	rf.mu.Unlock()
+
+	var reply TimeoutNowReply
+	if !rf.call(func(ctx context.Context) error {
+		return rf.transport.TimeoutNow(ctx, peerAddr, &args, &reply)
+	}) {
+		return false
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if reply.Term > rf.currentTerm {
+		rf.stepDown(reply.Term)
+		rf.persistOrLog()
+	}
+	return true
+}
+
+// TimeoutNow starts an election immediately, skipping the pre-vote, because
+// the leader has chosen this node as its successor.
+func (rf *Raft) TimeoutNow(args *TimeoutNowArgs, reply *TimeoutNowReply) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.killed() {
+		return ErrStopped
+	}
+
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm || !rf.isVoter(rf.id) {
+		return nil
+	}
+	if args.Term > rf.currentTerm {
+		rf.stepDown(args.Term)
+	}
+
+	log.Printf("[Node %d] Received TimeoutNow from %d, starting election", rf.id, args.LeaderId)
+	rf.campaign(true)
+	reply.Term = rf.currentTerm
+	return nil
+}
@@ -0,0 +1,63 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransferLeadership(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("before", 3)
+	for round := 0; round < 3; round++ {
+		leader := c.waitForLeader()
+		target := (leader + 1) % 3
+		if err := c.node(leader).TransferLeadership(target); err != nil {
+			t.Fatalf("transfer from %d to %d failed: %v", leader, target, err)
+		}
+		if got := c.waitForLeader(); got != target {
+			t.Fatalf("leader is %d after transfer to %d", got, target)
+		}
+	}
+	c.one("after", 3)
+}
+
+// TestTransferToLaggingFollower makes the leader catch the target up before
+// handing over, since the target could not win an election otherwise.
+func TestTransferToLaggingFollower(t *testing.T) {
+	c := newCluster(t, 3)
+
+	c.one("before", 3)
+	leader := c.waitForLeader()
+	target := (leader + 1) % 3
+
+	c.disconnect(target)
+	for _, cmd := range []string{"missed 1", "missed 2", "missed 3"} {
+		c.one(cmd, 2)
+	}
+	c.connect(target)
+
+	if err := c.node(leader).TransferLeadership(target); err != nil {
+		t.Fatalf("transfer to lagging follower %d failed: %v", target, err)
+	}
+	c.one("after", 3)
+}
+
+// TestTransferTimesOut sends leadership to an unreachable target; the old
+// leader must give up and keep serving.
+func TestTransferTimesOut(t *testing.T) {
+	c := newCluster(t, 5)
+
+	c.one("before", 5)
+	leader := c.waitForLeader()
+	target := (leader + 1) % 5
+	c.disconnect(target)
+
+	if err := c.node(leader).TransferLeadership(target); !errors.Is(err, ErrTransferTimeout) {
+		t.Fatalf("transfer to disconnected node returned %v, want ErrTransferTimeout", err)
+	}
+	if _, _, isLeader := c.node(leader).Submit("after"); !isLeader {
+		t.Fatalf("leader %d did not resume after the failed transfer", leader)
+	}
+	c.one("after", 4)
+}
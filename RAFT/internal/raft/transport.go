@@ -0,0 +1,60 @@
+package raft
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoReply is returned by a Transport when a request or its reply was
+// lost. As with any network, the handler may still have run.
+var ErrNoReply = errors.New("raft: no reply")
+
+// Transport carries Raft's RPCs to the server at address. Implementations
+// must be safe for concurrent use and should give up once ctx is done; the
+// node cancels it on Stop. An error means no reply arrived, and reply must
+// then be left alone by the caller.
+type Transport interface {
+	RequestVote(ctx context.Context, address string, args *RequestVoteArgs, reply *RequestVoteReply) error
+	AppendEntries(ctx context.Context, address string, args *AppendEntriesArgs, reply *AppendEntriesReply) error
+	InstallSnapshot(ctx context.Context, address string, args *InstallSnapshotArgs, reply *InstallSnapshotReply) error
+	TimeoutNow(ctx context.Context, address string, args *TimeoutNowArgs, reply *TimeoutNowReply) error
+}
+
+// CallTransport adapts a net/rpc style call function, such as labrpc's
+// End.Call, to Transport, invoking "Raft.<Method>" on the receiving node.
+// Such a call cannot be interrupted, so a cancelled context abandons the
+// reply rather than the call itself.
+type CallTransport func(address string, method string, args interface{}, reply interface{}) bool
+
+func (call CallTransport) RequestVote(ctx context.Context, address string, args *RequestVoteArgs, reply *RequestVoteReply) error {
+	return call.invoke(ctx, address, "Raft.RequestVote", args, reply)
+}
+
+func (call CallTransport) AppendEntries(ctx context.Context, address string, args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	return call.invoke(ctx, address, "Raft.AppendEntries", args, reply)
+}
+
+func (call CallTransport) InstallSnapshot(ctx context.Context, address string, args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	return call.invoke(ctx, address, "Raft.InstallSnapshot", args, reply)
+}
+
+func (call CallTransport) TimeoutNow(ctx context.Context, address string, args *TimeoutNowArgs, reply *TimeoutNowReply) error {
+	return call.invoke(ctx, address, "Raft.TimeoutNow", args, reply)
+}
+
+func (call CallTransport) invoke(ctx context.Context, address string, method string, args interface{}, reply interface{}) error {
+	done := make(chan bool, 1)
+	go func() {
+		done <- call(address, method, args, reply)
+	}()
+
+	select {
+	case ok := <-done:
+		if !ok {
+			return ErrNoReply
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
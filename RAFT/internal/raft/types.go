@@ -1,8 +1,12 @@
 package raft
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/rushikeshg25/raft/internal/storage"
 )
 
 type NodeRole int
@@ -11,33 +15,130 @@ const (
 	Follower NodeRole = iota
 	Candidate
 	Leader
+	// Learner is a non-voting member: it receives the log but neither
+	// campaigns nor counts toward a quorum. See AddLearner.
+	Learner
 )
 
+func (r NodeRole) String() string {
+	switch r {
+	case Follower:
+		return "Follower"
+	case Candidate:
+		return "Candidate"
+	case Leader:
+		return "Leader"
+	case Learner:
+		return "Learner"
+	}
+	return fmt.Sprintf("NodeRole(%d)", int(r))
+}
+
+type EntryType int
+
+const (
+	// CommandEntry carries a client command for the service.
+	CommandEntry EntryType = iota
+	// NoopEntry is appended by every new leader so it can commit an entry
+	// from its own term straight away.
+	NoopEntry
+	// ConfigEntry carries a new cluster configuration in Config.
+	ConfigEntry
+)
+
+// Server is one member of the cluster configuration. IDs must stay unique
+// for the lifetime of the cluster; addresses are what the Transport dials.
+type Server struct {
+	ID      int
+	Address string
+	// Learner servers are sent the log but do not vote.
+	Learner bool
+}
+
 type LogEntry struct {
+	Term    int
+	Type    EntryType
+	Command interface{}
+	Config  []Server
+}
+
+// ApplyMsg is delivered on the apply channel once for every committed
+// command, in log order. No-op and configuration entries are internal to
+// Raft and leave gaps in the indices the service sees.
+type ApplyMsg struct {
+	Index   int
 	Term    int
 	Command interface{}
+
+	// SnapshotValid marks a snapshot instead of a command. The service must
+	// replace its state with Snapshot, which covers every entry up to and
+	// including Index.
+	SnapshotValid bool
+	Snapshot      []byte
 }
 
 type Raft struct {
-	mu    sync.Mutex
-	peers []string
-	id    int
+	mu sync.Mutex
+	id int
+
+	// config is the latest configuration in the log, which takes effect as
+	// soon as it is appended; configIndex is the entry that introduced it.
+	// snapshotConfig is the configuration as of snapshotIndex.
+	config         []Server
+	configIndex    int
+	snapshotConfig []Server
 
 	currentTerm int
 	votedFor    int
 	log         []LogEntry
 
+	// snapshotIndex is the last index covered by snapshot; see log.go.
+	snapshotIndex int
+	snapshot      []byte
+
 	commitIndex int
 	lastApplied int
+	applyCh     chan<- ApplyMsg
+	applyCond   *sync.Cond
+	// readCond wakes ReadIndex callers when a peer acknowledges the leader
+	// or more entries are applied.
+	readCond *sync.Cond
 
-	nextIndex  []int
-	matchIndex []int
+	nextIndex  map[int]int
+	matchIndex map[int]int
+	// progress is the leader's flow control state for each peer, and
+	// window and maxEntries bound it; see replication.go.
+	progress   map[int]*progress
+	window     int
+	maxEntries int
+	// lastAck is when the leader sent the latest request each peer has
+	// answered in its term; see checkQuorum and ReadIndex.
+	lastAck map[int]time.Time
+	// transferTarget is the server this leader is handing leadership to,
+	// or -1. New commands are refused while a transfer is under way.
+	transferTarget int
+	// leaseReads lets ReadIndex skip the heartbeat round while the leader
+	// holds a lease; see SetLeaseReads.
+	leaseReads bool
 
 	role        NodeRole
 	heartbeat   time.Duration
 	election    time.Duration
 	lastContact time.Time
-	sendRPC     func(address string, method string, args interface{}, reply interface{}) bool
+	// leaderId is the leader of currentTerm as far as we know, or -1.
+	leaderId  int
+	transport Transport
+	persister storage.Persister
+
+	// ctx is cancelled by Stop; wg tracks the ticker and applier.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	// metrics is updated without rf.mu so that call can count failures
+	// from any goroutine.
+	metrics counters
 }
 
 type RequestVoteArgs struct {
@@ -45,6 +146,14 @@ type RequestVoteArgs struct {
 	CandidateId  int
 	LastLogIndex int
 	LastLogTerm  int
+
+	// PreVote asks whether the receiver would vote for the candidate in
+	// Term without either side changing its term or vote (Raft thesis
+	// §9.6). Term is the term the candidate would campaign in.
+	PreVote bool
+	// Transfer marks an election the leader asked for with TimeoutNow.
+	// Voters consider it even while they still hear from that leader.
+	Transfer bool
 }
 
 type RequestVoteReply struct {
@@ -64,18 +173,74 @@ type AppendEntriesArgs struct {
 type AppendEntriesReply struct {
 	Term    int
 	Success bool
+
+	// ConflictTerm and ConflictIndex let the leader skip over a whole
+	// conflicting term at once instead of decrementing nextIndex one entry
+	// per round trip. ConflictTerm is -1 when the follower's log is too short.
+	ConflictTerm  int
+	ConflictIndex int
 }
 
-func NewRaft(id int, peers []string, sendRPC func(string, string, interface{}, interface{}) bool) *Raft {
-	return &Raft{
-		id:          id,
-		peers:       peers,
-		role:        Follower,
-		votedFor:    -1,
-		currentTerm: 0,
-		heartbeat:   100 * time.Millisecond,
-		election:    300 * time.Millisecond,
-		log:         make([]LogEntry, 0),
-		sendRPC:     sendRPC,
+type TimeoutNowArgs struct {
+	Term     int
+	LeaderId int
+}
+
+type TimeoutNowReply struct {
+	Term int
+}
+
+type InstallSnapshotArgs struct {
+	Term              int
+	LeaderId          int
+	LastIncludedIndex int
+	LastIncludedTerm  int
+	Config            []Server
+	// Data is sent in one piece rather than in the paper's offset/done
+	// chunks; snapshots in this project are small enough for a single RPC.
+	Data []byte
+}
+
+type InstallSnapshotReply struct {
+	Term int
+}
+
+// NewRaft creates a node and restores any state previously saved through
+// persister. peers is the bootstrap configuration, where a server's ID is
+// its position in the slice; it is ignored once the node has persisted
+// state. A node joining an existing cluster passes no peers and learns the
+// configuration from the leader.
+func NewRaft(id int, peers []string, transport Transport, applyCh chan<- ApplyMsg, persister storage.Persister) (*Raft, error) {
+	config := make([]Server, len(peers))
+	for i, addr := range peers {
+		config[i] = Server{ID: i, Address: addr}
+	}
+
+	rf := &Raft{
+		id:             id,
+		config:         config,
+		snapshotConfig: config,
+		role:           Follower,
+		votedFor:       -1,
+		leaderId:       -1,
+		transferTarget: -1,
+		currentTerm:    0,
+		heartbeat:      100 * time.Millisecond,
+		window:         4,
+		maxEntries:     64,
+		election:       300 * time.Millisecond,
+		log:            []LogEntry{{Term: 0}},
+		transport:      transport,
+		applyCh:        applyCh,
+		persister:      persister,
+	}
+	rf.ctx, rf.cancel = context.WithCancel(context.Background())
+	rf.applyCond = sync.NewCond(&rf.mu)
+	rf.readCond = sync.NewCond(&rf.mu)
+
+	if err := rf.readPersist(); err != nil {
+		return nil, err
 	}
+
+	return rf, nil
 }
@@ -1,19 +1,37 @@
 package rpc
 
 import (
+	"errors"
 	"log"
 	"net"
 	"net/rpc"
+	"sync"
 
 	"github.com/rushikeshg25/raft/internal/raft"
 )
 
 type Server struct {
-	node *raft.Raft
+	node     *raft.Raft
+	services map[string]interface{}
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	stopped  bool
 }
 
 func NewServer(node *raft.Raft) *Server {
-	return &Server{node: node}
+	return &Server{
+		node:     node,
+		services: make(map[string]interface{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Register exposes another service, such as a kvraft.KVServer, on the same
+// listener as the Raft node. It must be called before Start.
+func (s *Server) Register(name string, rcvr interface{}) {
+	s.services[name] = rcvr
 }
 
 func (s *Server) Start(address string) error {
@@ -23,38 +41,75 @@ func (s *Server) Start(address string) error {
 		return err
 	}
 
+	for name, rcvr := range s.services {
+		if err := rpcServer.RegisterName(name, rcvr); err != nil {
+			return err
+		}
+	}
+
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		listener.Close()
+		return errors.New("rpc: server stopped")
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
 	log.Printf("[Server] Listening on %s", address)
 	go func() {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				log.Printf("[Server] Accept error: %v", err)
 				continue
 			}
-			go rpcServer.ServeConn(conn)
+
+			s.mu.Lock()
+			if s.stopped {
+				s.mu.Unlock()
+				conn.Close()
+				return
+			}
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			go func() {
+				rpcServer.ServeConn(conn)
+
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
 		}
 	}()
 
 	return nil
 }
 
-func Call(address string, method string, args interface{}, reply interface{}) bool {
-	client, err := rpc.Dial("tcp", address)
-	if err != nil {
-		return false
-	}
-	defer client.Close()
-
-	err = client.Call(method, args, reply)
-	if err != nil {
-		log.Printf("[RPC] Call error %s: %v", method, err)
-		return false
+// Stop closes the listener and every open connection, which cuts off RPCs
+// in progress, and then stops the node. It is safe to call more than once
+// and from several goroutines.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		if s.listener != nil {
+			s.listener.Close()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
 	}
+	s.mu.Unlock()
 
-	return true
+	s.node.Stop()
 }
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/raft"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// freeAddress returns a loopback address nothing is listening on.
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestStopClosesListener(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	address := freeAddress(t)
+	transport := NewTransport(time.Second)
+	defer transport.Close()
+	node, err := raft.NewRaft(0, []string{address}, transport, make(chan raft.ApplyMsg), storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	server := NewServer(node)
+	if err := server.Start(address); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	node.Start()
+
+	var reply raft.RequestVoteReply
+	if !transport.Call(address, "Raft.RequestVote", &raft.RequestVoteArgs{Term: 1, CandidateId: 1}, &reply) {
+		t.Fatalf("RequestVote to a running server failed")
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			server.Stop()
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	if transport.Call(address, "Raft.RequestVote", &raft.RequestVoteArgs{Term: 2, CandidateId: 1}, &reply) {
+		t.Errorf("RequestVote succeeded after Stop")
+	}
+
+	// The port is free again.
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("listener was not closed: %v", err)
+	}
+	l.Close()
+}
+
+func TestTransportRedialsAfterRestart(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	address := freeAddress(t)
+	transport := NewTransport(time.Second)
+	defer transport.Close()
+
+	start := func() *Server {
+		node, err := raft.NewRaft(0, []string{address}, transport, make(chan raft.ApplyMsg), storage.NewMemoryPersister())
+		if err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+		server := NewServer(node)
+		if err := server.Start(address); err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		return server
+	}
+
+	server := start()
+	var reply raft.RequestVoteReply
+	for i := 0; i < 3; i++ {
+		if err := transport.RequestVote(t.Context(), address, &raft.RequestVoteArgs{Term: 1, CandidateId: 1}, &reply); err != nil {
+			t.Fatalf("RequestVote failed: %v", err)
+		}
+	}
+	server.Stop()
+
+	// The pooled connection is dead, so this call fails and drops it.
+	if err := transport.RequestVote(t.Context(), address, &raft.RequestVoteArgs{Term: 1, CandidateId: 1}, &reply); err == nil {
+		t.Fatalf("RequestVote to a stopped server succeeded")
+	}
+
+	server = start()
+	defer server.Stop()
+	if err := transport.RequestVote(t.Context(), address, &raft.RequestVoteArgs{Term: 1, CandidateId: 1}, &reply); err != nil {
+		t.Fatalf("RequestVote after restart failed: %v", err)
+	}
+}
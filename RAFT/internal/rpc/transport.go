@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+// Transport is a raft.Transport over net/rpc. It keeps one connection per
+// address, shared by concurrent calls, and redials after a failure.
+type Transport struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*rpc.Client
+}
+
+var _ raft.Transport = (*Transport)(nil)
+
+// NewTransport returns a Transport that gives up on a call, including the
+// dial, after timeout.
+func NewTransport(timeout time.Duration) *Transport {
+	return &Transport{
+		timeout: timeout,
+		clients: make(map[string]*rpc.Client),
+	}
+}
+
+func (t *Transport) RequestVote(ctx context.Context, address string, args *raft.RequestVoteArgs, reply *raft.RequestVoteReply) error {
+	return t.invoke(ctx, address, "Raft.RequestVote", args, reply)
+}
+
+func (t *Transport) AppendEntries(ctx context.Context, address string, args *raft.AppendEntriesArgs, reply *raft.AppendEntriesReply) error {
+	return t.invoke(ctx, address, "Raft.AppendEntries", args, reply)
+}
+
+func (t *Transport) InstallSnapshot(ctx context.Context, address string, args *raft.InstallSnapshotArgs, reply *raft.InstallSnapshotReply) error {
+	return t.invoke(ctx, address, "Raft.InstallSnapshot", args, reply)
+}
+
+func (t *Transport) TimeoutNow(ctx context.Context, address string, args *raft.TimeoutNowArgs, reply *raft.TimeoutNowReply) error {
+	return t.invoke(ctx, address, "Raft.TimeoutNow", args, reply)
+}
+
+// Call invokes any registered method, such as "KVServer.Get", over the
+// pooled connections. It has the signature kvraft.MakeClerk expects.
+func (t *Transport) Call(address string, method string, args interface{}, reply interface{}) bool {
+	return t.invoke(context.Background(), address, method, args, reply) == nil
+}
+
+// Close closes every pooled connection. Calls in progress fail.
+func (t *Transport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for address, client := range t.clients {
+		client.Close()
+		delete(t.clients, address)
+	}
+}
+
+func (t *Transport) invoke(parent context.Context, address string, method string, args interface{}, reply interface{}) error {
+	ctx, cancel := context.WithTimeout(parent, t.timeout)
+	defer cancel()
+
+	client, err := t.client(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			// An application error leaves the connection usable, but
+			// anything else means it is broken.
+			if _, ok := call.Error.(rpc.ServerError); !ok {
+				t.drop(address, client)
+			}
+			return call.Error
+		}
+		return nil
+	case <-ctx.Done():
+		// net/rpc cannot cancel a call, so a late reply is still decoded
+		// into reply; callers ignore it after an error. A peer that stops
+		// answering may sit behind a dead connection, so redial next time.
+		if parent.Err() == nil {
+			t.drop(address, client)
+		}
+		return ctx.Err()
+	}
+}
+
+// client returns the pooled connection to address, dialing one if needed.
+func (t *Transport) client(ctx context.Context, address string) (*rpc.Client, error) {
+	t.mu.Lock()
+	client, ok := t.clients[address]
+	t.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	client = rpc.NewClient(conn)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if existing, ok := t.clients[address]; ok {
+		// Another call dialed first.
+		client.Close()
+		return existing, nil
+	}
+	t.clients[address] = client
+	return client, nil
+}
+
+// drop forgets client if it is still the pooled connection to address.
+func (t *Transport) drop(address string, client *rpc.Client) {
+	t.mu.Lock()
+	if t.clients[address] == client {
+		delete(t.clients, address)
+	}
+	t.mu.Unlock()
+	client.Close()
+}
@@ -0,0 +1,57 @@
+// Package status serves a Raft node's state over HTTP: /status as JSON for
+// people and /metrics in the Prometheus text format for scrapers.
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rushikeshg25/raft/internal/raft"
+)
+
+// Handler returns an http.Handler exposing node's status and metrics.
+func Handler(node *raft.Raft) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(node.Status())
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, node.Status(), node.Metrics())
+	})
+	return mux
+}
+
+func writeMetrics(w http.ResponseWriter, status raft.Status, metrics raft.Metrics) {
+	node := fmt.Sprintf(`node="%d"`, status.ID)
+
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s{%s} %v\n", name, help, name, kind, name, node, value)
+	}
+
+	metric("raft_elections_started_total", "counter", "Elections this node started as a candidate.", metrics.ElectionsStarted)
+	metric("raft_votes_granted_total", "counter", "Votes this node granted to candidates.", metrics.VotesGranted)
+	metric("raft_rpc_failures_total", "counter", "Outgoing RPCs that got no reply.", metrics.RPCFailures)
+
+	isLeader := 0
+	if status.Role == raft.Leader.String() {
+		isLeader = 1
+	}
+	metric("raft_is_leader", "gauge", "Whether this node is the leader.", isLeader)
+	metric("raft_term", "gauge", "Current term.", status.Term)
+	metric("raft_commit_index", "gauge", "Highest log index known to be committed.", status.CommitIndex)
+	metric("raft_last_applied", "gauge", "Highest log index delivered to the service.", status.LastApplied)
+	metric("raft_log_entries", "gauge", "Log entries held in memory after the snapshot.", status.LogLength)
+
+	if len(status.Peers) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP raft_peer_match_index Highest index the leader knows a peer stores.\n# TYPE raft_peer_match_index gauge\n")
+	for _, peer := range status.Peers {
+		fmt.Fprintf(w, "raft_peer_match_index{%s,peer=\"%d\"} %d\n", node, peer.ID, peer.MatchIndex)
+	}
+}
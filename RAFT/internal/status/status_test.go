@@ -0,0 +1,76 @@
+package status
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushikeshg25/raft/internal/leaktest"
+	"github.com/rushikeshg25/raft/internal/raft"
+	"github.com/rushikeshg25/raft/internal/storage"
+)
+
+// newLeader starts a single-node cluster, which elects itself right away.
+func newLeader(t *testing.T) *raft.Raft {
+	noRPC := raft.CallTransport(func(string, string, interface{}, interface{}) bool { return false })
+	applyCh := make(chan raft.ApplyMsg, 16)
+	node, err := raft.NewRaft(0, []string{"self"}, noRPC, applyCh, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	t.Cleanup(leaktest.Check(t))
+	node.Start()
+	t.Cleanup(node.Stop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, isLeader := node.GetState(); isLeader {
+			return node
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("single node never became leader")
+	return nil
+}
+
+func get(t *testing.T, node *raft.Raft, path string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler(node).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET %s returned %d", path, rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestStatus(t *testing.T) {
+	node := newLeader(t)
+
+	var status raft.Status
+	if err := json.Unmarshal([]byte(get(t, node, "/status")), &status); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if status.Role != "Leader" || status.Term < 1 || status.Leader != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	node := newLeader(t)
+
+	body := get(t, node, "/metrics")
+	for _, want := range []string{
+		"# TYPE raft_elections_started_total counter",
+		`raft_elections_started_total{node="0"} 1`,
+		`raft_is_leader{node="0"} 1`,
+		`raft_rpc_failures_total{node="0"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
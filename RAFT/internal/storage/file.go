@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	stateFile    = "raft-state"
+	snapshotFile = "raft-snapshot"
+)
+
+// headerSize covers a CRC32 checksum followed by the payload length.
+const headerSize = 4 + 8
+
+// FilePersister keeps the Raft state and snapshot in two files inside dir. Every save
+// writes a temporary file, fsyncs it and renames it over the previous one, so
+// a crash leaves either the old or the new state on disk, never a mix.
+type FilePersister struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFilePersister(dir string) (*FilePersister, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FilePersister{dir: dir}, nil
+}
+
+func (p *FilePersister) SaveState(state []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return writeFileAtomic(p.dir, stateFile, state)
+}
+
+func (p *FilePersister) ReadState() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return readFileChecked(filepath.Join(p.dir, stateFile))
+}
+
+func (p *FilePersister) SaveStateAndSnapshot(state []byte, snapshot []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := writeFileAtomic(p.dir, snapshotFile, snapshot); err != nil {
+		return err
+	}
+	return writeFileAtomic(p.dir, stateFile, state)
+}
+
+func (p *FilePersister) ReadSnapshot() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return readFileChecked(filepath.Join(p.dir, snapshotFile))
+}
+
+func writeFileAtomic(dir string, name string, data []byte) error {
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(data))
+	binary.BigEndian.PutUint64(buf[4:12], uint64(len(data)))
+	copy(buf[headerSize:], data)
+
+	tmp := filepath.Join(dir, name+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	// The rename itself is only durable once the directory is synced.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func readFileChecked(path string) ([]byte, error) {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < headerSize {
+		return nil, ErrCorrupt
+	}
+
+	checksum := binary.BigEndian.Uint32(buf[0:4])
+	length := binary.BigEndian.Uint64(buf[4:12])
+	data := buf[headerSize:]
+	if uint64(len(data)) != length || crc32.ChecksumIEEE(data) != checksum {
+		return nil, ErrCorrupt
+	}
+
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilePersisterRoundTrip(t *testing.T) {
+	p, err := NewFilePersister(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create persister: %v", err)
+	}
+
+	state, err := p.ReadState()
+	if err != nil {
+		t.Fatalf("failed to read empty state: %v", err)
+	}
+	if state != nil {
+		t.Errorf("expected nil state before first save, got %q", state)
+	}
+
+	for _, want := range [][]byte{[]byte("term 1"), []byte("term 2, longer")} {
+		if err := p.SaveState(want); err != nil {
+			t.Fatalf("failed to save state: %v", err)
+		}
+		got, err := p.ReadState()
+		if err != nil {
+			t.Fatalf("failed to read state: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("expected state %q, got %q", want, got)
+		}
+	}
+}
+
+func TestFilePersisterSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("failed to create persister: %v", err)
+	}
+	if err := p.SaveState([]byte("durable")); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	reopened, err := NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen persister: %v", err)
+	}
+	got, err := reopened.ReadState()
+	if err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if string(got) != "durable" {
+		t.Errorf("expected state %q, got %q", "durable", got)
+	}
+}
+
+func TestFilePersisterDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("failed to create persister: %v", err)
+	}
+	if err := p.SaveState([]byte("some raft state")); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	path := filepath.Join(dir, stateFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to corrupt state file: %v", err)
+	}
+
+	if _, err := p.ReadState(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+
+	if err := os.WriteFile(path, data[:5], 0644); err != nil {
+		t.Fatalf("failed to truncate state file: %v", err)
+	}
+	if _, err := p.ReadState(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for truncated file, got %v", err)
+	}
+}
+
+func TestFilePersisterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("failed to create persister: %v", err)
+	}
+
+	snapshot, err := p.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("failed to read empty snapshot: %v", err)
+	}
+	if snapshot != nil {
+		t.Errorf("expected nil snapshot before first save, got %q", snapshot)
+	}
+
+	if err := p.SaveStateAndSnapshot([]byte("state"), []byte("snapshot")); err != nil {
+		t.Fatalf("failed to save state and snapshot: %v", err)
+	}
+	if err := p.SaveState([]byte("newer state")); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	reopened, err := NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen persister: %v", err)
+	}
+	state, err := reopened.ReadState()
+	if err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if string(state) != "newer state" {
+		t.Errorf("expected state %q, got %q", "newer state", state)
+	}
+	snapshot, err = reopened.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	if string(snapshot) != "snapshot" {
+		t.Errorf("expected snapshot %q, got %q", "snapshot", snapshot)
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import "sync"
+
+// MemoryPersister keeps state in memory. It is meant for tests, where a
+// "crash" is simulated by handing a Copy of the persister to a new node.
+type MemoryPersister struct {
+	mu       sync.Mutex
+	state    []byte
+	snapshot []byte
+}
+
+func NewMemoryPersister() *MemoryPersister {
+	return &MemoryPersister{}
+}
+
+func (p *MemoryPersister) SaveState(state []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state = clone(state)
+	return nil
+}
+
+func (p *MemoryPersister) ReadState() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return clone(p.state), nil
+}
+
+func (p *MemoryPersister) SaveStateAndSnapshot(state []byte, snapshot []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state = clone(state)
+	p.snapshot = clone(snapshot)
+	return nil
+}
+
+func (p *MemoryPersister) ReadSnapshot() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return clone(p.snapshot), nil
+}
+
+// Copy returns an independent persister holding the same state, so that a
+// crashed node still running in the background cannot overwrite the state
+// its replacement restarts from.
+func (p *MemoryPersister) Copy() *MemoryPersister {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &MemoryPersister{state: clone(p.state), snapshot: clone(p.snapshot)}
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,24 @@
+package storage
+
+import "errors"
+
+// ErrCorrupt is returned when persisted state fails its checksum.
+var ErrCorrupt = errors.New("storage: persisted state is corrupt")
+
+// Persister holds the Raft state that has to survive a crash: the current
+// term, the vote, the log and the latest snapshot. Raft encodes that state
+// itself and hands the persister opaque blobs, so this package does not
+// depend on raft.
+type Persister interface {
+	// SaveState durably replaces the stored state. It must not return
+	// until the data is on stable storage.
+	SaveState(state []byte) error
+	// ReadState returns the last saved state, or nil if nothing was saved.
+	ReadState() ([]byte, error)
+	// SaveStateAndSnapshot durably replaces both the state and the
+	// snapshot. The snapshot is written first, so after a crash the
+	// snapshot may be newer than the state but never older.
+	SaveStateAndSnapshot(state []byte, snapshot []byte) error
+	// ReadSnapshot returns the last saved snapshot, or nil if there is none.
+	ReadSnapshot() ([]byte, error)
+}
@@ -1,16 +1,20 @@
 package internal
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var addForce bool
+
 var addCmd = &cobra.Command{
-	Use:   "add [file...]",
+	Use:   "add [file|directory...]",
 	Short: "Add files to the staging area",
 	Run: func(_ *cobra.Command, args []string) {
 		runAdd(args)
@@ -18,6 +22,7 @@ var addCmd = &cobra.Command{
 }
 
 func init() {
+	addCmd.Flags().BoolVarP(&addForce, "force", "f", false, "add files even if they are ignored")
 	rootCmd.AddCommand(addCmd)
 }
 
@@ -32,48 +37,140 @@ func runAdd(args []string) {
 		return
 	}
 
-	index := make(map[string]string)
-	indexPath := ".mini-git/index"
-
-	if _, err := os.Stat(indexPath); err == nil {
-		file, err := os.Open(indexPath)
-		if err == nil {
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				parts := strings.Split(scanner.Text(), " ")
-				if len(parts) == 2 {
-					index[parts[1]] = parts[0]
-				}
-			}
-			file.Close()
-		}
+	index, err := loadIndex()
+	if err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		return
 	}
 
+	var added, ignored []string
 	for _, path := range args {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", path, err)
+		// Index paths are relative and slash-separated, as in tree objects.
+		key := filepath.ToSlash(filepath.Clean(path))
+
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			paths, err := addDirectory(index, key)
+			if errors.Is(err, errPathIgnored) {
+				ignored = append(ignored, path)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Error adding directory %s: %v\n", path, err)
+			}
+			added = append(added, paths...)
 			continue
 		}
 
-		hash, err := StoreObject(data)
-		if err != nil {
-			fmt.Printf("Error storing object for %s: %v\n", path, err)
-			continue
+		if _, tracked := index[key]; !tracked && !addForce {
+			isIgnored, err := ignoredPath(key, false)
+			if err != nil {
+				fmt.Printf("Error reading ignore files: %v\n", err)
+				return
+			}
+			if isIgnored {
+				ignored = append(ignored, path)
+				continue
+			}
 		}
 
-		index[path] = hash
+		if _, err := addFile(index, key); err != nil {
+			fmt.Printf("Error adding %s: %v\n", path, err)
+			continue
+		}
+		added = append(added, key)
 		fmt.Printf("Added %s\n", path)
 	}
 
-	file, err := os.Create(indexPath)
-	if err != nil {
-		fmt.Printf("Error creating index file: %v\n", err)
+	if len(ignored) > 0 {
+		fmt.Printf("The following paths are ignored by one of your %s files:\n", ignoreFile)
+		for _, path := range ignored {
+			fmt.Println(path)
+		}
+		fmt.Println("Use -f if you really want to add them.")
+	}
+
+	if err := saveIndex(index); err != nil {
+		fmt.Printf("Error writing index file: %v\n", err)
 		return
 	}
-	defer file.Close()
+	if err := resolveConflicts(added); err != nil {
+		fmt.Printf("Error updating merge conflicts: %v\n", err)
+	}
+}
 
-	for path, hash := range index {
-		fmt.Fprintf(file, "%s %s\n", hash, path)
+// addFile stores the file at path, relative to the repository root and
+// slash-separated, and stages it. It reports whether the index changed.
+func addFile(index map[string]string, path string) (bool, error) {
+	data, err := os.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return false, err
+	}
+	hash, err := StoreObject(blobObject, data)
+	if err != nil {
+		return false, err
+	}
+	changed := index[path] != hash
+	index[path] = hash
+	return changed, nil
+}
+
+// addDirectory stages everything below dir as "git add <dir>" does: files
+// that are not ignored (or all of them with --force), changes to tracked
+// files, ignored or not, and the removal of tracked files that are gone.
+// Only changed paths are reported, but every staged path is returned: a
+// conflicted file may be resolved to exactly what the index holds. If dir
+// is ignored and holds no tracked files, it returns errPathIgnored.
+func addDirectory(index map[string]string, dir string) ([]string, error) {
+	walk := walkWorktree
+	if addForce {
+		walk = walkAll
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	err := walk(dir, func(path string) error {
+		seen[path] = true
+		paths = append(paths, path)
+		return nil
+	})
+	ignoredDir := errors.Is(err, errPathIgnored)
+	if err != nil && !ignoredDir {
+		return nil, err
+	}
+
+	var gone []string
+	for path := range index {
+		if seen[path] || (dir != "." && !strings.HasPrefix(path, dir+"/")) {
+			continue
+		}
+		if _, err := os.Stat(filepath.FromSlash(path)); os.IsNotExist(err) {
+			gone = append(gone, path)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	if ignoredDir && len(paths) == 0 && len(gone) == 0 {
+		return nil, errPathIgnored
+	}
+	sort.Strings(paths)
+	sort.Strings(gone)
+
+	var staged []string
+	for _, path := range paths {
+		changed, err := addFile(index, path)
+		if err != nil {
+			return staged, err
+		}
+		staged = append(staged, path)
+		if changed {
+			fmt.Printf("Added %s\n", path)
+		}
+	}
+	for _, path := range gone {
+		delete(index, path)
+		staged = append(staged, path)
+		fmt.Printf("Removed %s\n", path)
 	}
+	return staged, nil
 }
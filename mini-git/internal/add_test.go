@@ -3,7 +3,6 @@ package internal
 import (
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 )
 
@@ -30,35 +29,33 @@ func TestRunAdd(t *testing.T) {
 	// Run add command
 	runAdd([]string{fileName})
 
-	// Check if object exists
-	// The hash of "hello mini-git" is 79347895493b827e8a939103c80a8c2041d50c7c
-	// Let's verify it dynamically
-	indexPath := ".mini-git/index"
-	data, err := os.ReadFile(indexPath)
+	// Check if object exists under the ID git gives the same blob
+	// (git hash-object prints 51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f)
+	index, err := loadIndex()
 	if err != nil {
 		t.Fatalf("failed to read index: %v", err)
 	}
 
-	indexContent := string(data)
-	if !strings.Contains(indexContent, fileName) {
-		t.Errorf("index does not contain file name")
+	hash, ok := index[fileName]
+	if !ok {
+		t.Fatalf("index does not contain file name")
 	}
-
-	parts := strings.Split(indexContent, " ")
-	if len(parts) < 1 {
-		t.Fatalf("unexpected index format")
+	if hash != "51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f" {
+		t.Errorf("expected git's blob ID, got %s", hash)
 	}
-	hash := parts[0]
 
 	objectPath := filepath.Join(".mini-git", "objects", hash[:2], hash[2:])
 	if _, err := os.Stat(objectPath); os.IsNotExist(err) {
 		t.Errorf("object file %s was not created", objectPath)
 	}
 
-	objectData, err := os.ReadFile(objectPath)
+	kind, objectData, err := ReadTypedObject(hash)
 	if err != nil {
 		t.Fatalf("failed to read object: %v", err)
 	}
+	if kind != "blob" {
+		t.Errorf("expected a blob, got %q", kind)
+	}
 	if string(objectData) != fileContent {
 		t.Errorf("expected object content %q, got %q", fileContent, string(objectData))
 	}
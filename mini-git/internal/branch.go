@@ -34,11 +34,14 @@ func runBranch(args []string) {
 }
 
 func listBranches() {
-	currentBranch, err := getCurrentBranch()
+	currentBranch, detached, err := readHead()
 	if err != nil {
 		fmt.Printf("Error getting current branch: %v\n", err)
 		return
 	}
+	if detached {
+		fmt.Printf("* (HEAD detached at %s)\n", currentBranch[:7])
+	}
 
 	files, err := os.ReadDir(".mini-git/refs/heads")
 	if err != nil {
@@ -56,16 +59,9 @@ func listBranches() {
 }
 
 func createBranch(name string) {
-	currentBranch, err := getCurrentBranch()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
-	}
-
-	branchPath := filepath.Join(".mini-git", "refs", "heads", currentBranch)
-	commitHash, err := os.ReadFile(branchPath)
+	commitHash, err := ResolveRef("HEAD")
 	if err != nil {
-		fmt.Println("Error: Not a valid object name: 'main'. (Have you committed yet?)")
+		fmt.Println("Error: Not a valid object name: 'HEAD'. (Have you committed yet?)")
 		return
 	}
 
@@ -75,7 +71,7 @@ func createBranch(name string) {
 		return
 	}
 
-	if err := os.WriteFile(newBranchPath, commitHash, 0644); err != nil {
+	if err := os.WriteFile(newBranchPath, []byte(commitHash), 0644); err != nil {
 		fmt.Printf("Error creating branch: %v\n", err)
 		return
 	}
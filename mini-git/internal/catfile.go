@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	catFileType   bool
+	catFilePretty bool
+	catFileSize   bool
+)
+
+var catFileCmd = &cobra.Command{
+	Use:   "cat-file (-t | -s | -p) <object>",
+	Short: "Show the type, size or contents of an object",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		runCatFile(args)
+	},
+}
+
+func init() {
+	catFileCmd.Flags().BoolVarP(&catFileType, "type", "t", false, "show the object's type")
+	catFileCmd.Flags().BoolVarP(&catFileSize, "size", "s", false, "show the object's size")
+	catFileCmd.Flags().BoolVarP(&catFilePretty, "pretty", "p", false, "pretty-print the object's contents")
+	rootCmd.AddCommand(catFileCmd)
+}
+
+func runCatFile(args []string) {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+
+	modes := 0
+	for _, set := range []bool{catFileType, catFileSize, catFilePretty} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 || len(args) != 1 {
+		fmt.Println("usage: mini-git cat-file (-t | -s | -p) <object>")
+		return
+	}
+
+	hash, err := ResolveRef(args[0])
+	if err != nil {
+		fmt.Printf("fatal: Not a valid object name %s\n", args[0])
+		return
+	}
+	kind, data, err := ReadTypedObject(hash)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		return
+	}
+
+	switch {
+	case catFileType:
+		fmt.Println(kind)
+	case catFileSize:
+		fmt.Println(len(data))
+	case kind == treeObject:
+		entries, err := decodeTree(data)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			return
+		}
+		for _, e := range entries {
+			entryKind := blobObject
+			if e.mode == modeTree {
+				entryKind = treeObject
+			}
+			fmt.Printf("%06s %s %s\t%s\n", e.mode, entryKind, e.hash, e.name)
+		}
+	default:
+		os.Stdout.Write(data)
+	}
+}
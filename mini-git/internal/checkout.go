@@ -2,13 +2,18 @@ package internal
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var checkoutCmd = &cobra.Command{
-	Use:   "checkout",
-	Short: "Checkout a commit",
+	Use:   "checkout <branch|commit>",
+	Short: "Switch branches or check out a commit",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		runCheckout(cmd, args)
 	},
@@ -18,6 +23,186 @@ func init() {
 	rootCmd.AddCommand(checkoutCmd)
 }
 
-func runCheckout(cmd *cobra.Command, args []string) {
-	fmt.Println("Checking out a commit")
+func runCheckout(_ *cobra.Command, args []string) {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+	if len(args) != 1 {
+		fmt.Println("usage: mini-git checkout <branch|commit>")
+		return
+	}
+	target := args[0]
+
+	// A branch name wins over a hash prefix that happens to match it.
+	isBranch := branchExists(target)
+	hash, err := ResolveRef(target)
+	if err != nil {
+		fmt.Printf("error: pathspec '%s' did not match any branch or commit (%v)\n", target, err)
+		return
+	}
+	targetCommit, err := readCommit(hash)
+	if err != nil || targetCommit.tree == "" {
+		fmt.Printf("error: '%s' is not a commit\n", target)
+		return
+	}
+
+	if current, err := getCurrentBranch(); err == nil && isBranch && current == target {
+		fmt.Printf("Already on '%s'\n", target)
+		return
+	}
+
+	if err := switchTree(targetCommit.tree); err != nil {
+		fmt.Printf("error: %v\n", err)
+		fmt.Println("Aborting")
+		return
+	}
+
+	if isBranch {
+		err = os.WriteFile(filepath.Join(".mini-git", "HEAD"), []byte("ref: refs/heads/"+target+"\n"), 0644)
+	} else {
+		err = os.WriteFile(filepath.Join(".mini-git", "HEAD"), []byte(hash+"\n"), 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error updating HEAD: %v\n", err)
+		return
+	}
+
+	if isBranch {
+		fmt.Printf("Switched to branch '%s'\n", target)
+	} else {
+		fmt.Printf("HEAD is now at %s %s\n", hash[:7], firstLine(targetCommit.message))
+		fmt.Println("You are in 'detached HEAD' state. Commits made here belong to no branch;")
+		fmt.Println("create one with 'mini-git branch <name>' to keep them.")
+	}
+}
+
+// headTree returns the files of the commit HEAD points at, which is empty
+// before the first commit.
+func headTree() (map[string]string, error) {
+	hash, err := headCommit()
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		return map[string]string{}, nil
+	}
+	c, err := readCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	return readTree(c.tree)
+}
+
+// switchTree moves the working tree and index from HEAD's tree to tree.
+// Only paths that differ between the two trees are touched, so local
+// changes to other files are carried over, as in git. If any touched path
+// has changes that are not committed, or is an untracked file in the way,
+// nothing is modified and an error lists the offending paths.
+func switchTree(tree string) error {
+	from, err := headTree()
+	if err != nil {
+		return err
+	}
+	to, err := readTree(tree)
+	if err != nil {
+		return err
+	}
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]bool)
+	for path, hash := range from {
+		if to[path] != hash {
+			changed[path] = true
+		}
+	}
+	for path, hash := range to {
+		if from[path] != hash {
+			changed[path] = true
+		}
+	}
+
+	if err := checkOverwrite("checkout", "switch branches", from, index, to, changed); err != nil {
+		return err
+	}
+
+	for path := range changed {
+		hash, keep := to[path]
+		if !keep {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyParents(path)
+			delete(index, path)
+			continue
+		}
+
+		data, err := ReadObject(hash)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		index[path] = hash
+	}
+
+	return saveIndex(index)
+}
+
+// checkOverwrite reports the paths among changed that op would overwrite:
+// tracked files whose index or working tree copy differs from head, and
+// untracked files that differ from what to puts there. action completes
+// the hint "Please commit your changes before you ...".
+func checkOverwrite(op, action string, head, index, to map[string]string, changed map[string]bool) error {
+	var dirty, untracked []string
+	for path := range changed {
+		staged, tracked := index[path]
+		committed, inHead := head[path]
+		if tracked != inHead || staged != committed {
+			dirty = append(dirty, path)
+			continue
+		}
+
+		current, err := hashFile(path)
+		switch {
+		case os.IsNotExist(err):
+			if inHead {
+				dirty = append(dirty, path)
+			}
+		case err != nil:
+			return err
+		case !tracked:
+			if current != to[path] {
+				untracked = append(untracked, path)
+			}
+		case current != staged:
+			dirty = append(dirty, path)
+		}
+	}
+	if len(dirty) > 0 {
+		sort.Strings(dirty)
+		return fmt.Errorf("your local changes to the following files would be overwritten by %s:\n\t%s\nPlease commit your changes before you %s.", op, strings.Join(dirty, "\n\t"), action)
+	}
+	if len(untracked) > 0 {
+		sort.Strings(untracked)
+		return fmt.Errorf("the following untracked working tree files would be overwritten by %s:\n\t%s\nPlease move or remove them before you %s.", op, strings.Join(untracked, "\n\t"), action)
+	}
+	return nil
+}
+
+// removeEmptyParents deletes the directories above path that are now
+// empty, stopping at the repository root.
+func removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// commitFiles writes and stages files, then commits them with message.
+func commitFiles(t *testing.T, message string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		runAdd([]string{name})
+	}
+	commitMessage = message
+	runCommit(nil, nil)
+
+	hash, err := ResolveRef("HEAD")
+	if err != nil {
+		t.Fatalf("commit %q was not recorded: %v", message, err)
+	}
+	return hash
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestRunCheckoutBranch(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	base := commitFiles(t, "base", map[string]string{"a.txt": "v1", "dir/b.txt": "b"})
+	runBranch([]string{"feature"})
+	commitFiles(t, "main work", map[string]string{"a.txt": "v2", "new/c.txt": "c"})
+
+	runCheckout(nil, []string{"feature"})
+
+	if branch, _ := getCurrentBranch(); branch != "feature" {
+		t.Fatalf("expected to be on feature, got %q", branch)
+	}
+	if got := readFile(t, "a.txt"); got != "v1" {
+		t.Errorf("a.txt is %q, want v1", got)
+	}
+	if _, err := os.Stat("new"); !os.IsNotExist(err) {
+		t.Errorf("new/ should have been removed, stat error %v", err)
+	}
+	index, _ := loadIndex()
+	want, _ := headTree()
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("index %v does not match feature's tree %v", index, want)
+	}
+	if head, _ := ResolveRef("HEAD"); head != base {
+		t.Errorf("HEAD resolves to %s, want %s", head, base)
+	}
+
+	runCheckout(nil, []string{"main"})
+	if got := readFile(t, "new/c.txt"); got != "c" {
+		t.Errorf("new/c.txt is %q after switching back, want c", got)
+	}
+}
+
+func TestRunCheckoutRefusesToClobber(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	commitFiles(t, "base", map[string]string{"a.txt": "v1", "same.txt": "same"})
+	runBranch([]string{"feature"})
+	commitFiles(t, "main work", map[string]string{"a.txt": "v2"})
+
+	// An unstaged edit to a file the checkout would overwrite.
+	if err := os.WriteFile("a.txt", []byte("local"), 0644); err != nil {
+		t.Fatalf("failed to modify a.txt: %v", err)
+	}
+	runCheckout(nil, []string{"feature"})
+	if branch, _ := getCurrentBranch(); branch != "main" {
+		t.Fatalf("checkout went ahead over local changes, now on %q", branch)
+	}
+	if got := readFile(t, "a.txt"); got != "local" {
+		t.Fatalf("local change was overwritten: %q", got)
+	}
+
+	// Changes to files both branches agree on are carried over.
+	if err := os.WriteFile("a.txt", []byte("v2"), 0644); err != nil {
+		t.Fatalf("failed to restore a.txt: %v", err)
+	}
+	if err := os.WriteFile("same.txt", []byte("edited"), 0644); err != nil {
+		t.Fatalf("failed to modify same.txt: %v", err)
+	}
+	runCheckout(nil, []string{"feature"})
+	if branch, _ := getCurrentBranch(); branch != "feature" {
+		t.Fatalf("checkout refused although the change does not conflict")
+	}
+	if got := readFile(t, "same.txt"); got != "edited" {
+		t.Errorf("carried-over change was lost: %q", got)
+	}
+}
+
+func TestRunCheckoutDetached(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	first := commitFiles(t, "first", map[string]string{"a.txt": "v1"})
+	commitFiles(t, "second", map[string]string{"a.txt": "v2"})
+
+	runCheckout(nil, []string{first[:7]})
+
+	if _, err := getCurrentBranch(); !errors.Is(err, errDetachedHead) {
+		t.Fatalf("expected a detached HEAD, got %v", err)
+	}
+	if head, _ := ResolveRef("HEAD"); head != first {
+		t.Fatalf("HEAD resolves to %s, want %s", head, first)
+	}
+	if got := readFile(t, "a.txt"); got != "v1" {
+		t.Errorf("a.txt is %q, want v1", got)
+	}
+
+	// Commits on a detached HEAD move HEAD but no branch.
+	detached := commitFiles(t, "detached", map[string]string{"a.txt": "v3"})
+	c, _ := readCommit(detached)
+	if !reflect.DeepEqual(c.parents, []string{first}) {
+		t.Errorf("detached commit has parents %v, want %s", c.parents, first)
+	}
+	if main, _ := ResolveRef("main"); main == detached {
+		t.Errorf("main moved to the detached commit")
+	}
+
+	runStatus()
+	runBranch(nil)
+}
+
+func TestResolveRef(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	if _, err := ResolveRef("HEAD"); err == nil {
+		t.Errorf("HEAD resolved before the first commit")
+	}
+
+	hash := commitFiles(t, "first", map[string]string{"a.txt": "a"})
+	for _, ref := range []string{"HEAD", "main", hash, hash[:4], hash[:12]} {
+		if got, err := ResolveRef(ref); err != nil || got != hash {
+			t.Errorf("ResolveRef(%q) = %q, %v; want %s", ref, got, err, hash)
+		}
+	}
+	for _, ref := range []string{"nope", "zzzz", "abc"} {
+		if got, err := ResolveRef(ref); err == nil {
+			t.Errorf("ResolveRef(%q) = %q, want an error", ref, got)
+		}
+	}
+}
+
+func TestUpdateHeadRejectsMalformedHead(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	hash := commitFiles(t, "first", map[string]string{"a.txt": "a"})
+
+	headPath := filepath.Join(".mini-git", "HEAD")
+	if err := os.WriteFile(headPath, []byte("garbage\n"), 0644); err != nil {
+		t.Fatalf("failed to corrupt HEAD: %v", err)
+	}
+	if err := updateHead(hash); err == nil {
+		t.Errorf("updateHead accepted a malformed HEAD")
+	}
+	if got := readFile(t, headPath); got != "garbage\n" {
+		t.Errorf("malformed HEAD was overwritten with %q", got)
+	}
+
+	// A detached HEAD is still moved directly.
+	if err := os.WriteFile(headPath, []byte(hash+"\n"), 0644); err != nil {
+		t.Fatalf("failed to detach HEAD: %v", err)
+	}
+	second, err := writeCommit(mustTree(t, hash), []string{hash}, "second")
+	if err != nil {
+		t.Fatalf("writeCommit failed: %v", err)
+	}
+	if err := updateHead(second); err != nil {
+		t.Fatalf("updateHead on a detached HEAD failed: %v", err)
+	}
+	if got := readFile(t, headPath); got != second+"\n" {
+		t.Errorf("detached HEAD is %q, want %s", got, second)
+	}
+}
+
+func mustTree(t *testing.T, commitHash string) string {
+	t.Helper()
+	c, err := readCommit(commitHash)
+	if err != nil {
+		t.Fatalf("failed to read commit %s: %v", commitHash, err)
+	}
+	return c.tree
+}
@@ -2,22 +2,215 @@ package internal
 
 import (
 	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var commitMessage string
+
 var commitCmd = &cobra.Command{
-	Use:   "commit",
-	Short: "Show commit logs",
+	Use:   "commit -m <message>",
+	Short: "Record the staged changes in a new commit",
 	Run: func(cmd *cobra.Command, args []string) {
 		runCommit(cmd, args)
 	},
 }
 
 func init() {
+	commitCmd.Flags().StringVarP(&commitMessage, "message", "m", "", "commit message")
 	rootCmd.AddCommand(commitCmd)
 }
 
-func runCommit(cmd *cobra.Command, args []string) {
-	fmt.Println("Showing commit logs")
+// commit is a parsed commit object.
+type commit struct {
+	tree      string
+	parents   []string
+	author    string
+	committer string
+	message   string
+}
+
+func runCommit(_ *cobra.Command, _ []string) {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+
+	// A merge stopped by conflicts is committed once they are all resolved,
+	// with the merged commit as the second parent.
+	mergeHead, err := readMergeHead()
+	if err != nil {
+		fmt.Printf("Error reading MERGE_HEAD: %v\n", err)
+		return
+	}
+	message := commitMessage
+	if mergeHead != "" {
+		conflicts, err := loadConflicts()
+		if err != nil {
+			fmt.Printf("Error reading merge conflicts: %v\n", err)
+			return
+		}
+		if len(conflicts) > 0 {
+			fmt.Println("error: Committing is not possible because you have unmerged files:")
+			for _, path := range conflicts {
+				fmt.Printf("\t%s\n", path)
+			}
+			fmt.Println("Fix them up in the working tree, then use 'mini-git add <file>' to mark resolution.")
+			return
+		}
+		if strings.TrimSpace(message) == "" {
+			data, _ := os.ReadFile(mergeMsgPath)
+			message = string(data)
+		}
+	}
+
+	if strings.TrimSpace(message) == "" {
+		fmt.Println("Aborting commit due to empty commit message (use -m <message>)")
+		return
+	}
+
+	index, err := loadIndex()
+	if err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		return
+	}
+	if len(index) == 0 {
+		fmt.Println("nothing to commit (use \"mini-git add\" to stage files)")
+		return
+	}
+
+	tree, err := writeTree(index)
+	if err != nil {
+		fmt.Printf("Error writing tree: %v\n", err)
+		return
+	}
+
+	var parents []string
+	if parent, err := ResolveRef("HEAD"); err == nil {
+		parentCommit, err := readCommit(parent)
+		if err != nil {
+			fmt.Printf("Error reading commit %s: %v\n", parent, err)
+			return
+		}
+		if parentCommit.tree == tree && mergeHead == "" {
+			fmt.Println("nothing to commit, working tree clean")
+			return
+		}
+		parents = append(parents, parent)
+	}
+	if mergeHead != "" {
+		parents = append(parents, mergeHead)
+	}
+
+	hash, err := writeCommit(tree, parents, message)
+	if err != nil {
+		fmt.Printf("Error writing commit: %v\n", err)
+		return
+	}
+
+	if err := updateHead(hash); err != nil {
+		fmt.Printf("Error updating HEAD: %v\n", err)
+		return
+	}
+	if err := clearMergeState(); err != nil {
+		fmt.Printf("Error clearing merge state: %v\n", err)
+	}
+
+	branch, err := getCurrentBranch()
+	if err != nil {
+		branch = "detached HEAD"
+	}
+	if len(parents) == 0 {
+		branch += " (root-commit)"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, hash[:7], firstLine(message))
+}
+
+// writeCommit stores a commit object for tree with the given parents, and
+// the current user and time as author and committer.
+func writeCommit(tree string, parents []string, message string) (string, error) {
+	signature := fmt.Sprintf("%s %d %s", authorIdentity(), time.Now().Unix(), time.Now().Format("-0700"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", tree)
+	for _, parent := range parents {
+		fmt.Fprintf(&b, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&b, "author %s\n", signature)
+	fmt.Fprintf(&b, "committer %s\n", signature)
+	b.WriteString("\n")
+	b.WriteString(strings.TrimRight(message, "\n"))
+	b.WriteString("\n")
+
+	return StoreObject(commitObject, []byte(b.String()))
+}
+
+// authorIdentity returns "Name <email>" from GIT_AUTHOR_NAME and
+// GIT_AUTHOR_EMAIL, falling back to the login name.
+func authorIdentity() string {
+	name := os.Getenv("GIT_AUTHOR_NAME")
+	email := os.Getenv("GIT_AUTHOR_EMAIL")
+	if name == "" || email == "" {
+		login := "mini-git"
+		if u, err := user.Current(); err == nil && u.Username != "" {
+			login = u.Username
+		}
+		if name == "" {
+			name = login
+		}
+		if email == "" {
+			host, err := os.Hostname()
+			if err != nil || host == "" {
+				host = "localhost"
+			}
+			email = login + "@" + host
+		}
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+func readCommit(hash string) (commit, error) {
+	kind, data, err := ReadTypedObject(hash)
+	if err != nil {
+		return commit{}, err
+	}
+	if kind != commitObject {
+		return commit{}, fmt.Errorf("object %s is a %s, not a commit", hash, kind)
+	}
+	return parseCommit(data), nil
+}
+
+// parseCommit reads the headers of a commit object up to the first blank
+// line; everything after it is the message.
+func parseCommit(data []byte) commit {
+	var c commit
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+	c.message = message
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "tree":
+			c.tree = value
+		case "parent":
+			c.parents = append(c.parents, value)
+		case "author":
+			c.author = value
+		case "committer":
+			c.committer = value
+		}
+	}
+	return c
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
 }
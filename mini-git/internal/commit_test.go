@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunCommit(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+	t.Setenv("GIT_AUTHOR_NAME", "User")
+	t.Setenv("GIT_AUTHOR_EMAIL", "user@example.com")
+
+	runInit(nil, nil)
+
+	if err := os.MkdirAll(filepath.Join("src", "pkg"), 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+	files := map[string]string{
+		"README.md":          "readme",
+		"src/main.go":        "package main",
+		"src/pkg/pkg.go":     "package pkg",
+		"src/pkg/pkg_doc.go": "// Package pkg",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		runAdd([]string{name})
+	}
+
+	commitMessage = "Initial commit"
+	runCommit(nil, nil)
+
+	first, err := ResolveRef("HEAD")
+	if err != nil {
+		t.Fatalf("main was not advanced: %v", err)
+	}
+	c, err := readCommit(first)
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if len(c.parents) != 0 {
+		t.Errorf("root commit has parents %v", c.parents)
+	}
+	if !strings.HasPrefix(c.author, "User <user@example.com> ") {
+		t.Errorf("unexpected author %q", c.author)
+	}
+	if strings.TrimSpace(c.message) != "Initial commit" {
+		t.Errorf("unexpected message %q", c.message)
+	}
+
+	index, _ := loadIndex()
+	tree, err := readTree(c.tree)
+	if err != nil {
+		t.Fatalf("failed to read tree: %v", err)
+	}
+	if !reflect.DeepEqual(tree, index) {
+		t.Errorf("committed tree %v does not match index %v", tree, index)
+	}
+
+	// Nothing changed, so no new commit.
+	commitMessage = "Empty"
+	runCommit(nil, nil)
+	if head, _ := ResolveRef("HEAD"); head != first {
+		t.Errorf("commit without changes moved main to %s", head)
+	}
+
+	if err := os.WriteFile("README.md", []byte("new readme"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %v", err)
+	}
+	runAdd([]string{"README.md"})
+	commitMessage = "Update readme"
+	runCommit(nil, nil)
+
+	second, _ := ResolveRef("HEAD")
+	c, err = readCommit(second)
+	if err != nil {
+		t.Fatalf("failed to read second commit: %v", err)
+	}
+	if !reflect.DeepEqual(c.parents, []string{first}) {
+		t.Errorf("expected parent %s, got %v", first, c.parents)
+	}
+
+	runLog()
+}
+
+func TestRunCommitRequiresMessage(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	if err := os.WriteFile("a.txt", []byte("a"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	runAdd([]string{"a.txt"})
+
+	commitMessage = ""
+	runCommit(nil, nil)
+	if _, err := ResolveRef("HEAD"); err == nil {
+		t.Errorf("commit without a message was recorded")
+	}
+}
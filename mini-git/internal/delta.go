@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Deltas use git's format: the sizes of the base and the result as
+// variable-length integers, then instructions that either copy a range of
+// the base or insert up to 127 literal bytes.
+const (
+	// deltaBlock is the length of the base chunks that makeDelta indexes;
+	// shorter matches are inserted rather than copied.
+	deltaBlock = 16
+	// maxCopy is the longest range one copy instruction can hold.
+	maxCopy   = 0xffffff
+	maxInsert = 0x7f
+)
+
+var errBadDelta = errors.New("corrupt delta")
+
+// makeDelta returns a delta that rebuilds target from base. Every aligned
+// block of the base is indexed; wherever a block recurs in the target the
+// match is extended as far as it goes in both directions and copied, and
+// everything between matches is inserted.
+func makeDelta(base, target []byte) []byte {
+	blocks := make(map[string][]int)
+	for i := 0; i+deltaBlock <= len(base); i += deltaBlock {
+		key := string(base[i : i+deltaBlock])
+		if len(blocks[key]) < 8 {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	delta := appendDeltaSize(nil, len(base))
+	delta = appendDeltaSize(delta, len(target))
+
+	pending := 0 // start of the bytes not yet emitted
+	for i := 0; i+deltaBlock <= len(target); {
+		offsets, ok := blocks[string(target[i:i+deltaBlock])]
+		if !ok {
+			i++
+			continue
+		}
+
+		// Take the candidate giving the longest match.
+		bestStart, bestOff, bestLen := 0, 0, 0
+		for _, off := range offsets {
+			n := deltaBlock
+			for off+n < len(base) && i+n < len(target) && base[off+n] == target[i+n] {
+				n++
+			}
+			back := 0
+			for off-back > 0 && i-back > pending && base[off-back-1] == target[i-back-1] {
+				back++
+			}
+			if n+back > bestLen {
+				bestStart, bestOff, bestLen = i-back, off-back, n+back
+			}
+		}
+
+		delta = appendInsert(delta, target[pending:bestStart])
+		for n := bestLen; n > 0; {
+			chunk := min(n, maxCopy)
+			delta = appendCopy(delta, bestOff+bestLen-n, chunk)
+			n -= chunk
+		}
+		i = bestStart + bestLen
+		pending = i
+	}
+	return appendInsert(delta, target[pending:])
+}
+
+func appendDeltaSize(b []byte, n int) []byte {
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(b, byte(n))
+}
+
+func appendInsert(b []byte, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), maxInsert)
+		b = append(b, byte(n))
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+// appendCopy encodes a copy of size bytes at offset in the base. Only the
+// non-zero bytes of each are stored, flagged in the opcode.
+func appendCopy(b []byte, offset, size int) []byte {
+	op := len(b)
+	b = append(b, 0x80)
+	for i := 0; i < 4; i++ {
+		if v := byte(offset >> (8 * i)); v != 0 {
+			b[op] |= 1 << i
+			b = append(b, v)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if v := byte(size >> (8 * i)); v != 0 {
+			b[op] |= 0x10 << i
+			b = append(b, v)
+		}
+	}
+	return b
+}
+
+// applyDelta rebuilds an object from its base and a delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("%w: base is %d bytes, delta expects %d", errBadDelta, len(base), baseSize)
+	}
+	size, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	// Every remaining byte of the delta yields at most one inserted byte or
+	// one copy of up to 64KiB of the base, so a larger size is corrupt and
+	// must not be allocated.
+	perOp := min(len(base), 0x10000)
+	if size < 0 || size > len(delta)*max(perOp, 1) {
+		return nil, fmt.Errorf("%w: result size %d", errBadDelta, size)
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			n := int(op)
+			if n == 0 || n > len(delta) {
+				return nil, errBadDelta
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+
+		var offset, n int
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errBadDelta
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				n |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > len(base) {
+			return nil, errBadDelta
+		}
+		out = append(out, base[offset:offset+n]...)
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("%w: produced %d bytes, expected %d", errBadDelta, len(out), size)
+	}
+	return out, nil
+}
+
+func readDeltaSize(delta []byte) (int, []byte, error) {
+	n, shift := 0, 0
+	for i, b := range delta {
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, delta[i+1:], nil
+		}
+		shift += 7
+		if shift > 63 {
+			break
+		}
+	}
+	return 0, nil, errBadDelta
+}
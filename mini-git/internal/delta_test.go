@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of the original file", i))
+	}
+	base := []byte(strings.Join(lines, "\n"))
+
+	edited := append([]string(nil), lines...)
+	edited[10] = "an edited line"
+	edited = append(edited[:200], edited[260:]...)
+	edited = append([]string{"a new first line"}, edited...)
+
+	tests := map[string][]byte{
+		"edited":    []byte(strings.Join(edited, "\n")),
+		"identical": base,
+		"empty":     nil,
+		"unrelated": bytes.Repeat([]byte("xyz"), 300),
+		"repeated":  bytes.Repeat(base, 3),
+	}
+	for name, target := range tests {
+		delta := makeDelta(base, target)
+		got, err := applyDelta(base, delta)
+		if err != nil {
+			t.Errorf("%s: applyDelta failed: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, target) {
+			t.Errorf("%s: delta does not rebuild the target", name)
+		}
+	}
+
+	if delta := makeDelta(base, tests["edited"]); len(delta) > len(base)/20 {
+		t.Errorf("delta of a small edit is %d bytes for a %d byte file", len(delta), len(base))
+	}
+}
+
+func TestApplyDeltaRejectsCorruptDeltas(t *testing.T) {
+	base := []byte("0123456789")
+	tests := map[string][]byte{
+		"wrong base size": {5, 3, 0x91, 0, 3},
+		"copy past end":   {10, 4, 0x91, 8, 4},
+		"short insert":    {10, 4, 4, 'a'},
+		"wrong size":      {10, 5, 0x91, 0, 3},
+		"truncated":       {10},
+		"huge size":       {10, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x91, 0, 3},
+		"negative size":   {10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x91, 0, 3},
+	}
+	for name, delta := range tests {
+		if _, err := applyDelta(base, delta); !errors.Is(err, errBadDelta) {
+			t.Errorf("%s: got %v, want errBadDelta", name, err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffCached  bool
+	diffContext int
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [--cached] [<commit> [<commit>]]",
+	Short: "Show changes between the working tree, the index and commits",
+	Args:  cobra.MaximumNArgs(2),
+	Run: func(_ *cobra.Command, args []string) {
+		runDiff(args)
+	},
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffCached, "cached", false, "compare the index with HEAD (or the given commit)")
+	diffCmd.Flags().IntVarP(&diffContext, "unified", "U", 3, "lines of context around each change")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// diffSide is one side of a comparison: paths mapped to blob hashes, read
+// from the object store or, for the working tree, from disk.
+type diffSide struct {
+	files    map[string]string
+	worktree bool
+}
+
+func (s diffSide) read(path string) ([]byte, error) {
+	if s.worktree {
+		return os.ReadFile(filepath.FromSlash(path))
+	}
+	return ReadObject(s.files[path])
+}
+
+// runDiff compares, depending on the arguments:
+//
+//	diff                   the index with the working tree
+//	diff --cached [<c>]    HEAD (or commit c) with the index
+//	diff <c>               commit c with the working tree
+//	diff <c1> <c2>         commit c1 with commit c2
+func runDiff(args []string) {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+	if diffContext < 0 {
+		fmt.Println("fatal: context must not be negative")
+		return
+	}
+	if diffCached && len(args) > 1 {
+		fmt.Println("usage: mini-git diff [--cached] [<commit> [<commit>]]")
+		return
+	}
+
+	var from, to diffSide
+	var err error
+	switch {
+	case len(args) == 2:
+		if from, err = commitSide(args[0]); err == nil {
+			to, err = commitSide(args[1])
+		}
+	case diffCached:
+		if len(args) == 1 {
+			from, err = commitSide(args[0])
+		} else {
+			from, err = headSide()
+		}
+		if err == nil {
+			to, err = indexSide()
+		}
+	case len(args) == 1:
+		if from, err = commitSide(args[0]); err == nil {
+			var index diffSide
+			if index, err = indexSide(); err == nil {
+				to, err = worktreeSide(from.files, index.files)
+			}
+		}
+	default:
+		if from, err = indexSide(); err == nil {
+			to, err = worktreeSide(from.files)
+		}
+	}
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		return
+	}
+
+	if err := writeDiff(os.Stdout, from, to, diffContext); err != nil {
+		fmt.Printf("Error computing diff: %v\n", err)
+	}
+}
+
+func commitSide(rev string) (diffSide, error) {
+	hash, err := ResolveRef(rev)
+	if err != nil {
+		return diffSide{}, err
+	}
+	files, err := commitTreeFiles(hash)
+	return diffSide{files: files}, err
+}
+
+func headSide() (diffSide, error) {
+	files, err := headTree()
+	return diffSide{files: files}, err
+}
+
+func indexSide() (diffSide, error) {
+	files, err := loadIndex()
+	return diffSide{files: files}, err
+}
+
+// worktreeSide hashes the working tree copies of the tracked paths; paths
+// missing from disk are left out, so they show as deleted.
+func worktreeSide(tracked ...map[string]string) (diffSide, error) {
+	ix, err := readIndex()
+	if err != nil {
+		return diffSide{}, err
+	}
+	files := make(map[string]string)
+	for _, paths := range tracked {
+		for path := range paths {
+			if _, ok := files[path]; ok {
+				continue
+			}
+			hash, err := ix.worktreeHash(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return diffSide{}, err
+			}
+			files[path] = hash
+		}
+	}
+	return diffSide{files: files, worktree: true}, nil
+}
+
+// writeDiff writes a git-style unified diff from one side to the other,
+// with context lines around each change.
+func writeDiff(w io.Writer, from, to diffSide, context int) error {
+	paths := make(map[string]bool)
+	for path := range from.files {
+		paths[path] = true
+	}
+	for path := range to.files {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		oldHash, inOld := from.files[path]
+		newHash, inNew := to.files[path]
+		if oldHash == newHash {
+			continue
+		}
+
+		var oldData, newData []byte
+		var err error
+		if inOld {
+			if oldData, err = from.read(path); err != nil {
+				return err
+			}
+		}
+		if inNew {
+			if newData, err = to.read(path); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(w, "diff --git a/%s b/%s\n", path, path)
+		oldName, newName := "a/"+path, "b/"+path
+		switch {
+		case !inOld:
+			fmt.Fprintf(w, "new file mode %s\n", modeFile)
+			fmt.Fprintf(w, "index %s..%s\n", strings.Repeat("0", 7), newHash[:7])
+			oldName = "/dev/null"
+		case !inNew:
+			fmt.Fprintf(w, "deleted file mode %s\n", modeFile)
+			fmt.Fprintf(w, "index %s..%s\n", oldHash[:7], strings.Repeat("0", 7))
+			newName = "/dev/null"
+		default:
+			fmt.Fprintf(w, "index %s..%s %s\n", oldHash[:7], newHash[:7], modeFile)
+		}
+
+		if bytes.IndexByte(oldData, 0) >= 0 || bytes.IndexByte(newData, 0) >= 0 {
+			fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		if len(oldData) == 0 && len(newData) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "--- %s\n", oldName)
+		fmt.Fprintf(w, "+++ %s\n", newName)
+		writeHunks(w, splitLines(oldData), splitLines(newData), context)
+	}
+	return nil
+}
+
+// splitLines splits data after each newline. The last line keeps no
+// newline if the data does not end in one, so that difference shows up.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeHunks writes the changes between a and b as unified diff hunks.
+// Changes separated by no more than twice the context share a hunk.
+func writeHunks(w io.Writer, a, b []string, context int) {
+	script := myersDiff(a, b)
+
+	for i := 0; i < len(script); {
+		if script[i].kind == editEqual {
+			i++
+			continue
+		}
+
+		// Extend the hunk over later changes whose context would overlap.
+		last := i
+		for j := i + 1; j < len(script); j++ {
+			if script[j].kind == editEqual {
+				continue
+			}
+			if j-last-1 > 2*context {
+				break
+			}
+			last = j
+		}
+		lo := max(0, i-context)
+		hi := min(len(script), last+1+context)
+
+		oldStart, newStart := script[lo].oldLine, script[lo].newLine
+		oldCount, newCount := 0, 0
+		for _, e := range script[lo:hi] {
+			if e.kind != editInsert {
+				oldCount++
+			}
+			if e.kind != editDelete {
+				newCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+
+		for _, e := range script[lo:hi] {
+			var line string
+			if e.kind == editInsert {
+				line = b[e.newLine]
+			} else {
+				line = a[e.oldLine]
+			}
+			fmt.Fprintf(w, "%c%s", e.kind, line)
+			if !strings.HasSuffix(line, "\n") {
+				fmt.Fprint(w, "\n\\ No newline at end of file\n")
+			}
+		}
+		i = last + 1
+	}
+}
+
+// hunkRange formats a 0-based start and a line count as in a hunk header:
+// 1-based, with the count left out when it is one, and an empty range
+// given as the line before it.
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
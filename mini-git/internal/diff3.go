@@ -0,0 +1,77 @@
+package internal
+
+import "slices"
+
+// merge3 merges the changes from base to ours and from base to theirs, the
+// way diff3 does. Lines matched in all three texts split them into chunks;
+// a chunk changed on only one side, or the same way on both, takes that
+// change, and any other chunk is a conflict, written between markers
+// labelled with oursName and theirsName. It reports whether there were
+// conflicts.
+func merge3(base, ours, theirs []string, oursName, theirsName string) ([]string, bool) {
+	matchOurs := matches(base, ours)
+	matchTheirs := matches(base, theirs)
+
+	var out []string
+	conflict := false
+	o, a, b := 0, 0, 0
+	for o < len(base) || a < len(ours) || b < len(theirs) {
+		if o < len(base) && matchOurs[o] == a && matchTheirs[o] == b {
+			out = append(out, base[o])
+			o, a, b = o+1, a+1, b+1
+			continue
+		}
+
+		// The chunk runs up to the next base line both sides kept.
+		end := o
+		for end < len(base) && (matchOurs[end] < 0 || matchTheirs[end] < 0) {
+			end++
+		}
+		aEnd, bEnd := len(ours), len(theirs)
+		if end < len(base) {
+			aEnd, bEnd = matchOurs[end], matchTheirs[end]
+		}
+
+		baseChunk, oursChunk, theirsChunk := base[o:end], ours[a:aEnd], theirs[b:bEnd]
+		switch {
+		case slices.Equal(oursChunk, baseChunk), slices.Equal(oursChunk, theirsChunk):
+			out = append(out, theirsChunk...)
+		case slices.Equal(theirsChunk, baseChunk):
+			out = append(out, oursChunk...)
+		default:
+			conflict = true
+			out = append(out, "<<<<<<< "+oursName+"\n")
+			out = appendTerminated(out, oursChunk)
+			out = append(out, "=======\n")
+			out = appendTerminated(out, theirsChunk)
+			out = append(out, ">>>>>>> "+theirsName+"\n")
+		}
+		o, a, b = end, aEnd, bEnd
+	}
+	return out, conflict
+}
+
+// matches maps each line of a to the line of b it is paired with in a
+// shortest edit script, or -1 if it is deleted.
+func matches(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, e := range myersDiff(a, b) {
+		if e.kind == editEqual {
+			match[e.oldLine] = e.newLine
+		}
+	}
+	return match
+}
+
+// appendTerminated appends lines, adding a newline to the last one if it
+// has none so that a conflict marker after it starts on its own line.
+func appendTerminated(out, lines []string) []string {
+	out = append(out, lines...)
+	if n := len(out); len(lines) > 0 && out[n-1][len(out[n-1])-1] != '\n' {
+		out[n-1] += "\n"
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteHunks(t *testing.T) {
+	a := splitLines([]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"))
+	b := splitLines([]byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13"))
+
+	var out bytes.Buffer
+	writeHunks(&out, a, b, 1)
+
+	want := `@@ -2,3 +2,3 @@
+ 2
+-3
++three
+ 4
+@@ -12 +12,2 @@
+ 12
++13
+\ No newline at end of file
+`
+	if out.String() != want {
+		t.Errorf("hunks:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// With more context the two changes share one hunk.
+	out.Reset()
+	writeHunks(&out, a, b, 5)
+	if n := strings.Count(out.String(), "@@ -"); n != 1 {
+		t.Errorf("got %d hunks with 5 lines of context, want 1:\n%s", n, out.String())
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{0, 0, "0,0"},
+		{4, 0, "4,0"},
+		{0, 1, "1"},
+		{2, 3, "3,3"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	first := commitFiles(t, "first", map[string]string{"a.txt": "one\ntwo\n", "gone.txt": "bye\n"})
+
+	if err := os.Remove("gone.txt"); err != nil {
+		t.Fatalf("failed to remove gone.txt: %v", err)
+	}
+	staged, _ := loadIndex()
+	delete(staged, "gone.txt")
+	if err := saveIndex(staged); err != nil {
+		t.Fatalf("failed to unstage gone.txt: %v", err)
+	}
+	second := commitFiles(t, "second", map[string]string{"a.txt": "one\n2\n", "new.txt": "hello\n"})
+
+	if err := os.WriteFile("a.txt", []byte("one\n2\nthree\n"), 0644); err != nil {
+		t.Fatalf("failed to modify a.txt: %v", err)
+	}
+
+	diff := func(from, to diffSide, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("failed to load diff sides: %v", err)
+		}
+		var out bytes.Buffer
+		if err := writeDiff(&out, from, to, 3); err != nil {
+			t.Fatalf("writeDiff failed: %v", err)
+		}
+		return out.String()
+	}
+
+	// Index against the working tree.
+	index, err := indexSide()
+	worktree, werr := worktreeSide(index.files)
+	if werr != nil {
+		err = werr
+	}
+	got := diff(index, worktree, err)
+	if !strings.Contains(got, "@@ -1,2 +1,3 @@\n one\n 2\n+three\n") {
+		t.Errorf("worktree diff:\n%s", got)
+	}
+	if strings.Contains(got, "new.txt") {
+		t.Errorf("staged file new.txt should not appear in the worktree diff:\n%s", got)
+	}
+
+	// Commit against commit.
+	from, err := commitSide(first)
+	to, terr := commitSide(second)
+	if terr != nil {
+		err = terr
+	}
+	got = diff(from, to, err)
+	for _, want := range []string{
+		"diff --git a/a.txt b/a.txt\n",
+		"-two\n+2\n",
+		"diff --git a/gone.txt b/gone.txt\ndeleted file mode 100644\n",
+		"--- a/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+		"diff --git a/new.txt b/new.txt\nnew file mode 100644\n",
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hello\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("commit diff is missing %q:\n%s", want, got)
+		}
+	}
+	if a, n := strings.Index(got, "a/a.txt"), strings.Index(got, "a/new.txt"); a > n {
+		t.Errorf("files are not in path order:\n%s", got)
+	}
+
+	// HEAD against the index shows nothing until something is staged.
+	head, err := headSide()
+	if got := diff(head, index, err); got != "" {
+		t.Errorf("expected no staged changes, got:\n%s", got)
+	}
+	runAdd([]string{"a.txt"})
+	index, err = indexSide()
+	if got := diff(head, index, err); !strings.Contains(got, "+three\n") {
+		t.Errorf("cached diff:\n%s", got)
+	}
+}
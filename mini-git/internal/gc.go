@@ -0,0 +1,407 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// deltaWindow is how many of the preceding blobs are tried as the
+	// base for each one, as git's pack.window.
+	deltaWindow = 10
+	// maxDeltaDepth caps the chains gc creates, leaving room below
+	// maxDeltaChain for packs written by git.
+	maxDeltaDepth = 50
+	// minDeltaSize is the smallest blob worth storing as a delta.
+	minDeltaSize = 64
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Pack loose objects into a packfile, storing similar blobs as deltas",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		runGC()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
+
+// packObject is an object on its way into a pack.
+type packObject struct {
+	hash string
+	kind string
+	data []byte
+	// name is the file name the blob was last seen under, which groups
+	// versions of the same file for delta selection.
+	name   string
+	base   *packObject
+	delta  []byte
+	depth  int
+	offset int64
+	crc    uint32
+}
+
+func runGC() {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+
+	loose, err := looseObjects()
+	if err != nil {
+		fmt.Printf("Error listing objects: %v\n", err)
+		return
+	}
+	packs, err := loadPacks()
+	if err != nil {
+		fmt.Printf("Error reading packs: %v\n", err)
+		return
+	}
+	if len(loose) == 0 && len(packs) <= 1 {
+		fmt.Println("Nothing to pack.")
+		return
+	}
+
+	objects, err := collectObjects(loose, packs)
+	if err != nil {
+		fmt.Printf("Error reading objects: %v\n", err)
+		return
+	}
+	deltas := chooseDeltas(objects)
+
+	name, size, err := writePack(objects)
+	if err != nil {
+		fmt.Printf("Error writing pack: %v\n", err)
+		return
+	}
+
+	// Only now that the new pack is in place can the old copies go.
+	if err := prunePacked(loose, packs, name); err != nil {
+		fmt.Printf("Error removing packed objects: %v\n", err)
+		return
+	}
+	fmt.Printf("Packed %d objects (%d as deltas) into %s (%d bytes)\n", len(objects), deltas, name, size)
+}
+
+// looseObjects lists the IDs of the loose objects.
+func looseObjects() ([]string, error) {
+	dirs, err := os.ReadDir(filepath.Join(".mini-git", "objects"))
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(".mini-git", "objects", dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if hash := dir.Name() + entry.Name(); isHash(hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// collectObjects reads every loose and packed object, once each, and
+// names blobs after the tree entries that refer to them.
+func collectObjects(loose []string, packs []*packIndex) ([]*packObject, error) {
+	hashes := append([]string(nil), loose...)
+	for _, p := range packs {
+		for i := 0; i < p.count(); i++ {
+			hashes = append(hashes, hex.EncodeToString(p.name(i)))
+		}
+	}
+
+	byHash := make(map[string]*packObject)
+	var objects []*packObject
+	for _, hash := range hashes {
+		if byHash[hash] != nil {
+			continue
+		}
+		kind, data, err := ReadTypedObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		obj := &packObject{hash: hash, kind: kind, data: data}
+		byHash[hash] = obj
+		objects = append(objects, obj)
+	}
+
+	for _, obj := range objects {
+		if obj.kind != treeObject {
+			continue
+		}
+		entries, err := decodeTree(obj.data)
+		if err != nil {
+			return nil, fmt.Errorf("tree %s: %w", obj.hash, err)
+		}
+		for _, entry := range entries {
+			if blob := byHash[entry.hash]; blob != nil && blob.kind == blobObject {
+				blob.name = path.Base(entry.name)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// chooseDeltas orders objects for writing and picks a delta base for the
+// blobs where one saves at least half their size. Blobs are sorted by
+// name, then largest first, so versions of a file sit together and the
+// bigger one is usually the base; each blob tries the few before it.
+// Bases always come before their deltas. It returns the number of deltas.
+func chooseDeltas(objects []*packObject) int {
+	kindOrder := map[string]int{commitObject: 0, treeObject: 1, blobObject: 2}
+	sort.Slice(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if kindOrder[a.kind] != kindOrder[b.kind] {
+			return kindOrder[a.kind] < kindOrder[b.kind]
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.data) != len(b.data) {
+			return len(a.data) > len(b.data)
+		}
+		return a.hash < b.hash
+	})
+
+	deltas := 0
+	for i, obj := range objects {
+		if obj.kind != blobObject || len(obj.data) < minDeltaSize {
+			continue
+		}
+		for _, base := range objects[max(0, i-deltaWindow):i] {
+			if base.kind != blobObject || base.depth >= maxDeltaDepth {
+				continue
+			}
+			delta := makeDelta(base.data, obj.data)
+			if len(delta) >= len(obj.data)/2 || (obj.delta != nil && len(delta) >= len(obj.delta)) {
+				continue
+			}
+			obj.base, obj.delta, obj.depth = base, delta, base.depth+1
+		}
+		if obj.base != nil {
+			deltas++
+		}
+	}
+	return deltas
+}
+
+// writePack writes objects, in order, as a pack and its index, and returns
+// the pack's file name and size.
+func writePack(objects []*packObject) (string, int64, error) {
+	if err := os.MkdirAll(packDir(), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(packDir(), "tmp_pack_")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha1.New()
+	w := io.MultiWriter(tmp, sum)
+
+	var header bytes.Buffer
+	header.WriteString(packSignature)
+	binary.Write(&header, binary.BigEndian, uint32(packVersion))
+	binary.Write(&header, binary.BigEndian, uint32(len(objects)))
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return "", 0, err
+	}
+	offset := int64(header.Len())
+
+	for _, obj := range objects {
+		entry, err := encodePackEntry(obj, offset)
+		if err != nil {
+			return "", 0, err
+		}
+		obj.offset = offset
+		obj.crc = crc32.ChecksumIEEE(entry)
+		if _, err := w.Write(entry); err != nil {
+			return "", 0, err
+		}
+		offset += int64(len(entry))
+	}
+
+	checksum := sum.Sum(nil)
+	if _, err := tmp.Write(checksum); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	base := filepath.Join(packDir(), "pack-"+hex.EncodeToString(checksum))
+	if err := installPackFile(tmp.Name(), base+".pack"); err != nil {
+		return "", 0, err
+	}
+	// The index goes in last: readers only look for packs through it.
+	idx, err := os.CreateTemp(packDir(), "tmp_idx_")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(idx.Name())
+	if _, err := idx.Write(encodePackIndex(objects, checksum)); err != nil {
+		idx.Close()
+		return "", 0, err
+	}
+	if err := idx.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := installPackFile(idx.Name(), base+".idx"); err != nil {
+		return "", 0, err
+	}
+	return filepath.Base(base + ".pack"), offset + int64(len(checksum)), nil
+}
+
+// installPackFile makes the temporary file tmp read-only, as packs never
+// change, and renames it to name.
+func installPackFile(tmp, name string) error {
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// encodePackEntry returns the bytes of obj in a pack at offset: its header,
+// the distance back to its base if it is a delta, and the zlib data.
+func encodePackEntry(obj *packObject, offset int64) ([]byte, error) {
+	var typ int
+	data := obj.data
+	if obj.base != nil {
+		typ, data = packOfsDelta, obj.delta
+	} else {
+		for t, name := range packTypeNames {
+			if name == obj.kind {
+				typ = t
+			}
+		}
+		if typ == 0 {
+			return nil, fmt.Errorf("object %s has unknown type %q", obj.hash, obj.kind)
+		}
+	}
+
+	var buf bytes.Buffer
+	size := len(data)
+	b := byte(typ<<4) | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		buf.WriteByte(b | 0x80)
+		b = byte(size & 0x7f)
+	}
+	buf.WriteByte(b)
+
+	if obj.base != nil {
+		buf.Write(encodeOfsDeltaOffset(offset - obj.base.offset))
+	}
+
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeOfsDeltaOffset is the inverse of readOfsDeltaOffset.
+func encodeOfsDeltaOffset(rel int64) []byte {
+	out := []byte{byte(rel & 0x7f)}
+	for rel >>= 7; rel > 0; rel >>= 7 {
+		rel--
+		out = append([]byte{byte(0x80 | rel&0x7f)}, out...)
+	}
+	return out
+}
+
+// encodePackIndex builds the version 2 index of a pack holding objects,
+// whose offsets and CRCs have been filled in.
+func encodePackIndex(objects []*packObject, packChecksum []byte) []byte {
+	sorted := append([]*packObject(nil), objects...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].hash < sorted[j].hash })
+
+	var buf bytes.Buffer
+	buf.Write(idxSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(idxVersion))
+
+	var fanout [256]uint32
+	for _, obj := range sorted {
+		first, _ := hex.DecodeString(obj.hash[:2])
+		fanout[first[0]]++
+	}
+	total := uint32(0)
+	for i := range fanout {
+		total += fanout[i]
+		binary.Write(&buf, binary.BigEndian, total)
+	}
+
+	for _, obj := range sorted {
+		id, _ := hex.DecodeString(obj.hash)
+		buf.Write(id)
+	}
+	for _, obj := range sorted {
+		binary.Write(&buf, binary.BigEndian, obj.crc)
+	}
+	var large []int64
+	for _, obj := range sorted {
+		if obj.offset < 0x80000000 {
+			binary.Write(&buf, binary.BigEndian, uint32(obj.offset))
+			continue
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(0x80000000|len(large)))
+		large = append(large, obj.offset)
+	}
+	for _, off := range large {
+		binary.Write(&buf, binary.BigEndian, uint64(off))
+	}
+
+	buf.Write(packChecksum)
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+// prunePacked removes the loose objects and the old packs that the pack
+// named keep now holds, and the directories left empty.
+func prunePacked(loose []string, packs []*packIndex, keep string) error {
+	for _, hash := range loose {
+		dir := filepath.Join(".mini-git", "objects", hash[:2])
+		if err := os.Remove(filepath.Join(dir, hash[2:])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(dir) // only succeeds once the directory is empty
+	}
+	for _, p := range packs {
+		if filepath.Base(p.pack) == keep {
+			continue
+		}
+		for _, name := range []string{strings.TrimSuffix(p.pack, ".pack") + ".idx", p.pack} {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
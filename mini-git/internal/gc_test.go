@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunGC(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	var lines []string
+	for i := 0; i < 300; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	var commits []string
+	for i := 0; i < 4; i++ {
+		lines[i*50] = fmt.Sprintf("version %d", i)
+		commits = append(commits, commitFiles(t, fmt.Sprintf("version %d", i), map[string]string{
+			"big.txt":   strings.Join(lines, "\n"),
+			"small.txt": fmt.Sprint(i),
+		}))
+	}
+
+	loose, err := looseObjects()
+	if err != nil {
+		t.Fatalf("looseObjects failed: %v", err)
+	}
+	before := make(map[string][]byte)
+	for _, hash := range loose {
+		_, data, err := ReadTypedObject(hash)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", hash, err)
+		}
+		before[hash] = data
+	}
+
+	runGC()
+
+	if left, _ := looseObjects(); len(left) != 0 {
+		t.Errorf("%d loose objects left after gc", len(left))
+	}
+	packs, err := loadPacks()
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("expected one pack, got %d (%v)", len(packs), err)
+	}
+	for hash, data := range before {
+		_, got, err := ReadTypedObject(hash)
+		if err != nil {
+			t.Errorf("packed object %s: %v", hash, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("packed object %s changed", hash)
+		}
+	}
+
+	// Versions of big.txt should be stored as deltas.
+	packed, err := os.Stat(packs[0].pack)
+	if err != nil {
+		t.Fatalf("failed to stat pack: %v", err)
+	}
+	if size := len(strings.Join(lines, "\n")); packed.Size() > int64(2*size) {
+		t.Errorf("pack is %d bytes for four versions of a %d byte file", packed.Size(), size)
+	}
+
+	if hash, err := ResolveRef(commits[1][:8]); err != nil || hash != commits[1] {
+		t.Errorf("short hash of a packed commit resolved to %s, %v", hash, err)
+	}
+	entries, err := walkHistory(commits[3])
+	if err != nil || len(entries) != 4 {
+		t.Errorf("history from the packed tip has %d commits (%v), want 4", len(entries), err)
+	}
+
+	// Storing a packed object again does not create a loose copy, and a
+	// second gc folds new objects and the old pack into one.
+	if _, err := StoreObject(blobObject, []byte("0")); err != nil {
+		t.Fatalf("StoreObject failed: %v", err)
+	}
+	if left, _ := looseObjects(); len(left) != 0 {
+		t.Errorf("storing a packed object wrote a loose copy")
+	}
+	commitFiles(t, "more", map[string]string{"new.txt": "new"})
+	runGC()
+
+	packs, _ = loadPacks()
+	names, _ := filepath.Glob(filepath.Join(packDir(), "*"))
+	if len(packs) != 1 || len(names) != 2 {
+		t.Errorf("expected one pack and its index after repacking, found %v", names)
+	}
+	if _, err := readCommit(commits[0]); err != nil {
+		t.Errorf("commit lost by repacking: %v", err)
+	}
+}
+
+func TestOfsDeltaOffsetEncoding(t *testing.T) {
+	for _, rel := range []int64{1, 127, 128, 16383, 16384, 1 << 20, 1<<31 + 5} {
+		enc := encodeOfsDeltaOffset(rel)
+		got, err := readOfsDeltaOffset(bytes.NewReader(enc))
+		if err != nil || got != rel {
+			t.Errorf("offset %d round-tripped to %d (%v)", rel, got, err)
+		}
+	}
+}
+
+func TestSelfReferencingRefDelta(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+
+	// A corrupt pack whose only entry is a REF_DELTA against itself.
+	hash := strings.Repeat("ab", sha1.Size)
+	id, _ := hex.DecodeString(hash)
+	delta := makeDelta([]byte("base"), []byte("target")) // short enough for a one-byte header
+
+	var pack bytes.Buffer
+	pack.WriteString(packSignature)
+	binary.Write(&pack, binary.BigEndian, uint32(packVersion))
+	binary.Write(&pack, binary.BigEndian, uint32(1))
+	offset := int64(pack.Len())
+	pack.WriteByte(byte(packRefDelta<<4) | byte(len(delta)))
+	pack.Write(id)
+	zw := zlib.NewWriter(&pack)
+	zw.Write(delta)
+	zw.Close()
+	checksum := sha1.Sum(pack.Bytes())
+	pack.Write(checksum[:])
+
+	idx := encodePackIndex([]*packObject{{hash: hash, offset: offset}}, checksum[:])
+
+	base := filepath.Join(packDir(), "pack-"+hex.EncodeToString(checksum[:]))
+	if err := os.MkdirAll(packDir(), 0755); err != nil {
+		t.Fatalf("failed to create pack directory: %v", err)
+	}
+	if err := os.WriteFile(base+".pack", pack.Bytes(), 0444); err != nil {
+		t.Fatalf("failed to write pack: %v", err)
+	}
+	if err := os.WriteFile(base+".idx", idx, 0444); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	if _, _, err := ReadTypedObject(hash); err == nil || !strings.Contains(err.Error(), "delta chain too long") {
+		t.Errorf("reading a self-referencing delta: got %v, want delta chain too long", err)
+	}
+}
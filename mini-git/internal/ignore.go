@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ignoreFile is the name of the files listing paths that status and add
+// leave alone, with the same syntax as .gitignore.
+const ignoreFile = ".minigitignore"
+
+// ignorePattern is one line of an ignore file. Patterns that contain a
+// slash other than a trailing one are matched against the path relative to
+// the directory of their file; the rest are matched against the last path
+// component at any depth below it.
+type ignorePattern struct {
+	base     string
+	parts    []string
+	anchored bool
+	negate   bool
+	dirOnly  bool
+}
+
+// errPathIgnored is returned by walkWorktree when the directory to walk is
+// itself ignored.
+var errPathIgnored = errors.New("path is ignored")
+
+// ignoreRules holds the patterns that apply in a directory, from the root
+// ignore file down to the directory's own. Later patterns take precedence.
+type ignoreRules []ignorePattern
+
+// parseIgnorePattern parses one line of the ignore file in directory base,
+// which is slash-separated and "" at the root. ok is false for blank lines
+// and comments.
+func parseIgnorePattern(base, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	p.anchored = strings.Contains(line, "/")
+	p.parts = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return p, true
+}
+
+// match reports whether the pattern matches name, a slash-separated path
+// relative to the repository root.
+func (p ignorePattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		rel, ok := strings.CutPrefix(name, p.base+"/")
+		if !ok {
+			return false
+		}
+		name = rel
+	}
+	if !p.anchored {
+		return matchParts(p.parts, []string{path.Base(name)})
+	}
+	return matchParts(p.parts, strings.Split(name, "/"))
+}
+
+// matchParts matches path components against pattern components, where
+// "**" stands for any number of directories, or at the end for everything
+// inside one.
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+		return false
+	}
+	return matchParts(pattern[1:], parts[1:])
+}
+
+// ignored reports whether name is ignored by the rules. The last matching
+// pattern decides, so a negated pattern can re-include what an earlier one
+// excluded.
+func (r ignoreRules) ignored(name string, isDir bool) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i].match(name, isDir) {
+			return !r[i].negate
+		}
+	}
+	return false
+}
+
+// withDir returns the rules extended by the ignore file in dir, if there is
+// one. The receiver is not modified, so sibling directories can share it.
+func (r ignoreRules) withDir(dir string) (ignoreRules, error) {
+	file, err := os.Open(filepath.Join(filepath.FromSlash(dir), ignoreFile))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	base := dir
+	if base == "." {
+		base = ""
+	}
+	rules := slices.Clip(r)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(base, scanner.Text()); ok {
+			rules = append(rules, p)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// ignoredPath reports whether name, relative to the repository root, is
+// ignored, either itself or because a directory above it is. Git does not
+// look inside an ignored directory, so nothing in it can be re-included.
+func ignoredPath(name string, isDir bool) (bool, error) {
+	rules, err := ignoreRules(nil).withDir(".")
+	if err != nil {
+		return false, err
+	}
+	parts := strings.Split(name, "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		last := i == len(parts)
+		if rules.ignored(prefix, isDir || !last) {
+			return true, nil
+		}
+		if !last {
+			if rules, err = rules.withDir(prefix); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// walkWorktree calls fn with the slash-separated path of every file below
+// dir that is not ignored, in lexical order. Ignored directories are not
+// entered, and the repository directory is always skipped. If dir itself
+// is ignored, it returns errPathIgnored.
+func walkWorktree(dir string, fn func(name string) error) error {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir != "." {
+		ignored, err := ignoredPath(dir, true)
+		if err != nil {
+			return err
+		}
+		if ignored {
+			return errPathIgnored
+		}
+	}
+
+	// Collect the rules of the directories above dir.
+	rules, err := ignoreRules(nil).withDir(".")
+	if err != nil {
+		return err
+	}
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := 1; i < len(parts); i++ {
+			if rules, err = rules.withDir(strings.Join(parts[:i], "/")); err != nil {
+				return err
+			}
+		}
+	}
+	return walkDir(dir, rules, fn)
+}
+
+func walkDir(dir string, parent ignoreRules, fn func(name string) error) error {
+	rules := parent
+	if dir != "." {
+		var err error
+		if rules, err = parent.withDir(dir); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if dir != "." {
+			name = dir + "/" + name
+		}
+		if entry.IsDir() && entry.Name() == ".mini-git" {
+			continue
+		}
+		if rules.ignored(name, entry.IsDir()) {
+			continue
+		}
+
+		if entry.IsDir() {
+			err = walkDir(name, rules, fn)
+		} else {
+			err = fn(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkAll is walkWorktree without the ignore files, for add --force.
+func walkAll(dir string, fn func(name string) error) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".mini-git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(filepath.ToSlash(filepath.Clean(path)))
+	})
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	var rules ignoreRules
+	for _, line := range []string{
+		"# build outputs",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/todo.txt",
+		"docs/*.tmp",
+		"**/cache",
+		"vendor/**",
+		"",
+	} {
+		if p, ok := parseIgnorePattern("", line); ok {
+			rules = append(rules, p)
+		}
+	}
+	if len(rules) != 7 {
+		t.Fatalf("parsed %d patterns, want 7", len(rules))
+	}
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"src/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"src/keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, true},
+		{"build", false, false},
+		{"todo.txt", false, true},
+		{"src/todo.txt", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/sub/a.tmp", false, false},
+		{"a.tmp", false, false},
+		{"cache", true, true},
+		{"x/y/cache", false, true},
+		{"vendor/pkg/file.go", false, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := rules.ignored(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.name, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// writeFiles creates files with the given contents, making directories as
+// needed.
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestWalkWorktreeNestedIgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	writeFiles(t, map[string]string{
+		".minigitignore":     "*.o\nout/\n",
+		"main.c":             "",
+		"main.o":             "",
+		"out/bin":            "",
+		"lib/.minigitignore": "!special.o\n/gen.c\n",
+		"lib/lib.c":          "",
+		"lib/lib.o":          "",
+		"lib/special.o":      "",
+		"lib/gen.c":          "",
+		"lib/sub/gen.c":      "",
+	})
+
+	var got []string
+	err := walkWorktree(".", func(name string) error {
+		got = append(got, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkWorktree failed: %v", err)
+	}
+	want := []string{".minigitignore", "lib/.minigitignore", "lib/lib.c", "lib/special.o", "lib/sub/gen.c", "main.c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+
+	if ignored, _ := ignoredPath("out/bin", false); !ignored {
+		t.Errorf("out/bin should be ignored through its directory")
+	}
+	if ignored, _ := ignoredPath("lib/special.o", false); ignored {
+		t.Errorf("lib/special.o is re-included by lib/.minigitignore")
+	}
+}
+
+func TestRunAddDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	writeFiles(t, map[string]string{
+		".minigitignore": "*.log\n",
+		"a.txt":          "a",
+		"src/b.txt":      "b",
+		"src/debug.log":  "log",
+		"old.txt":        "old",
+	})
+	runAdd([]string{"old.txt"})
+	if err := os.Remove("old.txt"); err != nil {
+		t.Fatalf("failed to remove old.txt: %v", err)
+	}
+
+	runAdd([]string{"src"})
+	index, _ := loadIndex()
+	if _, ok := index["src/b.txt"]; !ok || len(index) != 2 {
+		t.Errorf("add src staged %v, want old.txt and src/b.txt", index)
+	}
+
+	runAdd([]string{"."})
+	index, _ = loadIndex()
+	var paths []string
+	for path := range index {
+		paths = append(paths, path)
+	}
+	if len(paths) != 3 || index["a.txt"] == "" || index[".minigitignore"] == "" {
+		t.Errorf("add . staged %v", paths)
+	}
+	if _, ok := index["old.txt"]; ok {
+		t.Errorf("add . should stage the removal of old.txt")
+	}
+
+	// An ignored file is only added when forced.
+	runAdd([]string{"src/debug.log"})
+	if index, _ := loadIndex(); index["src/debug.log"] != "" {
+		t.Errorf("ignored file was added without -f")
+	}
+	addForce = true
+	defer func() { addForce = false }()
+	runAdd([]string{"src/debug.log"})
+	if index, _ := loadIndex(); index["src/debug.log"] == "" {
+		t.Errorf("ignored file was not added with -f")
+	}
+}
+
+func TestRunAddIgnoredDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	writeFiles(t, map[string]string{
+		".minigitignore": "build/\n",
+		"build/out.bin":  "binary",
+	})
+
+	if err := walkWorktree("build", func(string) error { return nil }); !errors.Is(err, errPathIgnored) {
+		t.Errorf("walking an ignored directory returned %v, want errPathIgnored", err)
+	}
+	if _, err := addDirectory(map[string]string{}, "build"); !errors.Is(err, errPathIgnored) {
+		t.Errorf("adding an ignored directory returned %v, want errPathIgnored", err)
+	}
+
+	runAdd([]string{"build"})
+	if index, _ := loadIndex(); len(index) != 0 {
+		t.Errorf("add of an ignored directory staged %v", index)
+	}
+
+	addForce = true
+	defer func() { addForce = false }()
+	runAdd([]string{"build"})
+	if index, _ := loadIndex(); index["build/out.bin"] == "" {
+		t.Errorf("add -f of an ignored directory did not stage its files, index %v", index)
+	}
+}
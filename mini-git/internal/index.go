@@ -0,0 +1,330 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The index is stored in git's format (version 2 of "DIRC"), so git can
+// read it as well: a 12-byte header, the entries sorted by path, and a
+// SHA-1 of everything before it. Each entry records the stat data of the
+// file as it was when staged, its blob ID and its path.
+var indexPath = filepath.Join(".mini-git", "index")
+
+const (
+	indexSignature = "DIRC"
+	indexVersion   = 2
+	// indexEntrySize is the fixed part of an entry: ten 32-bit stat
+	// fields, the object ID and 16 bits of flags.
+	indexEntrySize = 10*4 + sha1.Size + 2
+	// indexNameMask covers the path length in the flags; longer paths
+	// store the mask and are found by their terminating NUL.
+	indexNameMask = 0xfff
+	// regularFileMode is the mode recorded for every entry, matching the
+	// modeFile used in trees.
+	regularFileMode = 0o100644
+)
+
+// fileStat is the metadata the index keeps to tell whether a file has
+// changed without reading it. Fields are truncated to 32 bits as in git.
+type fileStat struct {
+	ctimeSec, ctimeNsec uint32
+	mtimeSec, mtimeNsec uint32
+	dev, ino            uint32
+	mode                uint32
+	uid, gid            uint32
+	size                uint32
+}
+
+// statFile returns the stat data of the file at path.
+func statFile(path string) (fileStat, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	mtime := info.ModTime()
+	st := fileStat{
+		mtimeSec:  uint32(mtime.Unix()),
+		mtimeNsec: uint32(mtime.Nanosecond()),
+		mode:      regularFileMode,
+		size:      uint32(info.Size()),
+	}
+	// Platforms without a ctime fall back to the mtime.
+	st.ctimeSec, st.ctimeNsec = st.mtimeSec, st.mtimeNsec
+	sysStat(info, &st)
+	return st, nil
+}
+
+// indexEntry is a staged file. A zero stat means the working tree copy is
+// not known to match hash, so it has to be read to compare it.
+type indexEntry struct {
+	hash string
+	stat fileStat
+}
+
+// indexFile is the index as read from disk.
+type indexFile struct {
+	entries map[string]indexEntry
+	// written is when the index was last written. A file modified in the
+	// same instant may have changed again after it was staged without its
+	// stat data showing it, so it is "racily clean" and must be read.
+	written fileStat
+	// refreshed is set when worktreeHash found an entry unchanged by
+	// reading it, so writing the index back saves the next status the work.
+	refreshed bool
+}
+
+func readIndex() (*indexFile, error) {
+	ix := &indexFile{entries: make(map[string]indexEntry)}
+
+	data, err := os.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ix.written, err = statFile(indexPath); err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(indexSignature)) {
+		ix.entries = decodeTextIndex(data)
+		return ix, nil
+	}
+	if ix.entries, err = decodeIndex(data); err != nil {
+		return nil, fmt.Errorf("index file corrupt: %w", err)
+	}
+	return ix, nil
+}
+
+// decodeTextIndex reads the "<hash> <path>" lines older versions of
+// mini-git wrote, so existing repositories keep working. The next write
+// converts the file.
+func decodeTextIndex(data []byte) map[string]indexEntry {
+	entries := make(map[string]indexEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		hash, path, ok := strings.Cut(scanner.Text(), " ")
+		if ok && isHash(hash) {
+			entries[path] = indexEntry{hash: hash}
+		}
+	}
+	return entries
+}
+
+func decodeIndex(data []byte) (map[string]indexEntry, error) {
+	if len(data) < 12+sha1.Size {
+		return nil, errors.New("too short")
+	}
+	body, sum := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if want := sha1.Sum(body); !bytes.Equal(sum, want[:]) {
+		return nil, errors.New("bad checksum")
+	}
+	if version := binary.BigEndian.Uint32(body[4:]); version != indexVersion {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+
+	count := binary.BigEndian.Uint32(body[8:])
+	entries := make(map[string]indexEntry, count)
+	off := 12
+	for i := uint32(0); i < count; i++ {
+		if off+indexEntrySize > len(body) {
+			return nil, errors.New("truncated entry")
+		}
+		e := body[off:]
+		field := func(n int) uint32 { return binary.BigEndian.Uint32(e[4*n:]) }
+		st := fileStat{
+			ctimeSec: field(0), ctimeNsec: field(1),
+			mtimeSec: field(2), mtimeNsec: field(3),
+			dev: field(4), ino: field(5),
+			mode: field(6),
+			uid:  field(7), gid: field(8),
+			size: field(9),
+		}
+		hash := hex.EncodeToString(e[40 : 40+sha1.Size])
+		flags := binary.BigEndian.Uint16(e[40+sha1.Size:])
+		if stage := flags >> 12 & 3; stage != 0 {
+			return nil, fmt.Errorf("unmerged entry at stage %d", stage)
+		}
+
+		nameLen := int(flags & indexNameMask)
+		name := e[indexEntrySize:]
+		if nameLen == indexNameMask {
+			nameLen = bytes.IndexByte(name, 0)
+		}
+		if nameLen < 0 || nameLen > len(name) {
+			return nil, errors.New("truncated path")
+		}
+		entries[string(name[:nameLen])] = indexEntry{hash: hash, stat: st}
+
+		// Entries are padded with one to eight NULs to a multiple of 8.
+		off += (indexEntrySize + nameLen + 8) &^ 7
+	}
+	return entries, nil
+}
+
+func encodeIndex(entries map[string]indexEntry) ([]byte, error) {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString(indexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(paths)))
+
+	for _, path := range paths {
+		entry := entries[path]
+		st := entry.stat
+		for _, field := range []uint32{
+			st.ctimeSec, st.ctimeNsec, st.mtimeSec, st.mtimeNsec,
+			st.dev, st.ino, regularFileMode, st.uid, st.gid, st.size,
+		} {
+			binary.Write(&buf, binary.BigEndian, field)
+		}
+		hash, err := hex.DecodeString(entry.hash)
+		if err != nil || len(hash) != sha1.Size {
+			return nil, fmt.Errorf("bad object ID %q for %s", entry.hash, path)
+		}
+		buf.Write(hash)
+		binary.Write(&buf, binary.BigEndian, uint16(min(len(path), indexNameMask)))
+		buf.WriteString(path)
+		pad := (indexEntrySize+len(path)+8)&^7 - (indexEntrySize + len(path))
+		buf.Write(make([]byte, pad))
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// write replaces the index file, through a temporary file so a reader
+// never sees a partial index.
+func (ix *indexFile) write() error {
+	data, err := encodeIndex(ix.entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(indexPath), "index_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), indexPath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	ix.refreshed = false
+	if st, err := statFile(indexPath); err == nil {
+		ix.written = st
+	}
+	return nil
+}
+
+// hashes returns the staged blob ID of every path.
+func (ix *indexFile) hashes() map[string]string {
+	index := make(map[string]string, len(ix.entries))
+	for path, entry := range ix.entries {
+		index[path] = entry.hash
+	}
+	return index
+}
+
+// worktreeHash returns the blob ID of the working tree copy of the tracked
+// path. When its stat data matches the entry, and it was not modified as
+// late as the index was written, the staged ID is returned without reading
+// the file. Otherwise the file is hashed, and if it turns out unchanged the
+// entry is marked refreshed, so writing the index records its stat data
+// and, for a racily clean file, a later write time, making the next check
+// quick.
+func (ix *indexFile) worktreeHash(path string) (string, error) {
+	name := filepath.FromSlash(path)
+	st, err := statFile(name)
+	if err != nil {
+		return "", err
+	}
+	entry, tracked := ix.entries[path]
+	if tracked && entry.stat == st && !ix.racy(st) {
+		return entry.hash, nil
+	}
+
+	hash, err := hashFile(name)
+	if err != nil {
+		return "", err
+	}
+	if tracked && hash == entry.hash {
+		entry.stat = st
+		ix.entries[path] = entry
+		ix.refreshed = true
+	}
+	return hash, nil
+}
+
+// racy reports whether a file with stat data st was modified no earlier
+// than the index was written.
+func (ix *indexFile) racy(st fileStat) bool {
+	if st.mtimeSec != ix.written.mtimeSec {
+		return st.mtimeSec > ix.written.mtimeSec
+	}
+	return st.mtimeNsec >= ix.written.mtimeNsec
+}
+
+// loadIndex returns the staged blob ID of every path.
+func loadIndex() (map[string]string, error) {
+	ix, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	return ix.hashes(), nil
+}
+
+// saveIndex writes index as the new set of staged files. Entries whose
+// blob is unchanged keep their stat data. New or changed ones record the
+// working tree file's stat data only if that file holds exactly the staged
+// blob, which is the case right after add or checkout but not, say, for a
+// file left with conflict markers.
+func saveIndex(index map[string]string) error {
+	ix, err := readIndex()
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]indexEntry, len(index))
+	for path, hash := range index {
+		if old, ok := ix.entries[path]; ok && old.hash == hash {
+			entries[path] = old
+			continue
+		}
+
+		entry := indexEntry{hash: hash}
+		name := filepath.FromSlash(path)
+		if st, err := statFile(name); err == nil {
+			if current, err := hashFile(name); err == nil && current == hash {
+				entry.stat = st
+			}
+		}
+		entries[path] = entry
+	}
+	ix.entries = entries
+	return ix.write()
+}
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexRoundTrip(t *testing.T) {
+	long := strings.Repeat("d/", 2100) + "file.txt"
+	entries := map[string]indexEntry{
+		"a.txt": {
+			hash: "51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f",
+			stat: fileStat{ctimeSec: 1, ctimeNsec: 2, mtimeSec: 3, mtimeNsec: 4, dev: 5, ino: 6, mode: regularFileMode, uid: 7, gid: 8, size: 9},
+		},
+		"dir/b.txt": {hash: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", stat: fileStat{mode: regularFileMode}},
+		"eight---":  {hash: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", stat: fileStat{mode: regularFileMode}},
+		long:        {hash: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", stat: fileStat{mode: regularFileMode}},
+	}
+
+	data, err := encodeIndex(entries)
+	if err != nil {
+		t.Fatalf("encodeIndex failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("DIRC\x00\x00\x00\x02\x00\x00\x00\x04")) {
+		t.Errorf("unexpected header % x", data[:12])
+	}
+
+	got, err := decodeIndex(data)
+	if err != nil {
+		t.Fatalf("decodeIndex failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip changed the entries:\n got %v\nwant %v", got, entries)
+	}
+
+	data[20] ^= 1
+	if _, err := decodeIndex(data); err == nil {
+		t.Errorf("a corrupted index was accepted")
+	}
+}
+
+func TestIndexReadsTextFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	legacy := "51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f test.txt\ne69de29bb2d1d6434b8b29ae775ad8c2e48c5391 dir/empty\n"
+	if err := os.WriteFile(indexPath, []byte(legacy), 0644); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	index, err := loadIndex()
+	if err != nil {
+		t.Fatalf("loadIndex failed: %v", err)
+	}
+	want := map[string]string{
+		"test.txt":  "51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f",
+		"dir/empty": "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+	}
+	if !reflect.DeepEqual(index, want) {
+		t.Fatalf("loaded %v, want %v", index, want)
+	}
+
+	if err := saveIndex(index); err != nil {
+		t.Fatalf("saveIndex failed: %v", err)
+	}
+	data, _ := os.ReadFile(indexPath)
+	if !bytes.HasPrefix(data, []byte(indexSignature)) {
+		t.Errorf("index was not converted to the binary format")
+	}
+	if index, _ := loadIndex(); !reflect.DeepEqual(index, want) {
+		t.Errorf("converted index holds %v, want %v", index, want)
+	}
+}
+
+func TestWorktreeHashUsesStatData(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	if err := os.WriteFile("a.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write a.txt: %v", err)
+	}
+	st, err := statFile("a.txt")
+	if err != nil {
+		t.Fatalf("statFile failed: %v", err)
+	}
+	real := HashObject(blobObject, []byte("content"))
+	cached := strings.Repeat("0", 40)
+
+	// Matching stat data from before the index was written is trusted, so
+	// the file is not read.
+	ix := &indexFile{entries: map[string]indexEntry{"a.txt": {hash: cached, stat: st}}}
+	ix.written = st
+	ix.written.mtimeSec++
+	if got, err := ix.worktreeHash("a.txt"); err != nil || got != cached {
+		t.Errorf("clean entry: got %s, %v, want the cached ID", got, err)
+	}
+
+	// A file modified as late as the index was written could have changed
+	// since it was staged, so it is read.
+	ix.written = st
+	if got, err := ix.worktreeHash("a.txt"); err != nil || got != real {
+		t.Errorf("racy entry: got %s, %v, want %s", got, err, real)
+	}
+
+	// An entry without stat data is read, and refreshed if unchanged.
+	ix = &indexFile{entries: map[string]indexEntry{"a.txt": {hash: real}}}
+	if got, err := ix.worktreeHash("a.txt"); err != nil || got != real {
+		t.Errorf("entry without stat data: got %s, %v, want %s", got, err, real)
+	}
+	if !ix.refreshed || ix.entries["a.txt"].stat != st {
+		t.Errorf("unchanged file did not refresh its stat data")
+	}
+}
+
+func TestSaveIndexRecordsStatOnlyForMatchingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	if err := os.WriteFile("a.txt", []byte("staged"), 0644); err != nil {
+		t.Fatalf("failed to write a.txt: %v", err)
+	}
+	if err := os.WriteFile("b.txt", []byte("conflict markers"), 0644); err != nil {
+		t.Fatalf("failed to write b.txt: %v", err)
+	}
+	err := saveIndex(map[string]string{
+		"a.txt": HashObject(blobObject, []byte("staged")),
+		"b.txt": HashObject(blobObject, []byte("ours")),
+	})
+	if err != nil {
+		t.Fatalf("saveIndex failed: %v", err)
+	}
+
+	ix, err := readIndex()
+	if err != nil {
+		t.Fatalf("readIndex failed: %v", err)
+	}
+	if ix.entries["a.txt"].stat.size != uint32(len("staged")) {
+		t.Errorf("a.txt matches its blob but has no stat data")
+	}
+	if ix.entries["b.txt"].stat != (fileStat{mode: regularFileMode}) {
+		t.Errorf("b.txt differs from its blob but got stat data %+v", ix.entries["b.txt"].stat)
+	}
+
+	var out bytes.Buffer
+	writeLsFiles(&out, ix, true, false)
+	want := "100644 " + ix.entries["a.txt"].hash + " 0\ta.txt\n100644 " + ix.entries["b.txt"].hash + " 0\tb.txt\n"
+	if out.String() != want {
+		t.Errorf("ls-files --stage printed:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRacilyCleanEntryIsRefreshed(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	if err := os.WriteFile("a.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write a.txt: %v", err)
+	}
+	runAdd([]string{"a.txt"})
+
+	// Make the index look written in the same instant as a.txt changed.
+	info, err := os.Stat("a.txt")
+	if err != nil {
+		t.Fatalf("failed to stat a.txt: %v", err)
+	}
+	if err := os.Chtimes(indexPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to set index time: %v", err)
+	}
+
+	ix, err := readIndex()
+	if err != nil {
+		t.Fatalf("readIndex failed: %v", err)
+	}
+	if !ix.racy(ix.entries["a.txt"].stat) {
+		t.Fatalf("a.txt should be racily clean")
+	}
+	if _, err := ix.worktreeHash("a.txt"); err != nil {
+		t.Fatalf("worktreeHash failed: %v", err)
+	}
+	if !ix.refreshed {
+		t.Fatalf("an unchanged racily clean entry was not marked refreshed")
+	}
+
+	// Once the index is written back, the entry is trusted again.
+	time.Sleep(10 * time.Millisecond)
+	if err := ix.write(); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	ix, err = readIndex()
+	if err != nil {
+		t.Fatalf("readIndex failed: %v", err)
+	}
+	if ix.racy(ix.entries["a.txt"].stat) {
+		t.Errorf("a.txt is still racily clean after the index was rewritten")
+	}
+
+	// status does the same write-back.
+	if err := os.Chtimes(indexPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to set index time: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	runStatus()
+	if ix, _ = readIndex(); ix.racy(ix.entries["a.txt"].stat) {
+		t.Errorf("status did not write back the refreshed index")
+	}
+}
@@ -3,7 +3,9 @@ package internal
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -32,48 +34,114 @@ func runLog() {
 		return
 	}
 
-	for commitHash != "" {
-		data, err := ReadObject(commitHash)
-		if err != nil {
-			fmt.Printf("Error reading commit %s: %v\n", commitHash, err)
-			break
-		}
+	entries, err := walkHistory(commitHash)
+	if err != nil {
+		fmt.Printf("Error reading history: %v\n", err)
+	}
 
-		lines := strings.Split(string(data), "\n")
-		var author, message strings.Builder
-		var parent string
-		isMessage := false
+	for _, entry := range entries {
+		c := entry.commit
+		author, date := parseSignature(c.author)
 
-		for _, line := range lines {
-			if isMessage {
-				message.WriteString(line)
-				message.WriteString("\n")
-				continue
+		fmt.Printf("\033[33mcommit %s\033[0m\n", entry.hash)
+		if len(c.parents) > 1 {
+			short := make([]string, len(c.parents))
+			for i, parent := range c.parents {
+				short[i] = parent[:min(7, len(parent))]
 			}
-			if line == "" {
-				isMessage = true
-				continue
+			fmt.Printf("Merge: %s\n", strings.Join(short, " "))
+		}
+		fmt.Printf("Author: %s\n", author)
+		if !date.IsZero() {
+			fmt.Printf("Date:   %s\n", date.Format("Mon Jan 2 15:04:05 2006 -0700"))
+		}
+		fmt.Println()
+		fmt.Printf("    %s\n", strings.TrimSpace(c.message))
+		fmt.Println()
+	}
+}
+
+// logEntry is a commit as listed by log.
+type logEntry struct {
+	hash   string
+	commit commit
+}
+
+// walkHistory returns head and every commit reachable from it through any
+// parent, newest first by committer date, like git log. Commits with the
+// same date keep the order they were reached in. If a commit cannot be
+// read, the history up to it is returned with the error.
+func walkHistory(head string) ([]logEntry, error) {
+	var entries, pending []logEntry
+	var dates []time.Time
+	seen := map[string]bool{head: true}
+
+	c, err := readCommit(head)
+	if err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", head, err)
+	}
+	pending = append(pending, logEntry{head, c})
+	dates = append(dates, commitDate(c))
+
+	for len(pending) > 0 {
+		next := 0
+		for i := range pending {
+			if dates[i].After(dates[next]) {
+				next = i
 			}
+		}
+		entry := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+		dates = append(dates[:next], dates[next+1:]...)
+		entries = append(entries, entry)
 
-			parts := strings.SplitN(line, " ", 2)
-			if len(parts) < 2 {
+		for _, parent := range entry.commit.parents {
+			if seen[parent] {
 				continue
 			}
-
-			switch parts[0] {
-			case "author":
-				author.WriteString(parts[1])
-			case "parent":
-				parent = parts[1]
+			seen[parent] = true
+			c, err := readCommit(parent)
+			if err != nil {
+				return entries, fmt.Errorf("reading commit %s: %w", parent, err)
 			}
+			pending = append(pending, logEntry{parent, c})
+			dates = append(dates, commitDate(c))
 		}
+	}
+	return entries, nil
+}
 
-		fmt.Printf("\033[33mcommit %s\033[0m\n", commitHash)
-		fmt.Printf("Author: %s\n", author.String())
-		fmt.Println()
-		fmt.Printf("    %s\n", strings.TrimSpace(message.String()))
-		fmt.Println()
+// commitDate is when c was committed, or authored if it has no committer.
+func commitDate(c commit) time.Time {
+	sig := c.committer
+	if sig == "" {
+		sig = c.author
+	}
+	_, date := parseSignature(sig)
+	return date
+}
+
+// parseSignature splits an author or committer line, "Name <email> <unix
+// seconds> <zone>", into the identity and the time. The time is zero if the
+// line has none.
+func parseSignature(sig string) (string, time.Time) {
+	end := strings.LastIndex(sig, ">")
+	if end < 0 {
+		return sig, time.Time{}
+	}
+	identity := sig[:end+1]
+	fields := strings.Fields(sig[end+1:])
+	if len(fields) != 2 {
+		return identity, time.Time{}
+	}
 
-		commitHash = parent
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return identity, time.Time{}
+	}
+	zone, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return identity, time.Unix(seconds, 0)
 	}
+	return identity, time.Unix(seconds, 0).In(zone.Location())
 }
@@ -18,9 +18,9 @@ func TestRunLog(t *testing.T) {
 
 	runInit(nil, nil)
 
-	c1Hash, _ := StoreObject([]byte("tree some-tree-hash\nauthor User <user@example.com>\n\nInitial commit\n"))
+	c1Hash, _ := StoreObject(commitObject, []byte("tree some-tree-hash\nauthor User <user@example.com>\n\nInitial commit\n"))
 
-	c2Hash, _ := StoreObject([]byte(fmt.Sprintf("tree another-tree-hash\nparent %s\nauthor User <user@example.com>\n\nSecond commit\n", c1Hash)))
+	c2Hash, _ := StoreObject(commitObject, []byte(fmt.Sprintf("tree another-tree-hash\nparent %s\nauthor User <user@example.com>\n\nSecond commit\n", c1Hash)))
 
 	if err := os.WriteFile(".mini-git/refs/heads/main", []byte(c2Hash), 0644); err != nil {
 		t.Fatalf("failed to update main branch: %v", err)
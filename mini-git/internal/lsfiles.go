@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsFilesStage bool
+	lsFilesDebug bool
+)
+
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [-s] [--debug]",
+	Short: "Show the files in the index",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		runLsFiles()
+	},
+}
+
+func init() {
+	lsFilesCmd.Flags().BoolVarP(&lsFilesStage, "stage", "s", false, "show mode, object ID and stage of each entry")
+	lsFilesCmd.Flags().BoolVar(&lsFilesDebug, "debug", false, "show the stat data cached for each entry")
+	rootCmd.AddCommand(lsFilesCmd)
+}
+
+func runLsFiles() {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+
+	ix, err := readIndex()
+	if err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		return
+	}
+	writeLsFiles(os.Stdout, ix, lsFilesStage, lsFilesDebug)
+}
+
+// writeLsFiles lists the index entries in path order, in the formats of
+// git ls-files.
+func writeLsFiles(w io.Writer, ix *indexFile, stage, debug bool) {
+	paths := make([]string, 0, len(ix.entries))
+	for path := range ix.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		entry := ix.entries[path]
+		if stage {
+			fmt.Fprintf(w, "%06o %s 0\t%s\n", regularFileMode, entry.hash, path)
+		} else {
+			fmt.Fprintln(w, path)
+		}
+		if debug {
+			st := entry.stat
+			fmt.Fprintf(w, "  ctime: %d:%d\n", st.ctimeSec, st.ctimeNsec)
+			fmt.Fprintf(w, "  mtime: %d:%d\n", st.mtimeSec, st.mtimeNsec)
+			fmt.Fprintf(w, "  dev: %d\tino: %d\n", st.dev, st.ino)
+			fmt.Fprintf(w, "  uid: %d\tgid: %d\n", st.uid, st.gid)
+			fmt.Fprintf(w, "  size: %d\tflags: 0\n", st.size)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// While a merge with conflicts is waiting to be committed, MERGE_HEAD holds
+// the commit being merged, MERGE_MSG the message for the merge commit and
+// MERGE_CONFLICTS the paths not yet resolved with add.
+var (
+	mergeHeadPath      = filepath.Join(".mini-git", "MERGE_HEAD")
+	mergeMsgPath       = filepath.Join(".mini-git", "MERGE_MSG")
+	mergeConflictsPath = filepath.Join(".mini-git", "MERGE_CONFLICTS")
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <branch|commit>",
+	Short: "Join another line of history into the current branch",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runMerge(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
+
+// mergedFile is the outcome of merging one path. For a conflict, data is
+// what is left in the working tree, markers and all, and hash is the
+// version kept in the index until the path is resolved.
+type mergedFile struct {
+	deleted  bool
+	data     []byte
+	hash     string
+	conflict bool
+}
+
+func runMerge(_ *cobra.Command, args []string) {
+	if _, err := os.Stat(".mini-git"); os.IsNotExist(err) {
+		fmt.Println("Not a mini-git repository (run 'mini-git init' first)")
+		return
+	}
+	if len(args) != 1 {
+		fmt.Println("usage: mini-git merge <branch|commit>")
+		return
+	}
+	name := args[0]
+
+	if pending, err := readMergeHead(); err != nil || pending != "" {
+		fmt.Println("fatal: You have not concluded your merge (MERGE_HEAD exists).")
+		fmt.Println("Please resolve the conflicts and commit before merging again.")
+		return
+	}
+
+	theirs, err := ResolveRef(name)
+	if err != nil {
+		fmt.Printf("merge: %s - not something we can merge\n", name)
+		return
+	}
+	theirsCommit, err := readCommit(theirs)
+	if err != nil {
+		fmt.Printf("error: '%s' is not a commit\n", name)
+		return
+	}
+
+	ours, err := headCommit()
+	if err != nil {
+		fmt.Printf("Error reading HEAD: %v\n", err)
+		return
+	}
+
+	// On a branch with no commits yet, merging just adopts the history.
+	if ours == "" {
+		if err := switchTree(theirsCommit.tree); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return
+		}
+		if err := updateHead(theirs); err != nil {
+			fmt.Printf("Error updating HEAD: %v\n", err)
+			return
+		}
+		fmt.Println("Fast-forward")
+		return
+	}
+
+	base, err := mergeBase(ours, theirs)
+	if err != nil {
+		fmt.Printf("Error finding merge base: %v\n", err)
+		return
+	}
+	switch base {
+	case "":
+		fmt.Println("fatal: refusing to merge unrelated histories")
+		return
+	case theirs:
+		fmt.Println("Already up to date.")
+		return
+	case ours:
+		if err := switchTree(theirsCommit.tree); err != nil {
+			fmt.Printf("error: %v\n", err)
+			fmt.Println("Aborting")
+			return
+		}
+		if err := updateHead(theirs); err != nil {
+			fmt.Printf("Error updating HEAD: %v\n", err)
+			return
+		}
+		fmt.Printf("Updating %s..%s\n", ours[:7], theirs[:7])
+		fmt.Println("Fast-forward")
+		return
+	}
+
+	message := fmt.Sprintf("Merge branch '%s'", name)
+	if !branchExists(name) {
+		message = fmt.Sprintf("Merge commit '%s'", name)
+	}
+	if err := mergeCommits(base, ours, theirs, name, message); err != nil {
+		fmt.Printf("error: %v\n", err)
+		fmt.Println("Aborting")
+	}
+}
+
+// mergeCommits merges theirs into ours, starting from their common ancestor
+// base. Without conflicts the result is committed with both parents;
+// otherwise the merge state is saved for commit to finish once the
+// conflicts are resolved.
+func mergeCommits(base, ours, theirs, name, message string) error {
+	baseFiles, err := commitTreeFiles(base)
+	if err != nil {
+		return err
+	}
+	oursFiles, err := commitTreeFiles(ours)
+	if err != nil {
+		return err
+	}
+	theirsFiles, err := commitTreeFiles(theirs)
+	if err != nil {
+		return err
+	}
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(index, oursFiles) {
+		return fmt.Errorf("your index contains uncommitted changes.\nPlease commit your changes before you merge.")
+	}
+
+	paths := make(map[string]bool)
+	for _, files := range []map[string]string{baseFiles, oursFiles, theirsFiles} {
+		for path := range files {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	results := make(map[string]mergedFile)
+	for _, path := range sorted {
+		result, changed, err := mergeFile(path, baseFiles[path], oursFiles[path], theirsFiles[path], name)
+		if err != nil {
+			return err
+		}
+		if changed {
+			results[path] = result
+		}
+	}
+
+	changed := make(map[string]bool)
+	to := make(map[string]string)
+	for path, result := range results {
+		changed[path] = true
+		if !result.deleted && !result.conflict {
+			to[path] = result.hash
+		}
+	}
+	if err := checkOverwrite("merge", "merge", oursFiles, index, to, changed); err != nil {
+		return err
+	}
+
+	var conflicts []string
+	for _, path := range sorted {
+		result, ok := results[path]
+		if !ok {
+			continue
+		}
+		if result.deleted {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyParents(path)
+			delete(index, path)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, result.data, 0644); err != nil {
+			return err
+		}
+		if result.conflict {
+			conflicts = append(conflicts, path)
+		} else if _, err := StoreObject(blobObject, result.data); err != nil {
+			return err
+		}
+		index[path] = result.hash
+	}
+	if err := saveIndex(index); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		if err := os.WriteFile(mergeHeadPath, []byte(theirs+"\n"), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(mergeMsgPath, []byte(message+"\n"), 0644); err != nil {
+			return err
+		}
+		if err := saveConflicts(conflicts); err != nil {
+			return err
+		}
+		fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+		return nil
+	}
+
+	tree, err := writeTree(index)
+	if err != nil {
+		return err
+	}
+	hash, err := writeCommit(tree, []string{ours, theirs}, message)
+	if err != nil {
+		return err
+	}
+	if err := updateHead(hash); err != nil {
+		return err
+	}
+	fmt.Println("Merge made by the 'three-way' strategy.")
+	return nil
+}
+
+// mergeFile decides one path from its blob in the base and on each side,
+// "" where it does not exist. It reports whether the outcome differs from
+// ours or is a conflict.
+func mergeFile(path, base, ours, theirs, name string) (mergedFile, bool, error) {
+	switch {
+	case ours == theirs, theirs == base:
+		return mergedFile{}, false, nil
+	case ours == base:
+		if theirs == "" {
+			return mergedFile{deleted: true}, true, nil
+		}
+		data, err := ReadObject(theirs)
+		return mergedFile{data: data, hash: theirs}, true, err
+	case ours == "":
+		fmt.Printf("CONFLICT (modify/delete): %s deleted in HEAD and modified in %s. Version %s of %s left in tree.\n", path, name, name, path)
+		data, err := ReadObject(theirs)
+		return mergedFile{data: data, hash: theirs, conflict: true}, true, err
+	case theirs == "":
+		fmt.Printf("CONFLICT (modify/delete): %s deleted in %s and modified in HEAD. Version HEAD of %s left in tree.\n", path, name, path)
+		data, err := ReadObject(ours)
+		return mergedFile{data: data, hash: ours, conflict: true}, true, err
+	}
+
+	var baseData []byte
+	if base != "" {
+		var err error
+		if baseData, err = ReadObject(base); err != nil {
+			return mergedFile{}, false, err
+		}
+	}
+	oursData, err := ReadObject(ours)
+	if err != nil {
+		return mergedFile{}, false, err
+	}
+	theirsData, err := ReadObject(theirs)
+	if err != nil {
+		return mergedFile{}, false, err
+	}
+
+	kind := "content"
+	if base == "" {
+		kind = "add/add"
+	}
+	fmt.Printf("Auto-merging %s\n", path)
+	if bytes.IndexByte(oursData, 0) >= 0 || bytes.IndexByte(theirsData, 0) >= 0 {
+		fmt.Printf("warning: Cannot merge binary files: %s (HEAD vs. %s)\n", path, name)
+		fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", kind, path)
+		return mergedFile{data: oursData, hash: ours, conflict: true}, true, nil
+	}
+
+	lines, conflict := merge3(splitLines(baseData), splitLines(oursData), splitLines(theirsData), "HEAD", name)
+	data := []byte(strings.Join(lines, ""))
+	if conflict {
+		fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", kind, path)
+		return mergedFile{data: data, hash: ours, conflict: true}, true, nil
+	}
+	return mergedFile{data: data, hash: HashObject(blobObject, data)}, true, nil
+}
+
+// commitTreeFiles returns the files in the tree of commit hash.
+func commitTreeFiles(hash string) (map[string]string, error) {
+	c, err := readCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	return readTree(c.tree)
+}
+
+// mergeBase returns the best common ancestor of commits a and b: one that
+// no other common ancestor descends from. It returns "" if the histories
+// are unrelated. Of several equally good candidates (a criss-cross
+// history) the one found first is used.
+func mergeBase(a, b string) (string, error) {
+	fromA, err := ancestors(a)
+	if err != nil {
+		return "", err
+	}
+
+	// Walk back from b, stopping at the first common commit on each path.
+	var common []string
+	seen := make(map[string]bool)
+	queue := []string{b}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if fromA[hash] {
+			common = append(common, hash)
+			continue
+		}
+		c, err := readCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		queue = append(queue, c.parents...)
+	}
+
+	for _, candidate := range common {
+		best := true
+		for _, other := range common {
+			if other == candidate {
+				continue
+			}
+			below, err := ancestors(other)
+			if err != nil {
+				return "", err
+			}
+			if below[candidate] {
+				best = false
+				break
+			}
+		}
+		if best {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// ancestors returns hash and every commit reachable from it.
+func ancestors(hash string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	stack := []string{hash}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		c, err := readCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, c.parents...)
+	}
+	return seen, nil
+}
+
+// readMergeHead returns the commit being merged, or "" if no merge is in
+// progress.
+func readMergeHead() (string, error) {
+	data, err := os.ReadFile(mergeHeadPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+func loadConflicts() ([]string, error) {
+	data, err := os.ReadFile(mergeConflictsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range strings.Split(string(data), "\n") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func saveConflicts(paths []string) error {
+	if len(paths) == 0 {
+		return os.WriteFile(mergeConflictsPath, nil, 0644)
+	}
+	return os.WriteFile(mergeConflictsPath, []byte(strings.Join(paths, "\n")+"\n"), 0644)
+}
+
+// resolveConflicts marks paths as resolved, if a merge is in progress.
+func resolveConflicts(paths []string) error {
+	conflicts, err := loadConflicts()
+	if err != nil || len(conflicts) == 0 {
+		return err
+	}
+	resolved := make(map[string]bool)
+	for _, path := range paths {
+		resolved[path] = true
+	}
+	remaining := conflicts[:0]
+	for _, path := range conflicts {
+		if !resolved[path] {
+			remaining = append(remaining, path)
+		}
+	}
+	return saveConflicts(remaining)
+}
+
+// clearMergeState forgets a merge once it is committed.
+func clearMergeState() error {
+	for _, path := range []string{mergeHeadPath, mergeMsgPath, mergeConflictsPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := splitLines([]byte("a\nb\nc\nd\ne\n"))
+
+	tests := []struct {
+		name         string
+		ours, theirs string
+		want         string
+		conflict     bool
+	}{
+		{"disjoint", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", false},
+		{"same change", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", false},
+		{"insert and delete", "a\nb\nx\nc\nd\ne\n", "a\nb\nc\ne\n", "a\nb\nx\nc\ne\n", false},
+		{
+			"overlapping", "a\nours\nc\nd\ne\n", "a\ntheirs\nc\nd\ne\n",
+			"a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\nc\nd\ne\n", true,
+		},
+		{
+			"no trailing newline", "a\nb\nc\nd\nours", "a\nb\nc\nd\ntheirs",
+			"a\nb\nc\nd\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\n", true,
+		},
+	}
+	for _, tt := range tests {
+		lines, conflict := merge3(base, splitLines([]byte(tt.ours)), splitLines([]byte(tt.theirs)), "HEAD", "feature")
+		if got := strings.Join(lines, ""); got != tt.want || conflict != tt.conflict {
+			t.Errorf("%s: got %q (conflict %v), want %q (conflict %v)", tt.name, got, conflict, tt.want, tt.conflict)
+		}
+	}
+}
+
+func TestRunMergeFastForward(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	commitFiles(t, "base", map[string]string{"a.txt": "v1"})
+	runBranch([]string{"feature"})
+	runCheckout(nil, []string{"feature"})
+	tip := commitFiles(t, "feature work", map[string]string{"a.txt": "v2", "b.txt": "b"})
+	runCheckout(nil, []string{"main"})
+
+	runMerge(nil, []string{"feature"})
+
+	if head, _ := ResolveRef("HEAD"); head != tip {
+		t.Errorf("main is at %s after a fast-forward, want %s", head, tip)
+	}
+	if branch, _ := getCurrentBranch(); branch != "main" {
+		t.Errorf("expected to stay on main, got %q", branch)
+	}
+	if got := readFile(t, "b.txt"); got != "b" {
+		t.Errorf("b.txt is %q, want b", got)
+	}
+}
+
+func TestRunMergeThreeWay(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	base := commitFiles(t, "base", map[string]string{"a.txt": "1\n2\n3\n4\n5\n", "gone.txt": "x\n"})
+	runBranch([]string{"feature"})
+	ours := commitFiles(t, "main work", map[string]string{"a.txt": "one\n2\n3\n4\n5\n", "main.txt": "m\n"})
+	runCheckout(nil, []string{"feature"})
+	if err := os.Remove("gone.txt"); err != nil {
+		t.Fatalf("failed to remove gone.txt: %v", err)
+	}
+	staged, _ := loadIndex()
+	delete(staged, "gone.txt")
+	if err := saveIndex(staged); err != nil {
+		t.Fatalf("failed to unstage gone.txt: %v", err)
+	}
+	theirs := commitFiles(t, "feature work", map[string]string{"a.txt": "1\n2\n3\n4\nfive\n"})
+	runCheckout(nil, []string{"main"})
+
+	if got, err := mergeBase(ours, theirs); err != nil || got != base {
+		t.Fatalf("mergeBase = %s, %v, want %s", got, err, base)
+	}
+
+	runMerge(nil, []string{"feature"})
+
+	head, _ := ResolveRef("HEAD")
+	merge, err := readCommit(head)
+	if err != nil {
+		t.Fatalf("failed to read merge commit: %v", err)
+	}
+	if want := []string{ours, theirs}; !reflect.DeepEqual(merge.parents, want) {
+		t.Errorf("merge parents %v, want %v", merge.parents, want)
+	}
+	if got := readFile(t, "a.txt"); got != "one\n2\n3\n4\nfive\n" {
+		t.Errorf("a.txt is %q", got)
+	}
+	if _, err := os.Stat("gone.txt"); !os.IsNotExist(err) {
+		t.Errorf("gone.txt should have been deleted, stat error %v", err)
+	}
+	index, _ := loadIndex()
+	files, _ := readTree(merge.tree)
+	if !reflect.DeepEqual(index, files) {
+		t.Errorf("index %v does not match the merge tree %v", index, files)
+	}
+
+	entries, err := walkHistory(head)
+	if err != nil {
+		t.Fatalf("walkHistory failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		seen[entry.hash] = true
+	}
+	if len(entries) != 4 || !seen[ours] || !seen[theirs] || !seen[base] || entries[0].hash != head {
+		t.Errorf("history of the merge has %d commits, want merge, both sides and base", len(entries))
+	}
+	if entries[len(entries)-1].hash != base {
+		t.Errorf("base should be listed last")
+	}
+
+	runMerge(nil, []string{"feature"})
+	if again, _ := ResolveRef("HEAD"); again != head {
+		t.Errorf("merging an ancestor moved HEAD")
+	}
+}
+
+func TestRunMergeConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	commitFiles(t, "base", map[string]string{"a.txt": "line\n"})
+	runBranch([]string{"feature"})
+	ours := commitFiles(t, "main work", map[string]string{"a.txt": "ours\n"})
+	runCheckout(nil, []string{"feature"})
+	theirs := commitFiles(t, "feature work", map[string]string{"a.txt": "theirs\n"})
+	runCheckout(nil, []string{"main"})
+
+	runMerge(nil, []string{"feature"})
+
+	want := "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\n"
+	if got := readFile(t, "a.txt"); got != want {
+		t.Errorf("a.txt is %q, want %q", got, want)
+	}
+	if head, _ := ResolveRef("HEAD"); head != ours {
+		t.Fatalf("a conflicted merge must not commit")
+	}
+	if mergeHead, _ := readMergeHead(); mergeHead != theirs {
+		t.Errorf("MERGE_HEAD is %q, want %s", mergeHead, theirs)
+	}
+
+	// Committing is refused until the conflict is marked resolved.
+	commitMessage = ""
+	runCommit(nil, nil)
+	if head, _ := ResolveRef("HEAD"); head != ours {
+		t.Fatalf("committed with unresolved conflicts")
+	}
+
+	if err := os.WriteFile("a.txt", []byte("both\n"), 0644); err != nil {
+		t.Fatalf("failed to resolve a.txt: %v", err)
+	}
+	runAdd([]string{"a.txt"})
+	runCommit(nil, nil)
+
+	head, _ := ResolveRef("HEAD")
+	merge, err := readCommit(head)
+	if err != nil {
+		t.Fatalf("failed to read merge commit: %v", err)
+	}
+	if want := []string{ours, theirs}; !reflect.DeepEqual(merge.parents, want) {
+		t.Errorf("merge parents %v, want %v", merge.parents, want)
+	}
+	if firstLine(merge.message) != "Merge branch 'feature'" {
+		t.Errorf("merge message %q", merge.message)
+	}
+	if mergeHead, _ := readMergeHead(); mergeHead != "" {
+		t.Errorf("MERGE_HEAD was not cleared")
+	}
+}
+
+// TestRunMergeResolveWithAddAll keeps ours' side of a conflict. The file
+// then matches the index again, and "add ." must still mark it resolved.
+func TestRunMergeResolveWithAddAll(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+	commitFiles(t, "base", map[string]string{"a.txt": "line\n"})
+	runBranch([]string{"feature"})
+	ours := commitFiles(t, "main work", map[string]string{"a.txt": "ours\n"})
+	runCheckout(nil, []string{"feature"})
+	theirs := commitFiles(t, "feature work", map[string]string{"a.txt": "theirs\n"})
+	runCheckout(nil, []string{"main"})
+
+	runMerge(nil, []string{"feature"})
+	if conflicts, _ := loadConflicts(); !reflect.DeepEqual(conflicts, []string{"a.txt"}) {
+		t.Fatalf("conflicts after merge: %v", conflicts)
+	}
+
+	if err := os.WriteFile("a.txt", []byte("ours\n"), 0644); err != nil {
+		t.Fatalf("failed to resolve a.txt: %v", err)
+	}
+	runAdd([]string{"."})
+	if conflicts, _ := loadConflicts(); len(conflicts) != 0 {
+		t.Fatalf("conflicts after add .: %v", conflicts)
+	}
+
+	commitMessage = ""
+	runCommit(nil, nil)
+	head, _ := ResolveRef("HEAD")
+	merge, err := readCommit(head)
+	if err != nil {
+		t.Fatalf("failed to read merge commit: %v", err)
+	}
+	if want := []string{ours, theirs}; !reflect.DeepEqual(merge.parents, want) {
+		t.Errorf("merge parents %v, want %v", merge.parents, want)
+	}
+}
+
+func TestMerge3LargeRewrite(t *testing.T) {
+	const n = 5000
+	base, ours, theirs := make([]string, n), make([]string, n), make([]string, n)
+	for i := range base {
+		base[i] = fmt.Sprintf("line %d\n", i)
+		ours[i], theirs[i] = base[i], base[i]
+	}
+	// Each side rewrites a different half, keeping one line between them.
+	for i := 0; i < n/2-1; i++ {
+		ours[i] = fmt.Sprintf("ours %d\n", i)
+	}
+	for i := n/2 + 1; i < n; i++ {
+		theirs[i] = fmt.Sprintf("theirs %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	lines, conflict := merge3(base, ours, theirs, "HEAD", "feature")
+	runtime.ReadMemStats(&after)
+
+	if conflict {
+		t.Fatalf("changes to separate halves conflicted")
+	}
+	want := append(append([]string(nil), ours[:n/2+1]...), theirs[n/2+1:]...)
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("merge of separate halves does not take each side's rewrite")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("merging a %d-line file allocated %d MB", n, allocated>>20)
+	}
+}
@@ -0,0 +1,189 @@
+package internal
+
+// editKind says how a line moves from the old text to the new one.
+type editKind byte
+
+const (
+	editEqual  editKind = ' '
+	editDelete editKind = '-'
+	editInsert editKind = '+'
+)
+
+// edit is one step of an edit script. oldLine and newLine are the 0-based
+// positions in each text before the step is applied.
+type edit struct {
+	kind    editKind
+	oldLine int
+	newLine int
+}
+
+// myersDiff returns a shortest edit script turning a into b, using the
+// linear-space variant of Myers' O(ND) algorithm ("An O(ND) Difference
+// Algorithm and Its Variations", 1986, section 4b). Instead of keeping the
+// furthest-reaching paths of every round, it searches from both ends at
+// once for a point on a shortest path, then solves the two halves on
+// either side of it, so memory stays O(N+M) however different the texts
+// are. Within each change, deletions come before insertions.
+func myersDiff(a, b []string) []edit {
+	d := differ{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+	return deletesFirst(d.script)
+}
+
+// deletesFirst reorders each run of changes so its deletions precede its
+// insertions, as diff(1) prints them. Splitting a change between two
+// halves can otherwise leave insertions first.
+func deletesFirst(script []edit) []edit {
+	for i := 0; i < len(script); {
+		if script[i].kind == editEqual {
+			i++
+			continue
+		}
+		start := i
+		oldLine, newLine := script[i].oldLine, script[i].newLine
+		deletes := 0
+		for ; i < len(script) && script[i].kind != editEqual; i++ {
+			if script[i].kind == editDelete {
+				deletes++
+			}
+		}
+		for j := start; j < i; j++ {
+			if j-start < deletes {
+				script[j] = edit{kind: editDelete, oldLine: oldLine + j - start, newLine: newLine}
+			} else {
+				script[j] = edit{kind: editInsert, oldLine: oldLine + deletes, newLine: newLine + j - start - deletes}
+			}
+		}
+	}
+	return script
+}
+
+type differ struct {
+	a, b   []string
+	script []edit
+}
+
+// diff appends the script turning a[aLo:aHi] into b[bLo:bHi].
+func (d *differ) diff(aLo, aHi, bLo, bHi int) {
+	// Lines common to both ends need no search.
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.script = append(d.script, edit{kind: editEqual, oldLine: aLo, newLine: bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi || bLo == bHi:
+		d.replace(aLo, aHi, bLo, bHi)
+	default:
+		if x, y, ok := d.split(aLo, aHi, bLo, bHi); ok {
+			d.diff(aLo, x, bLo, y)
+			d.diff(x, aHi, y, bHi)
+		} else {
+			d.replace(aLo, aHi, bLo, bHi)
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.script = append(d.script, edit{kind: editEqual, oldLine: aHi + i, newLine: bHi + i})
+	}
+}
+
+// replace deletes a[aLo:aHi] and inserts b[bLo:bHi].
+func (d *differ) replace(aLo, aHi, bLo, bHi int) {
+	for x := aLo; x < aHi; x++ {
+		d.script = append(d.script, edit{kind: editDelete, oldLine: x, newLine: bLo})
+	}
+	for y := bLo; y < bHi; y++ {
+		d.script = append(d.script, edit{kind: editInsert, oldLine: aHi, newLine: y})
+	}
+}
+
+// split finds where a shortest path through a[aLo:aHi] and b[bLo:bHi]
+// crosses between the searches from the start and from the end, and
+// returns that point in absolute positions. The ranges are non-empty and
+// differ in their first and last lines.
+func (d *differ) split(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// forward[offset+k] is the furthest x reached on diagonal k = x-y from
+	// the start; backward[offset+k] the furthest x reached from the end,
+	// counted backwards, on diagonal k of the reversed texts.
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	// With an odd delta the paths can only meet after a forward step,
+	// and with an even one after a backward step.
+	odd := delta%2 != 0
+	// Diagonals whose paths ran off the right or bottom edge are dropped
+	// from the ends of later rounds.
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + fStart; k <= step-fEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < len(backward) && backward[i] >= 0 && x >= n-backward[i] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + bStart; k <= step-bEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				kf := delta - k
+				if i := offset + kf; i >= 0 && i < len(forward) && forward[i] >= 0 && forward[i] >= n-x {
+					return aLo + forward[i], bLo + forward[i] - kf, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
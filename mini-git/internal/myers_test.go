@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// applyScript rebuilds the new text from the old one and an edit script.
+func applyScript(t *testing.T, a, b []string, script []edit) []string {
+	t.Helper()
+	var out []string
+	for _, e := range script {
+		switch e.kind {
+		case editEqual:
+			if a[e.oldLine] != b[e.newLine] {
+				t.Fatalf("equal step pairs %q with %q", a[e.oldLine], b[e.newLine])
+			}
+			out = append(out, a[e.oldLine])
+		case editInsert:
+			out = append(out, b[e.newLine])
+		}
+	}
+	return out
+}
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abc", "abc", 0},
+		{"abcabba", "cbabac", 5},
+		{"abcdef", "abxdef", 2},
+		{"abc", "xyz", 6},
+	}
+	for _, tt := range tests {
+		a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+		script := myersDiff(a, b)
+
+		edits := 0
+		for _, e := range script {
+			if e.kind != editEqual {
+				edits++
+			}
+		}
+		if edits != tt.edits {
+			t.Errorf("%q -> %q: %d edits, want %d", tt.a, tt.b, edits, tt.edits)
+		}
+		if got := applyScript(t, a, b, script); !reflect.DeepEqual(got, b) && len(b) > 0 {
+			t.Errorf("%q -> %q: script produces %q", tt.a, tt.b, strings.Join(got, ""))
+		}
+	}
+}
+
+// lcsLength is the length of the longest common subsequence of a and b,
+// by dynamic programming, to check that edit scripts are shortest.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestMyersDiffIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomText := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomText(), randomText()
+		script := myersDiff(a, b)
+
+		edits := 0
+		for j, e := range script {
+			if e.kind != editEqual {
+				edits++
+			}
+			if j > 0 && e.kind == editDelete && script[j-1].kind == editInsert {
+				t.Fatalf("%q -> %q: insertion before deletion in %v", a, b, script)
+			}
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("%q -> %q: %d edits, want %d", a, b, edits, want)
+		}
+		if got := applyScript(t, a, b, script); !reflect.DeepEqual(got, b) && len(b) > 0 {
+			t.Fatalf("%q -> %q: script produces %q", a, b, got)
+		}
+	}
+}
+
+func TestMyersDiffLargeRewrite(t *testing.T) {
+	const n = 5000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("old line %d\n", i)
+		b[i] = fmt.Sprintf("new line %d\n", i)
+	}
+	// Keep a few lines in common so the search has to recurse.
+	for i := 0; i < n; i += 1000 {
+		b[i] = a[i]
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	script := myersDiff(a, b)
+	runtime.ReadMemStats(&after)
+
+	edits := 0
+	for _, e := range script {
+		if e.kind != editEqual {
+			edits++
+		}
+	}
+	if want := 2 * (n - 5); edits != want {
+		t.Errorf("%d edits, want %d", edits, want)
+	}
+	// Keeping every round's V array would take gigabytes here.
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("diffing two %d-line files allocated %d MB", n, allocated>>20)
+	}
+}
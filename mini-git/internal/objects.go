@@ -1,34 +1,146 @@
 package internal
 
 import (
+	"bytes"
+	"compress/zlib"
 	"crypto/sha1"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
-func StoreObject(data []byte) (string, error) {
-	hash := sha1.Sum(data)
-	hashStr := fmt.Sprintf("%x", hash)
+// Object types, as written in the header of every object.
+const (
+	blobObject   = "blob"
+	treeObject   = "tree"
+	commitObject = "commit"
+)
+
+// objectHeader is what git prepends to an object's contents before hashing
+// and compressing it: "<type> <size>\0".
+func objectHeader(kind string, size int) []byte {
+	return []byte(fmt.Sprintf("%s %d\x00", kind, size))
+}
+
+// HashObject returns the git object ID of data stored as kind.
+func HashObject(kind string, data []byte) string {
+	h := sha1.New()
+	h.Write(objectHeader(kind, len(data)))
+	h.Write(data)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// StoreObject writes data as an object of type kind in git's loose object
+// format, zlib-compressed under .mini-git/objects, and returns its ID.
+// Objects are immutable, so one that already exists is left alone.
+func StoreObject(kind string, data []byte) (string, error) {
+	hashStr := HashObject(kind, data)
 
 	dir := filepath.Join(".mini-git", "objects", hashStr[:2])
 	path := filepath.Join(dir, hashStr[2:])
+	if _, err := os.Stat(path); err == nil {
+		return hashStr, nil
+	}
+	if p, _, err := findPacked(hashStr); err == nil && p != nil {
+		return hashStr, nil
+	}
 
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(objectHeader(kind, len(data)))
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file and rename it into place so a reader never
+	// sees a partial object.
+	tmp, err := os.CreateTemp(dir, "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
 		return "", err
 	}
 
 	return hashStr, nil
 }
 
+// ReadObject returns the contents of an object, without its header.
 func ReadObject(hashStr string) ([]byte, error) {
+	_, data, err := ReadTypedObject(hashStr)
+	return data, err
+}
+
+// ReadTypedObject returns an object's type and contents.
+func ReadTypedObject(hashStr string) (string, []byte, error) {
+	return readObject(hashStr, 0)
+}
+
+// readObject reads an object that is the base of depth deltas already
+// being resolved, so packed delta chains stay bounded across lookups.
+func readObject(hashStr string, depth int) (string, []byte, error) {
 	if len(hashStr) < 2 {
-		return nil, fmt.Errorf("invalid hash: %s", hashStr)
+		return "", nil, fmt.Errorf("invalid hash: %s", hashStr)
 	}
 	path := filepath.Join(".mini-git", "objects", hashStr[:2], hashStr[2:])
-	return os.ReadFile(path)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Not loose, so it may have been packed by gc.
+		return readPackedObject(hashStr, depth)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", hashStr, err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", hashStr, err)
+	}
+	return parseObject(hashStr, raw)
+}
+
+// parseObject splits a decompressed object into its type and contents,
+// checking the size recorded in the header.
+func parseObject(hashStr string, raw []byte) (string, []byte, error) {
+	header, data, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("object %s: missing header", hashStr)
+	}
+	kind, sizeStr, ok := bytes.Cut(header, []byte{' '})
+	if !ok {
+		return "", nil, fmt.Errorf("object %s: malformed header %q", hashStr, header)
+	}
+	size, err := strconv.Atoi(string(sizeStr))
+	if err != nil || size != len(data) {
+		return "", nil, fmt.Errorf("object %s: header says %s bytes, found %d", hashStr, sizeStr, len(data))
+	}
+	return string(kind), data, nil
 }
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreObjectIsGitCompatible(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+
+	runInit(nil, nil)
+
+	// IDs printed by git hash-object -t <type>.
+	tests := []struct {
+		kind string
+		data string
+		want string
+	}{
+		{"blob", "", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{"blob", "hello mini-git", "51cf7ffbc5ca3b8fa9841ba9aa2ce525294d254f"},
+		{"tree", "", "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+	}
+	for _, tt := range tests {
+		hash, err := StoreObject(tt.kind, []byte(tt.data))
+		if err != nil {
+			t.Fatalf("StoreObject(%s, %q): %v", tt.kind, tt.data, err)
+		}
+		if hash != tt.want {
+			t.Errorf("StoreObject(%s, %q) = %s, want %s", tt.kind, tt.data, hash, tt.want)
+		}
+
+		// The file is the zlib-compressed header and contents.
+		file, err := os.Open(filepath.Join(".mini-git", "objects", hash[:2], hash[2:]))
+		if err != nil {
+			t.Fatalf("object %s was not written: %v", hash, err)
+		}
+		zr, err := zlib.NewReader(file)
+		if err != nil {
+			t.Fatalf("object %s is not zlib-compressed: %v", hash, err)
+		}
+		raw, _ := io.ReadAll(zr)
+		file.Close()
+		if want := append(objectHeader(tt.kind, len(tt.data)), tt.data...); !bytes.Equal(raw, want) {
+			t.Errorf("object %s holds %q, want %q", hash, raw, want)
+		}
+
+		kind, data, err := ReadTypedObject(hash)
+		if err != nil || kind != tt.kind || string(data) != tt.data {
+			t.Errorf("ReadTypedObject(%s) = %q, %q, %v", hash, kind, data, err)
+		}
+	}
+
+	// Storing the same object again is a no-op.
+	if _, err := StoreObject("blob", []byte("hello mini-git")); err != nil {
+		t.Errorf("storing an existing object failed: %v", err)
+	}
+}
+
+func TestRunCatFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldCwd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(oldCwd)
+	}()
+	defer func() {
+		catFileType, catFileSize, catFilePretty = false, false, false
+	}()
+
+	runInit(nil, nil)
+	hash := commitFiles(t, "first", map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+	c, _ := readCommit(hash)
+
+	for _, obj := range []string{hash, c.tree, "HEAD"} {
+		catFileType, catFileSize, catFilePretty = true, false, false
+		runCatFile([]string{obj})
+		catFileType, catFileSize, catFilePretty = false, false, true
+		runCatFile([]string{obj})
+	}
+}
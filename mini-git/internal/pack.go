@@ -0,0 +1,349 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Packs use git's formats, version 2 of both the pack and its index. A
+// pack is a header, the objects one after another, each a type-and-size
+// header followed by zlib data, and a SHA-1 of all of it. An object may be
+// stored as a delta against one earlier in the same pack (OFS_DELTA) or
+// against any object by ID (REF_DELTA). The index maps object IDs, sorted,
+// to offsets in the pack.
+const (
+	packSignature = "PACK"
+	packVersion   = 2
+	idxVersion    = 2
+	idxHeaderSize = 8 + 256*4
+)
+
+var idxSignature = []byte{0xff, 't', 'O', 'c'}
+
+// Object types as numbered in pack entry headers.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[int]string{
+	packCommit: commitObject,
+	packTree:   treeObject,
+	packBlob:   blobObject,
+	packTag:    "tag",
+}
+
+// maxDeltaChain bounds how many deltas are followed to reach a full
+// object, so a corrupt pack cannot recurse forever.
+const maxDeltaChain = 64
+
+func packDir() string {
+	return filepath.Join(".mini-git", "objects", "pack")
+}
+
+// packIndex is a parsed .idx file.
+type packIndex struct {
+	pack    string // path of the .pack file
+	fanout  [256]uint32
+	names   []byte // sorted object IDs, sha1.Size bytes each
+	offsets []int64
+}
+
+func (p *packIndex) count() int {
+	return len(p.offsets)
+}
+
+func (p *packIndex) name(i int) []byte {
+	return p.names[i*sha1.Size : (i+1)*sha1.Size]
+}
+
+// find returns the offset of the object with the given raw ID.
+func (p *packIndex) find(id []byte) (int64, bool) {
+	lo, hi := 0, int(p.fanout[id[0]])
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.name(lo+i), id) >= 0
+	})
+	if i < hi && bytes.Equal(p.name(i), id) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// withPrefix returns the IDs in the pack that start with the hex prefix,
+// which is at least two characters long.
+func (p *packIndex) withPrefix(prefix string) []string {
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+	lo, hi := 0, int(p.fanout[first[0]])
+	if first[0] > 0 {
+		lo = int(p.fanout[first[0]-1])
+	}
+	var matches []string
+	for i := lo; i < hi; i++ {
+		if name := hex.EncodeToString(p.name(i)); strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+func parsePackIndex(data []byte) (*packIndex, error) {
+	if len(data) < idxHeaderSize+2*sha1.Size || !bytes.HasPrefix(data, idxSignature) {
+		return nil, errors.New("not a pack index")
+	}
+	if version := binary.BigEndian.Uint32(data[4:]); version != idxVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+	body := data[:len(data)-sha1.Size]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return nil, errors.New("pack index checksum mismatch")
+	}
+
+	p := &packIndex{}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(data[8+4*i:])
+	}
+	n := int(p.fanout[255])
+	namesAt := idxHeaderSize
+	offsetsAt := namesAt + n*sha1.Size + n*4 // skipping the CRC32s
+	largeAt := offsetsAt + n*4
+	if largeAt+sha1.Size > len(body) {
+		return nil, errors.New("truncated pack index")
+	}
+	p.names = data[namesAt : namesAt+n*sha1.Size]
+
+	p.offsets = make([]int64, n)
+	for i := range p.offsets {
+		off := binary.BigEndian.Uint32(data[offsetsAt+4*i:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = int64(off)
+			continue
+		}
+		// Offsets past 2GB are kept in a table of 64-bit values.
+		at := largeAt + 8*int(off&0x7fffffff)
+		if at+8 > len(body)-sha1.Size {
+			return nil, errors.New("bad large offset in pack index")
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(data[at:]))
+	}
+	return p, nil
+}
+
+// packCache holds parsed pack indexes by absolute path. A pack's name is
+// its checksum, so a given path always holds the same index.
+var packCache = struct {
+	sync.Mutex
+	indexes map[string]*packIndex
+}{indexes: make(map[string]*packIndex)}
+
+// loadPacks returns the indexes of every pack in the repository.
+func loadPacks() ([]*packIndex, error) {
+	paths, err := filepath.Glob(filepath.Join(packDir(), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+
+	packCache.Lock()
+	defer packCache.Unlock()
+
+	var packs []*packIndex
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := packCache.indexes[abs]; ok {
+			packs = append(packs, p)
+			continue
+		}
+
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return nil, err
+		}
+		p, err := parsePackIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		p.pack = strings.TrimSuffix(abs, ".idx") + ".pack"
+		packCache.indexes[abs] = p
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+// findPacked returns the pack holding the object and its offset there.
+func findPacked(hashStr string) (*packIndex, int64, error) {
+	id, err := hex.DecodeString(hashStr)
+	if err != nil || len(id) != sha1.Size {
+		return nil, 0, fmt.Errorf("invalid hash: %s", hashStr)
+	}
+	packs, err := loadPacks()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, p := range packs {
+		if off, ok := p.find(id); ok {
+			return p, off, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// readPackedObject returns the type and contents of a packed object that
+// is the base of depth deltas already being resolved.
+func readPackedObject(hashStr string, depth int) (string, []byte, error) {
+	p, off, err := findPacked(hashStr)
+	if err != nil {
+		return "", nil, err
+	}
+	if p == nil {
+		return "", nil, fmt.Errorf("object %s: %w", hashStr, os.ErrNotExist)
+	}
+
+	file, err := os.Open(p.pack)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	kind, data, err := readPackEntry(file, p, off, depth)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", hashStr, err)
+	}
+	return kind, data, nil
+}
+
+// readPackEntry reads the object at offset off in the pack indexed by p,
+// resolving deltas. depth counts the deltas followed so far.
+func readPackEntry(pack *os.File, p *packIndex, off int64, depth int) (string, []byte, error) {
+	if depth > maxDeltaChain {
+		return "", nil, errors.New("delta chain too long")
+	}
+	r := bufio.NewReader(io.NewSectionReader(pack, off, 1<<62))
+
+	typ, size, err := readPackEntryHeader(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var baseKind string
+	var base []byte
+	switch typ {
+	case packOfsDelta:
+		rel, err := readOfsDeltaOffset(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if rel <= 0 || rel > off {
+			return "", nil, errors.New("bad delta base offset")
+		}
+		if baseKind, base, err = readPackEntry(pack, p, off-rel, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, sha1.Size)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return "", nil, err
+		}
+		// A base in this pack is read directly; one elsewhere is looked
+		// up by ID. Either way it counts towards the chain.
+		if baseOff, ok := p.find(id); ok {
+			baseKind, base, err = readPackEntry(pack, p, baseOff, depth+1)
+		} else {
+			baseKind, base, err = readObject(hex.EncodeToString(id), depth+1)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		if _, ok := packTypeNames[typ]; !ok {
+			return "", nil, fmt.Errorf("unknown pack object type %d", typ)
+		}
+	}
+
+	data, err := inflate(r, size)
+	if err != nil {
+		return "", nil, err
+	}
+	if typ != packOfsDelta && typ != packRefDelta {
+		return packTypeNames[typ], data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseKind, data, err
+}
+
+// readPackEntryHeader reads the type and the size of the data that follows:
+// three bits of type and four of size, then seven more bits of size per
+// byte while the top bit is set.
+func readPackEntryHeader(r io.ByteReader) (int, int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := int(b>>4) & 7
+	size := int64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(b&0x7f) << shift
+	}
+	return typ, size, nil
+}
+
+// readOfsDeltaOffset reads how far before this entry its base starts.
+// Each continuation byte adds one before shifting, so no value has two
+// encodings.
+func readOfsDeltaOffset(r io.ByteReader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	off := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		off = (off+1)<<7 | int64(b&0x7f)
+	}
+	return off, nil
+}
+
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("entry is %d bytes, header says %d", len(data), size)
+	}
+	return data, nil
+}
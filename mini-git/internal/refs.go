@@ -1,40 +1,162 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// errDetachedHead is returned by getCurrentBranch when HEAD names a commit
+// rather than a branch.
+var errDetachedHead = errors.New("HEAD is detached")
+
+// readHead returns what HEAD points at: a branch name, or a commit hash if
+// detached is true.
+func readHead() (ref string, detached bool, err error) {
+	data, err := os.ReadFile(filepath.Join(".mini-git", "HEAD"))
+	if err != nil {
+		return "", false, err
+	}
+
+	content := strings.TrimSpace(string(data))
+	if branch, ok := strings.CutPrefix(content, "ref: refs/heads/"); ok {
+		return branch, false, nil
+	}
+	if isHash(content) {
+		return content, true, nil
+	}
+	return "", false, fmt.Errorf("invalid HEAD: %q", content)
+}
+
 func getCurrentBranch() (string, error) {
-	headPath := ".mini-git/HEAD"
-	data, err := os.ReadFile(headPath)
+	ref, detached, err := readHead()
 	if err != nil {
 		return "", err
 	}
+	if detached {
+		return "", errDetachedHead
+	}
+	return ref, nil
+}
 
-	content := string(data)
-	if strings.HasPrefix(content, "ref: refs/heads/") {
-		return strings.TrimSpace(strings.TrimPrefix(content, "ref: refs/heads/")), nil
+// headCommit returns the commit HEAD points at, or "" on a branch with no
+// commits yet.
+func headCommit() (string, error) {
+	ref, detached, err := readHead()
+	if err != nil {
+		return "", err
+	}
+	if detached {
+		return ref, nil
 	}
+	hash, err := readBranch(ref)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+func readBranch(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(".mini-git", "refs", "heads", name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
 
-	return "", fmt.Errorf("HEAD is in detached state or invalid")
+func branchExists(name string) bool {
+	_, err := os.Stat(filepath.Join(".mini-git", "refs", "heads", name))
+	return err == nil
 }
 
+// ResolveRef turns HEAD, a branch name, or a full or abbreviated (at least
+// four characters) object hash into a full hash.
 func ResolveRef(ref string) (string, error) {
 	if ref == "HEAD" {
-		branch, err := getCurrentBranch()
+		hash, err := headCommit()
 		if err != nil {
 			return "", err
 		}
-		ref = branch
+		if hash == "" {
+			return "", fmt.Errorf("HEAD does not point to a commit yet")
+		}
+		return hash, nil
+	}
+
+	if hash, err := readBranch(ref); err == nil {
+		return hash, nil
+	}
+
+	if len(ref) >= 4 && len(ref) <= 40 && isHex(ref) {
+		return expandHash(strings.ToLower(ref))
 	}
+	return "", fmt.Errorf("unknown revision '%s'", ref)
+}
 
-	path := filepath.Join(".mini-git", "refs", "heads", ref)
-	data, err := os.ReadFile(path)
+// expandHash finds the single stored object, loose or packed, whose hash
+// starts with prefix.
+func expandHash(prefix string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(".mini-git", "objects", prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		hash := prefix[:2] + entry.Name()
+		if strings.HasPrefix(hash, prefix) {
+			found[hash] = true
+		}
+	}
+	packs, err := loadPacks()
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(string(data)), nil
+	for _, p := range packs {
+		for _, hash := range p.withPrefix(prefix) {
+			found[hash] = true
+		}
+	}
+
+	var matches []string
+	for hash := range found {
+		matches = append(matches, hash)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown revision '%s'", prefix)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("short hash '%s' is ambiguous", prefix)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHash(s string) bool {
+	return len(s) == 40 && isHex(s)
+}
+
+// updateHead points the current branch at hash, or HEAD itself when it is
+// detached. A HEAD that cannot be read is an error rather than something
+// to overwrite.
+func updateHead(hash string) error {
+	branch, err := getCurrentBranch()
+	if errors.Is(err, errDetachedHead) {
+		return os.WriteFile(filepath.Join(".mini-git", "HEAD"), []byte(hash+"\n"), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(".mini-git", "refs", "heads", branch), []byte(hash+"\n"), 0644)
 }
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysStat fills in the fields of st that os.FileInfo does not expose.
+func sysStat(info os.FileInfo, st *fileStat) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	st.ctimeSec, st.ctimeNsec = uint32(sys.Ctimespec.Sec), uint32(sys.Ctimespec.Nsec)
+	st.dev, st.ino = uint32(sys.Dev), uint32(sys.Ino)
+	st.uid, st.gid = sys.Uid, sys.Gid
+}
@@ -1,13 +1,11 @@
 package internal
 
 import (
-	"bufio"
 	"crypto/sha1"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"strings"
+	"sort"
 
 	"github.com/spf13/cobra"
 )
@@ -30,71 +28,118 @@ func runStatus() {
 		return
 	}
 
-	index, err := loadIndex()
+	ix, err := readIndex()
 	if err != nil {
 		fmt.Printf("Error loading index: %v\n", err)
 		return
 	}
+	index := ix.hashes()
 
+	head, err := headTree()
+	if err != nil {
+		fmt.Printf("Error reading HEAD: %v\n", err)
+		return
+	}
+
+	// staged compares the index with HEAD; modified compares the working
+	// tree with the index.
 	staged := []string{}
 	modified := []string{}
 	untracked := []string{}
 
-	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for path, hash := range index {
+		if committed, ok := head[path]; !ok {
+			staged = append(staged, fmt.Sprintf("new file:   %s", path))
+		} else if committed != hash {
+			staged = append(staged, fmt.Sprintf("modified:   %s", path))
 		}
+	}
+	for path := range head {
+		if _, ok := index[path]; !ok {
+			staged = append(staged, fmt.Sprintf("deleted:    %s", path))
+		}
+	}
 
-		if info.IsDir() {
-			if info.Name() == ".mini-git" {
-				return filepath.SkipDir
-			}
-			return nil
+	// Tracked files are compared even if they match an ignore pattern;
+	// ignore files only hide untracked ones. Files whose stat data is
+	// unchanged since they were staged are not read.
+	for path, hash := range index {
+		currentHash, err := ix.worktreeHash(path)
+		if os.IsNotExist(err) {
+			modified = append(modified, fmt.Sprintf("deleted:    %s", path))
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			return
 		}
+		if currentHash != hash {
+			modified = append(modified, fmt.Sprintf("modified:   %s", path))
+		}
+	}
 
-		relPath := strings.TrimPrefix(path, "./")
+	// Like git status, save what was learned about unchanged files. This
+	// is only a cache, so failing to write it is not an error.
+	if ix.refreshed {
+		_ = ix.write()
+	}
 
-		if hash, ok := index[relPath]; ok {
-			currentHash, err := hashFile(path)
-			if err != nil {
-				return err
-			}
-			if currentHash != hash {
-				modified = append(modified, relPath)
-			} else {
-				staged = append(staged, relPath)
-			}
-		} else {
-			untracked = append(untracked, relPath)
+	err = walkWorktree(".", func(path string) error {
+		if _, ok := index[path]; !ok {
+			untracked = append(untracked, path)
 		}
-
 		return nil
 	})
-
 	if err != nil {
 		fmt.Printf("Error walking directory: %v\n", err)
 		return
 	}
 
-	currentBranch, err := getCurrentBranch()
-	if err != nil {
-		currentBranch = "unknown"
+	sort.Strings(staged)
+	sort.Strings(modified)
+
+	if ref, detached, err := readHead(); err != nil {
+		fmt.Println("On branch unknown")
+	} else if detached {
+		fmt.Printf("HEAD detached at %s\n", ref[:7])
+	} else {
+		fmt.Printf("On branch %s\n", ref)
 	}
-	fmt.Printf("On branch %s\n", currentBranch)
 	fmt.Println()
 
+	conflicts, err := loadConflicts()
+	if err != nil {
+		fmt.Printf("Error reading merge conflicts: %v\n", err)
+		return
+	}
+	if mergeHead, _ := readMergeHead(); mergeHead != "" {
+		if len(conflicts) > 0 {
+			fmt.Println("You have unmerged paths.")
+			fmt.Println("  (fix conflicts and run \"mini-git add <file>\", then \"mini-git commit\")")
+			fmt.Println()
+			fmt.Println("Unmerged paths:")
+			for _, path := range conflicts {
+				fmt.Printf("\tunmerged:   %s\n", path)
+			}
+		} else {
+			fmt.Println("All conflicts fixed but you are still merging.")
+			fmt.Println("  (use \"mini-git commit\" to conclude merge)")
+		}
+		fmt.Println()
+	}
+
 	if len(staged) > 0 {
 		fmt.Println("Changes to be committed:")
-		for _, file := range staged {
-			fmt.Printf("\tnew file:   %s\n", file)
+		for _, change := range staged {
+			fmt.Printf("\t%s\n", change)
 		}
 		fmt.Println()
 	}
 
 	if len(modified) > 0 {
 		fmt.Println("Changes not staged for commit:")
-		for _, file := range modified {
-			fmt.Printf("\tmodified:   %s\n", file)
+		for _, change := range modified {
+			fmt.Printf("\t%s\n", change)
 		}
 		fmt.Println()
 	}
@@ -112,39 +157,21 @@ func runStatus() {
 	}
 }
 
-func loadIndex() (map[string]string, error) {
-	index := make(map[string]string)
-	indexPath := ".mini-git/index"
-
-	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
-		return index, nil
-	}
-
-	file, err := os.Open(indexPath)
+// hashFile returns the blob ID the file at path would be stored under.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		parts := strings.Split(scanner.Text(), " ")
-		if len(parts) == 2 {
-			index[parts[1]] = parts[0]
-		}
-	}
-
-	return index, scanner.Err()
-}
-
-func hashFile(path string) (string, error) {
-	file, err := os.Open(path)
+	info, err := file.Stat()
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
 
 	h := sha1.New()
+	h.Write(objectHeader(blobObject, int(info.Size())))
 	if _, err := io.Copy(h, file); err != nil {
 		return "", err
 	}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	modeFile = "100644"
+	modeTree = "40000"
+)
+
+// treeEntry is one line of a tree object: a file or a subdirectory.
+type treeEntry struct {
+	mode string
+	name string
+	hash string
+}
+
+// writeTree stores the tree objects for the files in index, which maps
+// slash-separated paths to blob hashes, and returns the root tree's hash.
+func writeTree(index map[string]string) (string, error) {
+	files := make(map[string]string)
+	dirs := make(map[string]map[string]string)
+
+	for path, hash := range index {
+		dir, rest, nested := strings.Cut(path, "/")
+		if !nested {
+			files[path] = hash
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]string)
+		}
+		dirs[dir][rest] = hash
+	}
+
+	entries := make([]treeEntry, 0, len(files)+len(dirs))
+	for name, hash := range files {
+		entries = append(entries, treeEntry{mode: modeFile, name: name, hash: hash})
+	}
+	for name, sub := range dirs {
+		hash, err := writeTree(sub)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, treeEntry{mode: modeTree, name: name, hash: hash})
+	}
+
+	data, err := encodeTree(entries)
+	if err != nil {
+		return "", err
+	}
+	return StoreObject(treeObject, data)
+}
+
+// encodeTree serializes entries in git's tree format: "<mode> <name>\0"
+// followed by the raw 20-byte hash, sorted as git sorts them, with
+// directories compared as if their names ended in "/".
+func encodeTree(entries []treeEntry) ([]byte, error) {
+	sortKey := func(e treeEntry) string {
+		if e.mode == modeTree {
+			return e.name + "/"
+		}
+		return e.name
+	}
+	sort.Slice(entries, func(i, j int) bool { return sortKey(entries[i]) < sortKey(entries[j]) })
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		raw, err := hex.DecodeString(e.hash)
+		if err != nil || len(raw) != 20 {
+			return nil, fmt.Errorf("invalid hash %q for %s", e.hash, e.name)
+		}
+		fmt.Fprintf(&buf, "%s %s\x00", e.mode, e.name)
+		buf.Write(raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeTree parses a tree object's contents.
+func decodeTree(data []byte) ([]treeEntry, error) {
+	var entries []treeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || len(data) < nul+21 {
+			return nil, fmt.Errorf("malformed tree object")
+		}
+		entries = append(entries, treeEntry{
+			mode: string(data[:space]),
+			name: string(data[space+1 : nul]),
+			hash: hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// readTree flattens the tree hash into a map from slash-separated paths to
+// blob hashes, the same shape as the index.
+func readTree(hash string) (map[string]string, error) {
+	files := make(map[string]string)
+	if err := readTreeInto(hash, "", files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func readTreeInto(hash string, prefix string, files map[string]string) error {
+	kind, data, err := ReadTypedObject(hash)
+	if err != nil {
+		return err
+	}
+	if kind != treeObject {
+		return fmt.Errorf("object %s is a %s, not a tree", hash, kind)
+	}
+	entries, err := decodeTree(data)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.mode == modeTree {
+			if err := readTreeInto(e.hash, prefix+e.name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[prefix+e.name] = e.hash
+	}
+	return nil
+}